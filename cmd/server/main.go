@@ -1,15 +1,19 @@
 package main
 
 import (
+	"encoding/json"
 	"log"
 	"os"
 	"os/exec"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/vitub/CLabServer/internal/ai"
 	"github.com/vitub/CLabServer/internal/api/routes"
 	"github.com/vitub/CLabServer/internal/banner"
+	"github.com/vitub/CLabServer/internal/grading"
 	"github.com/vitub/CLabServer/internal/initializers"
+	"github.com/vitub/CLabServer/internal/quota"
 	"github.com/vitub/CLabServer/internal/ws"
 )
 
@@ -39,6 +43,13 @@ func main() {
 		log.Fatal("Failed to connect to database: ", err)
 	}
 
+	grading.FailInterruptedJobs()
+	ai.ConfigureCacheFromEnv(initializers.DB)
+	if err := ai.LoadPromptOverrides(initializers.DB); err != nil {
+		log.Printf("Failed to load prompt overrides: %v", err)
+	}
+	quota.Install()
+
 	banner.PrintBanner()
 
 	if os.Getenv("GIN_MODE") == "" {
@@ -53,7 +64,12 @@ func main() {
 	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization"}
 	r.Use(cors.New(config))
 
-	hub := ws.NewHub()
+	hub := ws.NewHub(ws.BrokerFromEnv(initializers.DB))
+	hub.OnEvent(ws.EventPromptsChanged, func(json.RawMessage) {
+		if err := ai.LoadPromptOverrides(initializers.DB); err != nil {
+			log.Printf("Failed to reload prompt overrides: %v", err)
+		}
+	})
 	go hub.Run()
 
 	routes.SetupRoutes(r, hub)
@@ -0,0 +1,44 @@
+// Package access answers who teaches and who studies in which classroom. The
+// HTTP handlers, the WebSocket hub, the tutor and the quotas all ask it, so
+// owners and co-teachers are treated alike everywhere.
+package access
+
+import (
+	"github.com/vitub/CLabServer/internal/initializers"
+	"github.com/vitub/CLabServer/internal/models"
+)
+
+// TaughtClassrooms returns the classrooms the user owns or co-teaches.
+func TaughtClassrooms(userID uint) []uint {
+	var ids []uint
+	initializers.DB.Model(&models.Classroom{}).
+		Where("teacher_id = ?", userID).
+		Or("id IN (SELECT classroom_id FROM classroom_teachers WHERE user_id = ?)", userID).
+		Pluck("id", &ids)
+	return ids
+}
+
+// Teaches reports whether the user owns or co-teaches the classroom.
+func Teaches(userID uint, classroomID uint) bool {
+	var count int64
+	initializers.DB.Model(&models.Classroom{}).
+		Where("id = ?", classroomID).
+		Where(initializers.DB.Where("teacher_id = ?", userID).
+			Or("id IN (SELECT classroom_id FROM classroom_teachers WHERE user_id = ?)", userID)).
+		Count(&count)
+	return count > 0
+}
+
+// EnrolledClassrooms returns the classrooms the user studies in.
+func EnrolledClassrooms(userID uint) []uint {
+	var ids []uint
+	initializers.DB.Table("classroom_students").Where("user_id = ?", userID).Pluck("classroom_id", &ids)
+	return ids
+}
+
+// Enrolled reports whether the user studies in the classroom.
+func Enrolled(userID uint, classroomID uint) bool {
+	var count int64
+	initializers.DB.Table("classroom_students").Where("classroom_id = ? AND user_id = ?", classroomID, userID).Count(&count)
+	return count > 0
+}
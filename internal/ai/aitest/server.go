@@ -0,0 +1,194 @@
+// Package aitest provides a local HTTP stand-in for the Ollama and
+// OpenAI-compatible APIs so code that depends on an ai.Provider can run offline.
+package aitest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vitub/CLabServer/internal/ai"
+)
+
+// Server answers /api/generate (Ollama) and /v1/chat/completions (OpenAI) with
+// the text returned by Reply, streaming it word by word when asked to.
+type Server struct {
+	*httptest.Server
+
+	Reply func(prompt string) string
+	// RejectSchema makes the OpenAI endpoint answer 400 to json_schema
+	// response formats, like servers that only support JSON mode.
+	RejectSchema bool
+
+	mu      sync.Mutex
+	prompts []string
+	formats []string
+}
+
+// NewServer starts a stand-in server. A nil reply echoes the prompt back.
+func NewServer(reply func(prompt string) string) *Server {
+	if reply == nil {
+		reply = func(prompt string) string { return prompt }
+	}
+	s := &Server{Reply: reply}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/generate", s.handleOllama)
+	mux.HandleFunc("/v1/chat/completions", s.handleOpenAI)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Config returns a provider configuration pointing at the stand-in.
+// name must be "ollama" or "openai".
+func (s *Server) Config(name string) ai.ProviderConfig {
+	baseURL := s.URL
+	if name != "ollama" {
+		baseURL += "/v1"
+	}
+	return ai.ProviderConfig{
+		Name:      name,
+		BaseURL:   baseURL,
+		Model:     "stand-in",
+		MaxTokens: 2048,
+		Timeout:   5 * time.Second,
+	}
+}
+
+// Prompts returns every prompt received so far.
+func (s *Server) Prompts() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.prompts...)
+}
+
+// Formats returns the output format of every request received so far: ""
+// for text, "json" or "schema" for Ollama and "json_object" or "json_schema"
+// for OpenAI. Rejected requests are included.
+func (s *Server) Formats() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.formats...)
+}
+
+func (s *Server) recordFormat(format string) {
+	s.mu.Lock()
+	s.formats = append(s.formats, format)
+	s.mu.Unlock()
+}
+
+func (s *Server) record(prompt string) string {
+	s.mu.Lock()
+	s.prompts = append(s.prompts, prompt)
+	s.mu.Unlock()
+	return s.Reply(prompt)
+}
+
+func (s *Server) handleOllama(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Prompt string          `json:"prompt"`
+		Stream bool            `json:"stream"`
+		Format json.RawMessage `json:"format"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch {
+	case len(req.Format) == 0:
+		s.recordFormat("")
+	case string(req.Format) == `"json"`:
+		s.recordFormat("json")
+	default:
+		s.recordFormat("schema")
+	}
+	reply := s.record(req.Prompt)
+
+	if !req.Stream {
+		json.NewEncoder(w).Encode(map[string]interface{}{"response": reply, "done": true})
+		return
+	}
+
+	enc := json.NewEncoder(w)
+	for _, chunk := range splitChunks(reply) {
+		enc.Encode(map[string]interface{}{"response": chunk, "done": false})
+		flush(w)
+	}
+	enc.Encode(map[string]interface{}{"response": "", "done": true})
+}
+
+func (s *Server) handleOpenAI(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Messages []struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"messages"`
+		Stream         bool `json:"stream"`
+		ResponseFormat struct {
+			Type string `json:"type"`
+		} `json:"response_format"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.recordFormat(req.ResponseFormat.Type)
+	if s.RejectSchema && req.ResponseFormat.Type == "json_schema" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": map[string]string{"message": "response_format json_schema is not supported"},
+		})
+		return
+	}
+	var prompt string
+	if len(req.Messages) > 0 {
+		prompt = req.Messages[len(req.Messages)-1].Content
+	}
+	reply := s.record(prompt)
+
+	if !req.Stream {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]string{"role": "assistant", "content": reply}},
+			},
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, chunk := range splitChunks(reply) {
+		data, _ := json.Marshal(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"delta": map[string]string{"content": chunk}},
+			},
+		})
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flush(w)
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+// splitChunks splits text into word-sized chunks that concatenate back to text.
+func splitChunks(text string) []string {
+	var chunks []string
+	for len(text) > 0 {
+		i := strings.IndexByte(text[1:], ' ')
+		if i < 0 {
+			chunks = append(chunks, text)
+			break
+		}
+		chunks = append(chunks, text[:i+1])
+		text = text[i+1:]
+	}
+	return chunks
+}
+
+func flush(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,333 @@
+package ai
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vitub/CLabServer/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Cache stores AI responses by key. Implementations must be safe for concurrent use.
+type Cache interface {
+	Get(key string) (string, bool)
+	Set(key string, value string)
+}
+
+// CacheStats reports how often cached responses were reused.
+type CacheStats struct {
+	Backend string `json:"backend"`
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+}
+
+var (
+	cacheMu      sync.RWMutex
+	cache        Cache
+	cacheBackend = "off"
+	cacheHits    atomic.Uint64
+	cacheMisses  atomic.Uint64
+)
+
+// SetCache installs the cache used for analysis responses. nil disables caching.
+func SetCache(c Cache, backend string) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	cache = c
+	cacheBackend = backend
+	if c == nil {
+		cacheBackend = "off"
+	}
+}
+
+// GetCacheStats returns the hit and miss counters since startup.
+func GetCacheStats() CacheStats {
+	cacheMu.RLock()
+	backend := cacheBackend
+	cacheMu.RUnlock()
+	return CacheStats{Backend: backend, Hits: cacheHits.Load(), Misses: cacheMisses.Load()}
+}
+
+// ConfigureCacheFromEnv installs the cache selected by AI_CACHE ("memory",
+// "postgres" or "off"; default "memory"), bounded by AI_CACHE_TTL and
+// AI_CACHE_MAX_ENTRIES.
+func ConfigureCacheFromEnv(db *gorm.DB) {
+	ttl := parseTimeout(os.Getenv("AI_CACHE_TTL"))
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	maxEntries, err := strconv.Atoi(os.Getenv("AI_CACHE_MAX_ENTRIES"))
+	if err != nil || maxEntries <= 0 {
+		maxEntries = 1000
+	}
+
+	switch backend := envOr("AI_CACHE", "memory"); backend {
+	case "memory":
+		SetCache(NewMemoryCache(ttl, maxEntries), backend)
+	case "postgres":
+		SetCache(NewPostgresCache(db, ttl, maxEntries), backend)
+	case "off":
+		SetCache(nil, backend)
+	default:
+		log.Printf("Unknown AI_CACHE %q, caching disabled", backend)
+		SetCache(nil, "off")
+	}
+}
+
+// CacheKey hashes the provider, model and prompt template version together with
+// the normalized code and program output, so trivially different submissions
+// share an entry while a change of backend never serves the old one's answers.
+func CacheKey(cfg ProviderConfig, templateVersion string, code string, output string) string {
+	h := sha256.New()
+	h.Write([]byte(cfg.Name))
+	h.Write([]byte{0})
+	h.Write([]byte(cfg.Model))
+	h.Write([]byte{0})
+	h.Write([]byte(templateVersion))
+	h.Write([]byte{0})
+	h.Write([]byte(NormalizeCode(code)))
+	h.Write([]byte{0})
+	h.Write([]byte(normalizeOutput(output)))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// NormalizeCode removes C comments and collapses whitespace outside string
+// and character literals. Runs of whitespace that contain a line break become
+// one newline, so preprocessor lines and line-based statements stay apart.
+func NormalizeCode(code string) string {
+	var b strings.Builder
+	var sep byte // Pending separator: 0, ' ' or '\n'
+	gap := func(newline bool) {
+		if newline {
+			sep = '\n'
+		} else if sep == 0 {
+			sep = ' '
+		}
+	}
+	for i := 0; i < len(code); i++ {
+		ch := code[i]
+		switch {
+		case ch == '/' && i+1 < len(code) && code[i+1] == '/':
+			for i+1 < len(code) && code[i+1] != '\n' {
+				i++
+			}
+			gap(false)
+		case ch == '/' && i+1 < len(code) && code[i+1] == '*':
+			end := strings.Index(code[i+2:], "*/")
+			if end < 0 {
+				end = len(code) - i - 2
+			}
+			gap(strings.Contains(code[i+2:i+2+end], "\n"))
+			i += end + 3
+		case ch == '\n':
+			gap(true)
+		case ch == ' ' || ch == '\t' || ch == '\r' || ch == '\f' || ch == '\v':
+			gap(false)
+		default:
+			if sep != 0 && b.Len() > 0 {
+				b.WriteByte(sep)
+			}
+			sep = 0
+			if ch == '"' || ch == '\'' {
+				start := i
+				for i++; i < len(code) && code[i] != ch && code[i] != '\n'; i++ {
+					if code[i] == '\\' {
+						i++
+					}
+				}
+				if i >= len(code) {
+					i = len(code) - 1
+				}
+				b.WriteString(code[start : i+1])
+				continue
+			}
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
+
+func normalizeOutput(output string) string {
+	lines := strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+func cacheLookup(key string) (string, bool) {
+	cacheMu.RLock()
+	c := cache
+	cacheMu.RUnlock()
+	if c == nil {
+		return "", false
+	}
+	if value, ok := c.Get(key); ok {
+		cacheHits.Add(1)
+		return value, true
+	}
+	cacheMisses.Add(1)
+	return "", false
+}
+
+func cacheStore(key string, value string) {
+	cacheMu.RLock()
+	c := cache
+	cacheMu.RUnlock()
+	if c != nil && strings.TrimSpace(value) != "" {
+		c.Set(key, value)
+	}
+}
+
+// cachedCall is completeAI with the response cached under key. Cache hits
+// do not count against the caller's quota.
+func cachedCall(ctx context.Context, key string, task Task, prompt renderedPrompt) (string, error) {
+	if value, ok := cacheLookup(key); ok {
+		return value, nil
+	}
+	response, fellBack, err := complete(ctx, "", task, prompt, Request{})
+	if err == nil && !fellBack {
+		cacheStore(key, response)
+	}
+	return response, err
+}
+
+// cachedStream is streamAI with the response cached under key. A cache hit is
+// delivered as a single chunk.
+func cachedStream(ctx context.Context, key string, task Task, prompt renderedPrompt, onChunk func(string)) (string, error) {
+	if value, ok := cacheLookup(key); ok {
+		onChunk(value)
+		return value, nil
+	}
+	response, fellBack, err := stream(ctx, task, prompt, onChunk)
+	if err == nil && !fellBack {
+		cacheStore(key, response)
+	}
+	return response, err
+}
+
+// MemoryCache is an in-process LRU cache with a per-entry TTL.
+type MemoryCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	order      *list.List
+	entries    map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key       string
+	value     string
+	expiresAt time.Time
+}
+
+func NewMemoryCache(ttl time.Duration, maxEntries int) *MemoryCache {
+	return &MemoryCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+func (m *MemoryCache) Get(key string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	el, ok := m.entries[key]
+	if !ok {
+		return "", false
+	}
+	entry := el.Value.(*memoryEntry)
+	if time.Now().After(entry.expiresAt) {
+		m.order.Remove(el)
+		delete(m.entries, key)
+		return "", false
+	}
+	m.order.MoveToFront(el)
+	return entry.value, true
+}
+
+func (m *MemoryCache) Set(key string, value string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	expiresAt := time.Now().Add(m.ttl)
+	if el, ok := m.entries[key]; ok {
+		entry := el.Value.(*memoryEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		m.order.MoveToFront(el)
+		return
+	}
+	m.entries[key] = m.order.PushFront(&memoryEntry{key: key, value: value, expiresAt: expiresAt})
+	for m.order.Len() > m.maxEntries {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.entries, oldest.Value.(*memoryEntry).key)
+	}
+}
+
+// cacheTrimInterval is how often the Postgres cache drops expired entries and
+// the oldest ones beyond its size limit.
+const cacheTrimInterval = 10 * time.Minute
+
+// PostgresCache keeps entries in the ai_cache_entries table so they survive
+// restarts and are shared between server instances. The table may briefly
+// grow past maxEntries between trims.
+type PostgresCache struct {
+	db         *gorm.DB
+	ttl        time.Duration
+	maxEntries int
+}
+
+func NewPostgresCache(db *gorm.DB, ttl time.Duration, maxEntries int) *PostgresCache {
+	p := &PostgresCache{db: db, ttl: ttl, maxEntries: maxEntries}
+	go p.trimRoutine()
+	return p
+}
+
+func (p *PostgresCache) Get(key string) (string, bool) {
+	var entry models.AICacheEntry
+	if err := p.db.Where("key = ? AND expires_at > ?", key, time.Now()).First(&entry).Error; err != nil {
+		return "", false
+	}
+	return entry.Response, true
+}
+
+func (p *PostgresCache) Set(key string, value string) {
+	now := time.Now()
+	entry := models.AICacheEntry{Key: key, Response: value, ExpiresAt: now.Add(p.ttl), CreatedAt: now}
+	err := p.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"response", "expires_at", "created_at"}),
+	}).Create(&entry).Error
+	if err != nil {
+		log.Printf("Failed to store AI cache entry: %v", err)
+	}
+}
+
+func (p *PostgresCache) trimRoutine() {
+	ticker := time.NewTicker(cacheTrimInterval)
+	for range ticker.C {
+		p.Trim()
+	}
+}
+
+// Trim deletes expired entries and the oldest ones beyond maxEntries.
+func (p *PostgresCache) Trim() {
+	if err := p.db.Where("expires_at <= ?", time.Now()).Delete(&models.AICacheEntry{}).Error; err != nil {
+		log.Printf("Failed to trim AI cache: %v", err)
+		return
+	}
+	p.db.Exec(`DELETE FROM ai_cache_entries WHERE key IN (
+		SELECT key FROM ai_cache_entries ORDER BY created_at DESC OFFSET ?)`, p.maxEntries)
+}
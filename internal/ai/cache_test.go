@@ -0,0 +1,104 @@
+package ai
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestNormalizeCode(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want string
+	}{
+		{"keeps line breaks", "#include <stdio.h>\nint main() {\n    return 0;\n}", "#include <stdio.h>\nint main() {\nreturn 0;\n}"},
+		{"collapses blank lines", "int x;\n\n\n\nint y;", "int x;\nint y;"},
+		{"strips line comments", "int x; // contador\nint y;", "int x;\nint y;"},
+		{"strips block comments", "int /* largura */ x;", "int x;"},
+		{"block comment spanning lines", "int x; /* a\n b */ int y;", "int x;\nint y;"},
+		{"strips trailing whitespace", "int x;   \t\r\nint y;  ", "int x;\nint y;"},
+		{"collapses indentation", "\t\tint   x;", "int x;"},
+		{"keeps string literals", `printf("a  // b");`, `printf("a  // b");`},
+		{"keeps char literals", `char c = ' ';`, `char c = ' ';`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeCode(tt.code); got != tt.want {
+				t.Errorf("NormalizeCode(%q) = %q, want %q", tt.code, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheKeyIgnoresCosmeticChanges(t *testing.T) {
+	cfg := ProviderConfig{Name: "ollama", Model: "qwen2.5-coder"}
+	a := "#include <stdio.h>\nint main() {\n    printf(\"%d\\n\", 7);\n    return 0;\n}\n"
+	b := "#include <stdio.h>\n\n// soma\nint main() {\n\tprintf(\"%d\\n\", 7);   \n\n\treturn 0; /* fim */\n}"
+	if CacheKey(cfg, "v1", a, "7\n") != CacheKey(cfg, "v1", b, "7  \r\n") {
+		t.Error("cosmetically different submissions got different keys")
+	}
+	if CacheKey(cfg, "v1", a, "7") == CacheKey(cfg, "v1", a, "8") {
+		t.Error("different outputs got the same key")
+	}
+}
+
+func TestCacheKeyChangesWithBackendAndPrompt(t *testing.T) {
+	cfg := ProviderConfig{Name: "ollama", Model: "qwen2.5-coder"}
+	version := func(locale string) string {
+		return builtinPrompts[promptKey{name: PromptAnalysis, language: DefaultLanguage, locale: locale}].version
+	}
+	base := CacheKey(cfg, version("pt"), "int main() {}", "")
+
+	tests := []struct {
+		name    string
+		cfg     ProviderConfig
+		version string
+	}{
+		{"provider", ProviderConfig{Name: "openai", Model: cfg.Model}, version("pt")},
+		{"model", ProviderConfig{Name: cfg.Name, Model: "llama3"}, version("pt")},
+		{"locale", cfg, version("en")},
+		{"template version", cfg, version("pt") + "-override"},
+	}
+	for _, tt := range tests {
+		if CacheKey(tt.cfg, tt.version, "int main() {}", "") == base {
+			t.Errorf("changing the %s kept the same key", tt.name)
+		}
+	}
+}
+
+func TestMemoryCacheExpiresEntries(t *testing.T) {
+	m := NewMemoryCache(20*time.Millisecond, 10)
+	m.Set("k", "v")
+	if got, ok := m.Get("k"); !ok || got != "v" {
+		t.Fatalf("Get before expiry = %q, %v", got, ok)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := m.Get("k"); ok {
+		t.Error("entry served after its TTL")
+	}
+	if m.order.Len() != 0 || len(m.entries) != 0 {
+		t.Error("expired entry kept in the cache")
+	}
+}
+
+func TestMemoryCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	m := NewMemoryCache(time.Hour, 3)
+	for i := 0; i < 3; i++ {
+		m.Set(fmt.Sprint(i), "v")
+	}
+	m.Get("0") // 1 is now the least recently used
+	m.Set("3", "v")
+
+	if _, ok := m.Get("1"); ok {
+		t.Error("least recently used entry was not evicted")
+	}
+	for _, key := range []string{"0", "2", "3"} {
+		if _, ok := m.Get(key); !ok {
+			t.Errorf("entry %s evicted", key)
+		}
+	}
+	if m.order.Len() != 3 {
+		t.Errorf("cache holds %d entries, want 3", m.order.Len())
+	}
+}
@@ -0,0 +1,196 @@
+package ai
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Where a suspected prompt injection was found.
+const (
+	SourceComment       = "code_comment"
+	SourceStringLiteral = "string_literal"
+	SourceOutput        = "program_output"
+	SourceErrorOutput   = "error_output"
+)
+
+// Detection is instruction-like text found in a submission before grading.
+type Detection struct {
+	Source  string `json:"source"`
+	Pattern string `json:"pattern"`
+	Snippet string `json:"snippet"`
+}
+
+type injectionPattern struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// injectionPatterns match text addressed to the grader rather than to the user of
+// the program, in the three prompt languages. They look for imperative phrasing
+// and forged grader responses, never for data such as "Score: 10", which
+// programs print all the time.
+var injectionPatterns = []injectionPattern{
+	{"ignore_instructions", regexp.MustCompile(`(?i)\b(ignor[ea]\w*|disregard|forget|esque[cç]a\w*|olvid[ae]\w*)\b.{0,40}\b(instru[cç]\w*|instructions?|regras?|rules?|reglas?|prompts?|anteriores?|previous|above)\b`)},
+	{"role_override", regexp.MustCompile(`(?i)(^|\n|\s)(system|assistant)\s*:|\b(you are now|act as|você (agora )?é um|actúa como|aja como)\b`)},
+	{"score_request", regexp.MustCompile(`(?i)\b(me d[eê]|d[eê] (a|ao aluno)|give|assign|atribua|asigna|ponha|coloque)\s.{0,30}\b(nota|score|grade|puntuaci[oó]n|pontos|points)\b`)},
+	{"max_score", regexp.MustCompile(`(?i)\b(me d[eê]|d[eê]|give|assign|award|atribua|asigna|dale|ponha|coloque|merece|deserves?)\s.{0,30}\b(nota m[aá]xima|nota 10|full (marks|score)|maximum (score|grade)|max(imum)? points|puntuaci[oó]n m[aá]xima|10/10)`)},
+	{"grader_json", regexp.MustCompile(`(?i)\{[^{}]*"(score|passed)"\s*:[^{}]*"feedback"\s*:|\{[^{}]*"feedback"\s*:[^{}]*"(score|passed)"\s*:`)},
+	{"grader_address", regexp.MustCompile(`(?i)\b(corretor|avaliador|grader|evaluator|evaluador|corrector|language model|modelo de linguagem|modelo de lenguaje|\bllm\b|\bai\b|\bia\b)\b.{0,40}\b(deve|must|should|debe|please|por favor)\b`)},
+}
+
+// DetectInjection reports every pattern in text that looks like an instruction to
+// the grading model.
+func DetectInjection(source string, text string) []Detection {
+	var found []Detection
+	for _, p := range injectionPatterns {
+		loc := p.re.FindStringIndex(text)
+		if loc == nil {
+			continue
+		}
+		found = append(found, Detection{Source: source, Pattern: p.name, Snippet: snippetAround(text, loc[0], loc[1])})
+	}
+	return found
+}
+
+func snippetAround(text string, start int, end int) string {
+	const pad = 30
+	if start -= pad; start < 0 {
+		start = 0
+	}
+	if end += pad; end > len(text) {
+		end = len(text)
+	}
+	return strings.ToValidUTF8(strings.TrimSpace(text[start:end]), "")
+}
+
+// formatSpec matches the printf conversions and escape sequences that stay
+// readable when a string literal is escaped, so the grader can still reason
+// about the output format.
+var formatSpec = regexp.MustCompile(`%[-+ #0]*[0-9*]*(\.[0-9*]+)?(hh|h|ll|l|L|z|j|t)?[diouxXeEfgGcspn%]|\\(x[0-9a-fA-F]+|[0-7]{1,3}|(?s:.))`)
+
+// escapeLiteral rewrites the text of a string literal, without its quotes, as
+// \xHH escapes, keeping spaces, format specifiers and escape sequences. The
+// program prints the same bytes, but no instruction can be read from the text.
+func escapeLiteral(text string) string {
+	var b strings.Builder
+	escape := func(plain string) {
+		for i := 0; i < len(plain); i++ {
+			if plain[i] == ' ' {
+				b.WriteByte(' ')
+			} else {
+				fmt.Fprintf(&b, "\\x%02x", plain[i])
+			}
+		}
+	}
+	last := 0
+	for _, loc := range formatSpec.FindAllStringIndex(text, -1) {
+		escape(text[last:loc[0]])
+		b.WriteString(text[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	escape(text[last:])
+	return b.String()
+}
+
+// SanitizeCode prepares student code for a grading prompt. Comments are removed,
+// keeping line breaks so line numbers in compiler errors still match, and the
+// text of every string literal is escaped. Instruction-like text found in
+// either is reported as a Detection.
+func SanitizeCode(code string) (string, []Detection) {
+	var b strings.Builder
+	var detections []Detection
+	for i := 0; i < len(code); i++ {
+		ch := code[i]
+		switch {
+		case ch == '/' && i+1 < len(code) && code[i+1] == '/':
+			start := i
+			for i < len(code) && code[i] != '\n' {
+				i++
+			}
+			detections = append(detections, DetectInjection(SourceComment, code[start:i])...)
+			if i < len(code) {
+				b.WriteByte('\n')
+			}
+		case ch == '/' && i+1 < len(code) && code[i+1] == '*':
+			start := i
+			end := strings.Index(code[i+2:], "*/")
+			if end < 0 {
+				i = len(code)
+			} else {
+				i += end + 3
+			}
+			comment := code[start:min(i+1, len(code))]
+			detections = append(detections, DetectInjection(SourceComment, comment)...)
+			b.WriteString(strings.Repeat("\n", strings.Count(comment, "\n")))
+			if strings.Count(comment, "\n") == 0 {
+				b.WriteByte(' ')
+			}
+		case ch == '"':
+			start := i
+			for i++; i < len(code) && code[i] != '"' && code[i] != '\n'; i++ {
+				if code[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(code) {
+				i = len(code) - 1
+			}
+			if code[i] == '\n' {
+				i-- // Unterminated: the line break stays outside the literal
+			}
+			literal := code[start : i+1]
+			detections = append(detections, DetectInjection(SourceStringLiteral, literal)...)
+			text, closed := literal[1:], i > start && code[i] == '"'
+			if closed {
+				text = text[:len(text)-1]
+			}
+			b.WriteString(`"` + escapeLiteral(text))
+			if closed {
+				b.WriteByte('"')
+			}
+		case ch == '\'':
+			start := i
+			for i++; i < len(code) && code[i] != '\'' && code[i] != '\n'; i++ {
+				if code[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(code) {
+				i = len(code) - 1
+			}
+			b.WriteString(code[start : i+1])
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String(), detections
+}
+
+// newFence returns a random marker that delimits untrusted text in a prompt.
+// It is unpredictable so a submission cannot close the block early.
+func newFence() string {
+	buf := make([]byte, 6)
+	if _, err := rand.Read(buf); err != nil {
+		return "DADOS_ALUNO"
+	}
+	return "DADOS_ALUNO_" + strings.ToUpper(hex.EncodeToString(buf))
+}
+
+// gradingInput is a submission sanitized and delimited for a grading prompt.
+type gradingInput struct {
+	Code       string
+	Output     string
+	Fence      string
+	Detections []Detection
+}
+
+func prepareGradingInput(code string, output string, outputSource string) gradingInput {
+	in := gradingInput{Fence: newFence()}
+	in.Code, in.Detections = SanitizeCode(code)
+	in.Output = output
+	in.Detections = append(in.Detections, DetectInjection(outputSource, output)...)
+	return in
+}
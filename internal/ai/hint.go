@@ -0,0 +1,32 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+)
+
+// Hint levels, from the vaguest to the most concrete.
+const (
+	HintConceptual = 1
+	HintLocation   = 2
+	HintPartialFix = 3
+)
+
+// GetHint returns a hint at the given level for the student's current attempt.
+func GetHint(ctx context.Context, level int, exerciseTitle string, exerciseDescription string, code string, output string) (string, error) {
+	if level < HintConceptual || level > HintPartialFix {
+		return "", fmt.Errorf("invalid hint level %d", level)
+	}
+
+	prompt, err := renderPrompt(PromptHint, LocaleFrom(ctx), map[string]any{
+		"Level":               level,
+		"ExerciseTitle":       exerciseTitle,
+		"ExerciseDescription": exerciseDescription,
+		"Code":                code,
+		"Output":              output,
+	})
+	if err != nil {
+		return "", err
+	}
+	return completeAI(ctx, "", TaskAnalysis, prompt)
+}
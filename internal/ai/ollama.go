@@ -0,0 +1,120 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// OllamaProvider talks to the Ollama /api/generate endpoint.
+type OllamaProvider struct {
+	cfg ProviderConfig
+}
+
+type ollamaResponse struct {
+	Response string `json:"response"`
+	Done     bool   `json:"done"`
+	Error    string `json:"error"`
+}
+
+func (p *OllamaProvider) Complete(ctx context.Context, req Request) (string, error) {
+	resp, err := p.post(ctx, req, false)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result ollamaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("error decoding response: %v", err)
+	}
+	if result.Error != "" {
+		return "", fmt.Errorf("Ollama API error: %s", result.Error)
+	}
+	return result.Response, nil
+}
+
+func (p *OllamaProvider) CompleteJSON(ctx context.Context, req Request, v any) error {
+	req.JSON = true
+	text, err := p.Complete(ctx, req)
+	if err != nil {
+		return err
+	}
+	return decodeJSONResponse(text, v)
+}
+
+func (p *OllamaProvider) Stream(ctx context.Context, req Request, onChunk func(string)) (string, error) {
+	resp, err := p.post(ctx, req, true)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var full bytes.Buffer
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var chunk ollamaResponse
+		if err := json.Unmarshal(scanner.Bytes(), &chunk); err != nil {
+			continue
+		}
+		if chunk.Error != "" {
+			return full.String(), fmt.Errorf("Ollama API error: %s", chunk.Error)
+		}
+		if chunk.Response != "" {
+			full.WriteString(chunk.Response)
+			onChunk(chunk.Response)
+		}
+		if chunk.Done {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return full.String(), fmt.Errorf("error reading Ollama stream: %v", err)
+	}
+	return full.String(), nil
+}
+
+func (p *OllamaProvider) post(ctx context.Context, req Request, stream bool) (*http.Response, error) {
+	payload := map[string]interface{}{
+		"model":  p.cfg.Model,
+		"system": req.System,
+		"prompt": req.Prompt,
+		"stream": stream,
+		"options": map[string]interface{}{
+			"temperature": req.Temperature,
+			"top_p":       0.9,
+			"num_predict": p.cfg.MaxTokens,
+		},
+	}
+	if req.Schema != nil {
+		payload["format"] = req.Schema
+	} else if req.JSON {
+		payload["format"] = "json"
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling request: %v", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.cfg.BaseURL+"/api/generate", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: p.cfg.Timeout}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("error calling Ollama API: %v", err)
+	}
+	if resp.StatusCode >= 400 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("Ollama API returned %s", resp.Status)
+	}
+	return resp, nil
+}
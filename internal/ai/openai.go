@@ -0,0 +1,166 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// OpenAIProvider talks to any OpenAI-compatible /chat/completions endpoint
+// (Groq, vLLM, LM Studio, llama.cpp server).
+type OpenAIProvider struct {
+	cfg ProviderConfig
+}
+
+var errSchemaRejected = errors.New("response_format json_schema rejected")
+
+type openAIResponse struct {
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *OpenAIProvider) Complete(ctx context.Context, req Request) (string, error) {
+	resp, err := p.post(ctx, req, false)
+	if errors.Is(err, errSchemaRejected) {
+		// Not every compatible server understands json_schema; plain JSON mode
+		// still works and the response is validated by the caller.
+		req.Schema = nil
+		resp, err = p.post(ctx, req, false)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result openAIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("error decoding response: %v", err)
+	}
+	if result.Error != nil {
+		return "", fmt.Errorf("%s API error: %s", p.cfg.Name, result.Error.Message)
+	}
+	if len(result.Choices) == 0 {
+		return "", fmt.Errorf("no choices in %s response", p.cfg.Name)
+	}
+	return result.Choices[0].Message.Content, nil
+}
+
+func (p *OpenAIProvider) CompleteJSON(ctx context.Context, req Request, v any) error {
+	req.JSON = true
+	text, err := p.Complete(ctx, req)
+	if err != nil {
+		return err
+	}
+	return decodeJSONResponse(text, v)
+}
+
+func (p *OpenAIProvider) Stream(ctx context.Context, req Request, onChunk func(string)) (string, error) {
+	resp, err := p.post(ctx, req, true)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var full bytes.Buffer
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk openAIResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			continue
+		}
+		if chunk.Error != nil {
+			return full.String(), fmt.Errorf("%s API error: %s", p.cfg.Name, chunk.Error.Message)
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			full.WriteString(chunk.Choices[0].Delta.Content)
+			onChunk(chunk.Choices[0].Delta.Content)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return full.String(), fmt.Errorf("error reading %s stream: %v", p.cfg.Name, err)
+	}
+	return full.String(), nil
+}
+
+func (p *OpenAIProvider) post(ctx context.Context, req Request, stream bool) (*http.Response, error) {
+	messages := []map[string]string{}
+	if req.System != "" {
+		messages = append(messages, map[string]string{"role": "system", "content": req.System})
+	}
+	messages = append(messages, map[string]string{"role": "user", "content": req.Prompt})
+
+	payload := map[string]interface{}{
+		"model":       p.cfg.Model,
+		"messages":    messages,
+		"temperature": req.Temperature,
+		"max_tokens":  p.cfg.MaxTokens,
+		"stream":      stream,
+	}
+	if req.Schema != nil {
+		payload["response_format"] = map[string]interface{}{
+			"type":        "json_schema",
+			"json_schema": map[string]interface{}{"name": "response", "schema": req.Schema},
+		}
+	} else if req.JSON {
+		payload["response_format"] = map[string]string{"type": "json_object"}
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling request: %v", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.cfg.BaseURL+"/chat/completions", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if p.cfg.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.cfg.APIKey)
+	}
+
+	client := &http.Client{Timeout: p.cfg.Timeout}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("error calling %s API: %v", p.cfg.Name, err)
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		var result openAIResponse
+		if json.NewDecoder(resp.Body).Decode(&result) == nil && result.Error != nil {
+			if resp.StatusCode == http.StatusBadRequest && req.Schema != nil {
+				return nil, fmt.Errorf("%w: %s", errSchemaRejected, result.Error.Message)
+			}
+			return nil, fmt.Errorf("%s API error: %s", p.cfg.Name, result.Error.Message)
+		}
+		if resp.StatusCode == http.StatusBadRequest && req.Schema != nil {
+			return nil, errSchemaRejected
+		}
+		return nil, fmt.Errorf("%s API returned %s", p.cfg.Name, resp.Status)
+	}
+	return resp, nil
+}
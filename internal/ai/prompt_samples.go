@@ -0,0 +1,100 @@
+package ai
+
+// promptSamples holds inputs shaped like the ones each prompt is rendered
+// with. An override must render against all of them before it is accepted,
+// so a template that names a missing field or misuses one fails when it is
+// saved instead of on a student's run.
+var promptSamples = map[string][]map[string]any{
+	PromptSystem: {nil},
+	PromptAnalysis: {
+		{"Code": sampleCode, "Output": "Soma: 7\n"},
+	},
+	PromptErrorAnalysis: {
+		{"Code": sampleCode, "Error": "program.c:5:5: error: expected ';' before 'return'"},
+	},
+	PromptGrading: {
+		{"Code": sampleCode, "Output": "Soma: 7\n", "ExpectedOutput": "Soma: 7", "Fence": "```"},
+	},
+	PromptExamError: {
+		{"Code": sampleCode, "Error": "program.c:5:5: error: expected ';' before 'return'", "Fence": "```"},
+	},
+	PromptExamGrading: {
+		{"MaxNote": 10.0, "Code": sampleCode, "Output": "Soma: 7\n", "ExpectedOutput": "Soma: 7", "Fence": "```"},
+	},
+	PromptRubricGrading: {
+		{
+			"Criteria": []RubricCriterion{
+				{ID: 1, Description: "Lê os dois números", Points: 4},
+				{ID: 2, Description: "Imprime a soma", Points: 6},
+			},
+			"Code":           sampleCode,
+			"Output":         "Soma: 7\n",
+			"ExpectedOutput": "Soma: 7",
+			"Fence":          "```",
+		},
+	},
+	PromptGenerateQuestions: {
+		{
+			"NumQuestions":        2,
+			"VariantsPerQuestion": 2,
+			"Difficulty":          "easy",
+			"Topic":               "laços",
+			"Targets":             []string{"for", "while"},
+			"Known":               []string{"printf", "scanf"},
+			"Avoid":               []string{"Soma de dois números"},
+		},
+		{
+			"NumQuestions":        1,
+			"VariantsPerQuestion": 1,
+			"Difficulty":          "hard",
+			"Topic":               "",
+			"Targets":             []string(nil),
+			"Known":               []string(nil),
+			"Avoid":               []string(nil),
+		},
+	},
+	PromptTutor: {
+		{
+			"ExerciseTitle":       "Soma",
+			"ExerciseDescription": "Leia dois números e imprima a soma.",
+			"Code":                sampleCode,
+			"LastOutput":          "Soma: 7\n",
+			"Turns":               []ChatTurn{{Role: "student", Content: "Por que precisa do &?"}, {Role: "tutor", Content: "Porque o scanf precisa do endereço."}},
+			"Question":            "E no printf?",
+		},
+		{
+			"ExerciseTitle":       "",
+			"ExerciseDescription": "",
+			"Code":                "",
+			"LastOutput":          "",
+			"Turns":               []ChatTurn(nil),
+			"Question":            "O que é um ponteiro?",
+		},
+	},
+	PromptHint:          hintSamples(),
+	PromptJSONRepair:    {{"Error": "score: expected number", "Previous": `{"score": "dez"}`, "Schema": `{"type":"object"}`}},
+	PromptGenerateTests: {{"Title": "Soma", "Description": "Leia dois números e imprima a soma.", "ExpectedOutput": "Soma: 7", "Count": 5}, {"Title": "Soma", "Description": "", "ExpectedOutput": "", "Count": 1}},
+}
+
+const sampleCode = `#include <stdio.h>
+
+int main() {
+    int a, b;
+    scanf("%d %d", &a, &b);
+    printf("Soma: %d\n", a + b);
+    return 0;
+}`
+
+func hintSamples() []map[string]any {
+	var samples []map[string]any
+	for level := HintConceptual; level <= HintPartialFix; level++ {
+		samples = append(samples, map[string]any{
+			"Level":               level,
+			"ExerciseTitle":       "Soma",
+			"ExerciseDescription": "Leia dois números e imprima a soma.",
+			"Code":                sampleCode,
+			"Output":              "Soma: 7\n",
+		})
+	}
+	return samples
+}
@@ -0,0 +1,332 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/vitub/CLabServer/internal/models"
+	"gorm.io/gorm"
+)
+
+// Prompt template names. Each one exists under prompts/<language>/<locale>/<name>.tmpl.
+const (
+	PromptSystem            = "system"
+	PromptAnalysis          = "analysis"
+	PromptErrorAnalysis     = "error_analysis"
+	PromptGrading           = "grading"
+	PromptExamError         = "exam_error"
+	PromptExamGrading       = "exam_grading"
+	PromptRubricGrading     = "rubric_grading"
+	PromptGenerateQuestions = "generate_questions"
+	PromptTutor             = "tutor"
+	PromptHint              = "hint"
+	PromptJSONRepair        = "json_repair"
+	PromptGenerateTests     = "generate_tests"
+)
+
+// DefaultLanguage is the programming language the prompts are written for.
+const DefaultLanguage = "c"
+
+// Locales lists the locales with a complete prompt set.
+var Locales = []string{"pt", "en", "es"}
+
+//go:embed prompts
+var promptFS embed.FS
+
+type promptKey struct {
+	name     string
+	language string
+	locale   string
+}
+
+type promptTemplate struct {
+	tmpl    *template.Template
+	body    string
+	version string
+}
+
+// PromptInfo describes the template currently used for a prompt.
+type PromptInfo struct {
+	Name       string `json:"name"`
+	Language   string `json:"language"`
+	Locale     string `json:"locale"`
+	Version    string `json:"version"`
+	Overridden bool   `json:"overridden"`
+	Body       string `json:"body"`
+}
+
+type localeKey struct{}
+
+var (
+	promptsMu       sync.RWMutex
+	builtinPrompts  = map[promptKey]*promptTemplate{}
+	promptOverrides = map[promptKey]*promptTemplate{}
+	messageSets     = map[string]*template.Template{}
+)
+
+func init() {
+	err := fs.WalkDir(promptFS, "prompts", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(p) != ".tmpl" {
+			return err
+		}
+		body, err := promptFS.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		parts := strings.Split(strings.TrimPrefix(p, "prompts/"), "/")
+		name := strings.TrimSuffix(parts[len(parts)-1], ".tmpl")
+		if parts[0] == "messages" {
+			messageSets[name] = template.Must(template.New(name).Parse(string(body)))
+			return nil
+		}
+		if len(parts) != 3 {
+			return fmt.Errorf("unexpected prompt path %s", p)
+		}
+		key := promptKey{name: name, language: parts[0], locale: parts[1]}
+		pt, err := parsePrompt(key, string(body))
+		if err != nil {
+			return err
+		}
+		builtinPrompts[key] = pt
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// promptFuncs are available to every prompt template, including overrides.
+var promptFuncs = template.FuncMap{
+	"inc":  func(i int) int { return i + 1 },
+	"join": strings.Join,
+}
+
+func parsePrompt(key promptKey, body string) (*promptTemplate, error) {
+	tmpl, err := template.New(key.name).Funcs(promptFuncs).Option("missingkey=error").Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(body))
+	return &promptTemplate{
+		tmpl:    tmpl,
+		body:    body,
+		version: fmt.Sprintf("%s.%s.%s@%s", key.language, key.locale, key.name, hex.EncodeToString(sum[:])[:8]),
+	}, nil
+}
+
+// DefaultLocale is AI_DEFAULT_LOCALE, or "pt".
+func DefaultLocale() string {
+	if l := os.Getenv("AI_DEFAULT_LOCALE"); isLocale(l) {
+		return l
+	}
+	return "pt"
+}
+
+// NormalizeLocale maps a locale such as "pt-BR" or "es_AR" to one of Locales,
+// falling back to DefaultLocale.
+func NormalizeLocale(locale string) string {
+	locale = strings.ToLower(locale)
+	if i := strings.IndexAny(locale, "-_"); i > 0 {
+		locale = locale[:i]
+	}
+	if isLocale(locale) {
+		return locale
+	}
+	return DefaultLocale()
+}
+
+func isLocale(locale string) bool {
+	for _, l := range Locales {
+		if l == locale {
+			return true
+		}
+	}
+	return false
+}
+
+// WithLocale selects the locale of the prompts and messages used under ctx.
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeKey{}, NormalizeLocale(locale))
+}
+
+// LocaleFrom returns the locale set by WithLocale, or DefaultLocale.
+func LocaleFrom(ctx context.Context) string {
+	if l, ok := ctx.Value(localeKey{}).(string); ok {
+		return l
+	}
+	return DefaultLocale()
+}
+
+// lookupPrompt returns the override or built-in template, falling back to the
+// default locale when the requested one has no such template.
+func lookupPrompt(name string, locale string) (*promptTemplate, bool) {
+	promptsMu.RLock()
+	defer promptsMu.RUnlock()
+	for _, l := range []string{NormalizeLocale(locale), DefaultLocale(), "pt"} {
+		key := promptKey{name: name, language: DefaultLanguage, locale: l}
+		if pt, ok := promptOverrides[key]; ok {
+			return pt, true
+		}
+		if pt, ok := builtinPrompts[key]; ok {
+			return pt, true
+		}
+	}
+	return nil, false
+}
+
+// renderedPrompt is a prompt ready to send, with the template and inputs it
+// was rendered from so rule-based providers such as the stub can answer
+// without parsing the text.
+type renderedPrompt struct {
+	Text    string
+	Name    string
+	Version string
+	Data    map[string]any
+}
+
+// renderPrompt executes the named template and stamps the result with the
+// version of the template used.
+func renderPrompt(name string, locale string, data map[string]any) (renderedPrompt, error) {
+	pt, ok := lookupPrompt(name, locale)
+	if !ok {
+		return renderedPrompt{}, fmt.Errorf("prompt template %q not found", name)
+	}
+	var buf bytes.Buffer
+	if err := pt.tmpl.Execute(&buf, data); err != nil {
+		return renderedPrompt{}, fmt.Errorf("error rendering prompt %s: %v", pt.version, err)
+	}
+	return renderedPrompt{Text: strings.TrimSpace(buf.String()), Name: name, Version: pt.version, Data: data}, nil
+}
+
+// PromptVersion returns the version stamp of the template used for name in locale.
+func PromptVersion(name string, locale string) string {
+	if pt, ok := lookupPrompt(name, locale); ok {
+		return pt.version
+	}
+	return ""
+}
+
+func systemPromptFor(ctx context.Context) string {
+	prompt, err := renderPrompt(PromptSystem, LocaleFrom(ctx), nil)
+	if err != nil {
+		log.Printf("Falling back to no system prompt: %v", err)
+	}
+	return prompt.Text
+}
+
+// Message renders a canned message (prompts/messages/<locale>.tmpl) shown
+// instead of an analysis, such as when the AI is unavailable.
+func Message(locale string, key string, arg any) string {
+	for _, l := range []string{NormalizeLocale(locale), "pt"} {
+		set, ok := messageSets[l]
+		if !ok || set.Lookup(key) == nil {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := set.ExecuteTemplate(&buf, key, arg); err == nil {
+			return buf.String()
+		}
+	}
+	return key
+}
+
+// ListPrompts returns every prompt with the template currently in effect.
+func ListPrompts() []PromptInfo {
+	promptsMu.RLock()
+	defer promptsMu.RUnlock()
+
+	var prompts []PromptInfo
+	for key, builtin := range builtinPrompts {
+		info := PromptInfo{Name: key.name, Language: key.language, Locale: key.locale, Version: builtin.version, Body: builtin.body}
+		if override, ok := promptOverrides[key]; ok {
+			info.Version = override.version
+			info.Body = override.body
+			info.Overridden = true
+		}
+		prompts = append(prompts, info)
+	}
+	sort.Slice(prompts, func(i, j int) bool {
+		if prompts[i].Name != prompts[j].Name {
+			return prompts[i].Name < prompts[j].Name
+		}
+		return prompts[i].Locale < prompts[j].Locale
+	})
+	return prompts
+}
+
+// SetPromptOverride validates body and makes it the template for the prompt.
+// Only prompts that exist as built-ins can be overridden, and the override
+// must render against the prompt's sample inputs.
+func SetPromptOverride(name string, language string, locale string, body string) (PromptInfo, error) {
+	key := promptKey{name: name, language: language, locale: locale}
+	pt, err := parseOverride(key, body)
+	if err != nil {
+		return PromptInfo{}, err
+	}
+
+	promptsMu.Lock()
+	promptOverrides[key] = pt
+	promptsMu.Unlock()
+	return PromptInfo{Name: name, Language: language, Locale: locale, Version: pt.version, Overridden: true, Body: body}, nil
+}
+
+func parseOverride(key promptKey, body string) (*promptTemplate, error) {
+	if _, ok := builtinPrompts[key]; !ok {
+		return nil, fmt.Errorf("unknown prompt %s/%s/%s", key.language, key.locale, key.name)
+	}
+	pt, err := parsePrompt(key, body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %v", err)
+	}
+	for _, data := range promptSamples[key.name] {
+		if err := pt.tmpl.Execute(io.Discard, data); err != nil {
+			return nil, fmt.Errorf("template fails on sample input: %v", err)
+		}
+	}
+	return pt, nil
+}
+
+// ClearPromptOverride restores the built-in template.
+func ClearPromptOverride(name string, language string, locale string) {
+	promptsMu.Lock()
+	delete(promptOverrides, promptKey{name: name, language: language, locale: locale})
+	promptsMu.Unlock()
+}
+
+// LoadPromptOverrides replaces the installed overrides with the ones stored
+// in the database. Replicas call it when another one changed an override.
+func LoadPromptOverrides(db *gorm.DB) error {
+	var rows []models.PromptOverride
+	if err := db.Find(&rows).Error; err != nil {
+		return err
+	}
+	overrides := map[promptKey]*promptTemplate{}
+	for _, row := range rows {
+		key := promptKey{name: row.Name, language: row.Language, locale: row.Locale}
+		pt, err := parseOverride(key, row.Body)
+		if err != nil {
+			log.Printf("Ignoring prompt override %d: %v", row.ID, err)
+			continue
+		}
+		overrides[key] = pt
+	}
+
+	promptsMu.Lock()
+	promptOverrides = overrides
+	promptsMu.Unlock()
+	return nil
+}
@@ -0,0 +1,62 @@
+package ai
+
+import (
+	"io"
+	"testing"
+)
+
+func TestBuiltinPromptsRenderSamples(t *testing.T) {
+	for key, pt := range builtinPrompts {
+		samples, ok := promptSamples[key.name]
+		if !ok {
+			t.Errorf("no sample input for prompt %s", key.name)
+			continue
+		}
+		for i, data := range samples {
+			if err := pt.tmpl.Execute(io.Discard, data); err != nil {
+				t.Errorf("%s sample %d: %v", pt.version, i, err)
+			}
+		}
+	}
+}
+
+func TestSetPromptOverrideRejectsTemplatesFailingOnSamples(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"missing field", "Código: {{.Codigo}}"},
+		{"wrong type", "{{range .Code}}{{.}}{{end}}"},
+		{"syntax", "{{if .Code}}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := SetPromptOverride(PromptAnalysis, DefaultLanguage, "pt", tt.body); err == nil {
+				ClearPromptOverride(PromptAnalysis, DefaultLanguage, "pt")
+				t.Errorf("override %q was accepted", tt.body)
+			}
+		})
+	}
+
+	info, err := SetPromptOverride(PromptAnalysis, DefaultLanguage, "pt", "Analise:\n{{.Code}}\n{{.Output}}")
+	if err != nil {
+		t.Fatalf("valid override rejected: %v", err)
+	}
+	defer ClearPromptOverride(PromptAnalysis, DefaultLanguage, "pt")
+	if got := PromptVersion(PromptAnalysis, "pt"); got != info.Version {
+		t.Errorf("PromptVersion = %q, want the override's %q", got, info.Version)
+	}
+}
+
+func TestMessagesDefinedInEveryLocale(t *testing.T) {
+	for _, tmpl := range messageSets["pt"].Templates() {
+		if tmpl.Name() == "pt" {
+			continue
+		}
+		for _, locale := range Locales {
+			if messageSets[locale].Lookup(tmpl.Name()) == nil {
+				t.Errorf("message %q missing for locale %s", tmpl.Name(), locale)
+			}
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Task identifies what a model call is used for, so each kind of call can be
+// routed to its own provider, model, token budget and timeout.
+type Task string
+
+const (
+	TaskAnalysis   Task = "ANALYSIS"
+	TaskGrading    Task = "GRADING"
+	TaskGeneration Task = "GENERATION"
+)
+
+// Request is a single prompt sent to a Provider.
+type Request struct {
+	System      string
+	Prompt      string
+	Temperature float64
+	// JSON asks the backend to constrain its output to a JSON object.
+	JSON bool
+	// Schema, when set with JSON, asks the backend to follow this JSON schema.
+	Schema *Schema
+	// Template and Data are the prompt template name and the inputs Prompt was
+	// rendered from. Rule-based providers answer from them instead of the text.
+	Template string
+	Data     map[string]any
+}
+
+// Provider is a text-generation backend.
+type Provider interface {
+	// Complete returns the full response text.
+	Complete(ctx context.Context, req Request) (string, error)
+	// CompleteJSON requests JSON output and decodes it into v.
+	CompleteJSON(ctx context.Context, req Request, v any) error
+	// Stream calls onChunk for every token chunk as it arrives and returns the assembled text.
+	Stream(ctx context.Context, req Request, onChunk func(string)) (string, error)
+}
+
+// ProviderConfig describes how to reach a backend for one task.
+type ProviderConfig struct {
+	Name      string
+	BaseURL   string
+	APIKey    string
+	Model     string
+	MaxTokens int
+	Timeout   time.Duration
+}
+
+// ProviderName returns the provider configured for the task through
+// AI_<TASK>_PROVIDER, falling back to AI_PROVIDER and then "ollama".
+func ProviderName(task Task) string {
+	if name := taskEnv(task, "PROVIDER"); name != "" {
+		return name
+	}
+	if name := os.Getenv("AI_PROVIDER"); name != "" {
+		return name
+	}
+	return "ollama"
+}
+
+// LoadProviderConfig builds the configuration of the named provider for a task.
+// An empty name selects ProviderName(task). Per-task variables
+// (AI_<TASK>_BASE_URL, _MODEL, _API_KEY, _MAX_TOKENS, _TIMEOUT) override the
+// provider-wide ones, and per-task, per-provider variables
+// (AI_<TASK>_<PROVIDER>_MODEL, ...) override both. The per-task base URL,
+// model and API key describe the task's configured provider, so they are
+// ignored when another provider is named.
+func LoadProviderConfig(task Task, name string) ProviderConfig {
+	taskProvider := ProviderName(task)
+	if name == "" {
+		name = taskProvider
+	}
+	setting := func(key string) string {
+		if v := taskEnv(task, strings.ToUpper(name)+"_"+key); v != "" {
+			return v
+		}
+		if name != taskProvider && (key == "BASE_URL" || key == "MODEL" || key == "API_KEY") {
+			return ""
+		}
+		return taskEnv(task, key)
+	}
+
+	cfg := ProviderConfig{Name: name, MaxTokens: 2048, Timeout: 2 * time.Minute}
+	if task == TaskGeneration {
+		cfg.MaxTokens = 4096
+		cfg.Timeout = 5 * time.Minute
+	}
+
+	switch name {
+	case "ollama":
+		cfg.BaseURL = envOr("OLLAMA_URL", "http://localhost:11434")
+		cfg.Model = envOr("OLLAMA_MODEL", "llama3.2:1b")
+	case "groq":
+		cfg.BaseURL = "https://api.groq.com/openai/v1"
+		cfg.APIKey = os.Getenv("GROQ_API_KEY")
+		cfg.Model = envOr("GROQ_MODEL", "llama-3.1-8b-instant")
+	case "openai":
+		cfg.BaseURL = envOr("OPENAI_BASE_URL", "http://localhost:8000/v1")
+		cfg.APIKey = os.Getenv("OPENAI_API_KEY")
+		cfg.Model = os.Getenv("OPENAI_MODEL")
+	case "stub":
+		cfg.Model = "rules"
+	}
+
+	if v := setting("BASE_URL"); v != "" {
+		cfg.BaseURL = v
+	}
+	if v := setting("MODEL"); v != "" {
+		cfg.Model = v
+	}
+	if v := setting("API_KEY"); v != "" {
+		cfg.APIKey = v
+	}
+	if n, err := strconv.Atoi(setting("MAX_TOKENS")); err == nil && n > 0 {
+		cfg.MaxTokens = n
+	}
+	if d := parseTimeout(setting("TIMEOUT")); d > 0 {
+		cfg.Timeout = d
+	}
+
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	return cfg
+}
+
+// NewProvider returns the Provider implementation for cfg.Name.
+// "groq" and "openai" both use the OpenAI-compatible chat completions API,
+// which also covers vLLM, LM Studio and the llama.cpp server.
+func NewProvider(cfg ProviderConfig) (Provider, error) {
+	switch cfg.Name {
+	case "ollama":
+		return &OllamaProvider{cfg: cfg}, nil
+	case "groq", "openai":
+		if cfg.Name == "groq" && cfg.APIKey == "" {
+			return nil, fmt.Errorf("GROQ_API_KEY not set")
+		}
+		return &OpenAIProvider{cfg: cfg}, nil
+	case "stub":
+		return &StubProvider{cfg: cfg}, nil
+	default:
+		return nil, fmt.Errorf("unknown AI provider %q", cfg.Name)
+	}
+}
+
+// ProviderFor returns the provider configured for the task.
+func ProviderFor(task Task) (Provider, error) {
+	return NewProvider(LoadProviderConfig(task, ""))
+}
+
+// completeAI sends a prompt through the usage hooks: the caller's quota is
+// checked before the call and the call is recorded afterwards.
+func completeAI(ctx context.Context, providerName string, task Task, prompt renderedPrompt) (string, error) {
+	response, _, err := complete(ctx, providerName, task, prompt, Request{})
+	return response, err
+}
+
+// complete is completeAI with extra request options. It reports whether the
+// response came from the fallback provider, so it is not cached in place of
+// a real answer.
+func complete(ctx context.Context, providerName string, task Task, prompt renderedPrompt, opts Request) (string, bool, error) {
+	cfg := LoadProviderConfig(task, providerName)
+	provider, err := NewProvider(cfg)
+	if err != nil {
+		return fallbackComplete(ctx, task, prompt, opts, err)
+	}
+	if err := checkUsage(ctx, task); err != nil {
+		return "", false, err
+	}
+
+	req := newRequest(ctx, prompt, opts)
+	start := time.Now()
+	response, err := provider.Complete(ctx, req)
+	recordUsage(ctx, cfg, task, prompt.Text, response, start, err)
+	if err != nil && ctx.Err() == nil {
+		return fallbackComplete(ctx, task, prompt, opts, err)
+	}
+	return response, false, err
+}
+
+func streamAI(ctx context.Context, task Task, prompt renderedPrompt, onChunk func(string)) (string, error) {
+	response, _, err := stream(ctx, task, prompt, onChunk)
+	return response, err
+}
+
+// stream is streamAI reporting whether the fallback provider answered. The
+// fallback only takes over if the real provider failed before sending anything.
+func stream(ctx context.Context, task Task, prompt renderedPrompt, onChunk func(string)) (string, bool, error) {
+	cfg := LoadProviderConfig(task, "")
+	provider, err := NewProvider(cfg)
+	if err != nil {
+		return fallbackStream(ctx, task, prompt, onChunk, err)
+	}
+	if err := checkUsage(ctx, task); err != nil {
+		return "", false, err
+	}
+
+	sent := false
+	start := time.Now()
+	response, err := provider.Stream(ctx, newRequest(ctx, prompt, Request{}), func(chunk string) {
+		sent = true
+		onChunk(chunk)
+	})
+	recordUsage(ctx, cfg, task, prompt.Text, response, start, err)
+	if err != nil && !sent && ctx.Err() == nil {
+		return fallbackStream(ctx, task, prompt, onChunk, err)
+	}
+	return response, false, err
+}
+
+func newRequest(ctx context.Context, prompt renderedPrompt, opts Request) Request {
+	opts.System = systemPromptFor(ctx)
+	opts.Prompt = prompt.Text
+	opts.Template = prompt.Name
+	opts.Data = prompt.Data
+	opts.Temperature = 0.3
+	return opts
+}
+
+func decodeJSONResponse(text string, v any) error {
+	if err := json.Unmarshal([]byte(removeMarkdown(text)), v); err != nil {
+		return fmt.Errorf("invalid JSON response: %v", err)
+	}
+	return nil
+}
+
+func taskEnv(task Task, key string) string {
+	return os.Getenv("AI_" + string(task) + "_" + key)
+}
+
+func envOr(key string, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// parseTimeout accepts a Go duration ("90s") or a plain number of seconds.
+func parseTimeout(s string) time.Duration {
+	if s == "" {
+		return 0
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return d
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		return time.Duration(n) * time.Second
+	}
+	return 0
+}
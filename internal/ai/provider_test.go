@@ -0,0 +1,134 @@
+package ai_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vitub/CLabServer/internal/ai"
+	"github.com/vitub/CLabServer/internal/ai/aitest"
+)
+
+var providers = []string{"ollama", "openai"}
+
+func newProvider(t *testing.T, srv *aitest.Server, name string) ai.Provider {
+	t.Helper()
+	provider, err := ai.NewProvider(srv.Config(name))
+	if err != nil {
+		t.Fatalf("NewProvider(%s): %v", name, err)
+	}
+	return provider
+}
+
+func TestComplete(t *testing.T) {
+	for _, name := range providers {
+		t.Run(name, func(t *testing.T) {
+			srv := aitest.NewServer(func(prompt string) string { return "resposta para " + prompt })
+			defer srv.Close()
+
+			got, err := newProvider(t, srv, name).Complete(context.Background(), ai.Request{System: "sistema", Prompt: "olá"})
+			if err != nil {
+				t.Fatalf("Complete: %v", err)
+			}
+			if got != "resposta para olá" {
+				t.Errorf("Complete = %q, want %q", got, "resposta para olá")
+			}
+			if prompts := srv.Prompts(); !reflect.DeepEqual(prompts, []string{"olá"}) {
+				t.Errorf("server received %q, want the user prompt only", prompts)
+			}
+			if formats := srv.Formats(); !reflect.DeepEqual(formats, []string{""}) {
+				t.Errorf("formats = %q, want a plain text request", formats)
+			}
+		})
+	}
+}
+
+func TestStream(t *testing.T) {
+	const reply = "o laço nunca termina porque i não muda"
+	for _, name := range providers {
+		t.Run(name, func(t *testing.T) {
+			srv := aitest.NewServer(func(string) string { return reply })
+			defer srv.Close()
+
+			var chunks []string
+			got, err := newProvider(t, srv, name).Stream(context.Background(), ai.Request{Prompt: "analise"}, func(chunk string) {
+				chunks = append(chunks, chunk)
+			})
+			if err != nil {
+				t.Fatalf("Stream: %v", err)
+			}
+			if got != reply {
+				t.Errorf("Stream = %q, want %q", got, reply)
+			}
+			if len(chunks) < 2 {
+				t.Errorf("got %d chunks, want the reply streamed in pieces", len(chunks))
+			}
+			if joined := strings.Join(chunks, ""); joined != reply {
+				t.Errorf("chunks join to %q, want %q", joined, reply)
+			}
+		})
+	}
+}
+
+func TestCompleteJSON(t *testing.T) {
+	schema := ai.ObjectSchema(map[string]*ai.Schema{
+		"score":    {Type: "integer"},
+		"feedback": {Type: "string"},
+	})
+	tests := []struct {
+		name   string
+		schema *ai.Schema
+		want   map[string][]string // provider -> formats requested
+	}{
+		{"json mode", nil, map[string][]string{"ollama": {"json"}, "openai": {"json_object"}}},
+		{"json schema", schema, map[string][]string{"ollama": {"schema"}, "openai": {"json_schema"}}},
+	}
+	for _, tt := range tests {
+		for _, name := range providers {
+			t.Run(tt.name+"/"+name, func(t *testing.T) {
+				srv := aitest.NewServer(func(string) string {
+					return "```json\n{\"score\": 7, \"feedback\": \"bom\"}\n```"
+				})
+				defer srv.Close()
+
+				var got struct {
+					Score    int    `json:"score"`
+					Feedback string `json:"feedback"`
+				}
+				err := newProvider(t, srv, name).CompleteJSON(context.Background(), ai.Request{Prompt: "corrija", Schema: tt.schema}, &got)
+				if err != nil {
+					t.Fatalf("CompleteJSON: %v", err)
+				}
+				if got.Score != 7 || got.Feedback != "bom" {
+					t.Errorf("CompleteJSON decoded %+v", got)
+				}
+				if formats := srv.Formats(); !reflect.DeepEqual(formats, tt.want[name]) {
+					t.Errorf("formats = %q, want %q", formats, tt.want[name])
+				}
+			})
+		}
+	}
+}
+
+func TestCompleteJSONSchemaRejected(t *testing.T) {
+	srv := aitest.NewServer(func(string) string { return `{"score": 3}` })
+	srv.RejectSchema = true
+	defer srv.Close()
+
+	schema := ai.ObjectSchema(map[string]*ai.Schema{"score": {Type: "integer"}})
+	var got struct {
+		Score int `json:"score"`
+	}
+	err := newProvider(t, srv, "openai").CompleteJSON(context.Background(), ai.Request{Prompt: "corrija", Schema: schema}, &got)
+	if err != nil {
+		t.Fatalf("CompleteJSON: %v", err)
+	}
+	if got.Score != 3 {
+		t.Errorf("score = %d, want 3", got.Score)
+	}
+	want := []string{"json_schema", "json_object"}
+	if formats := srv.Formats(); !reflect.DeepEqual(formats, want) {
+		t.Errorf("formats = %q, want a retry in JSON mode %q", formats, want)
+	}
+}
@@ -0,0 +1,118 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+)
+
+type RubricCriterion struct {
+	ID          uint
+	Description string
+	Points      float64
+}
+
+type CriterionScore struct {
+	CriterionID   uint    `json:"id"`
+	Criterion     string  `json:"criterion"`
+	Score         float64 `json:"score"`
+	MaxPoints     float64 `json:"maxPoints"`
+	Justification string  `json:"justification"`
+}
+
+type RubricGradingResult struct {
+	Criteria      []CriterionScore `json:"criteria"`
+	Score         float64          `json:"score"`
+	Feedback      string           `json:"feedback"`
+	PromptVersion string           `json:"-"`
+	Detections    []Detection      `json:"-"`
+	// OutOfRange is set when any criterion score had to be clamped to its points.
+	OutOfRange bool `json:"-"`
+}
+
+// GetRubricGradingAnalysis asks the model to score each criterion separately.
+// The total is computed here from the clamped criterion scores, never taken from the model,
+// and a response that skips a criterion is sent back for repair.
+func GetRubricGradingAnalysis(code string, output string, expectedOutput string, rubric []RubricCriterion) (RubricGradingResult, error) {
+	return GetRubricGradingAnalysisFrom("", code, output, expectedOutput, rubric)
+}
+
+// GetRubricGradingAnalysisFrom is GetRubricGradingAnalysis against an explicit provider.
+func GetRubricGradingAnalysisFrom(provider string, code string, output string, expectedOutput string, rubric []RubricCriterion) (RubricGradingResult, error) {
+	in := prepareGradingInput(code, output, SourceOutput)
+	prompt, err := renderPrompt(PromptRubricGrading, DefaultLocale(), map[string]any{
+		"Criteria":       rubric,
+		"Code":           in.Code,
+		"Output":         in.Output,
+		"ExpectedOutput": expectedOutput,
+		"Fence":          in.Fence,
+	})
+	if err != nil {
+		return RubricGradingResult{}, err
+	}
+
+	var raw struct {
+		Criteria []struct {
+			ID            uint    `json:"id"`
+			Score         float64 `json:"score"`
+			Justification string  `json:"justification"`
+		} `json:"criteria"`
+		Feedback string `json:"feedback"`
+	}
+	// Every criterion must be scored exactly once
+	check := func() error {
+		seen := make(map[uint]bool)
+		for _, c := range raw.Criteria {
+			seen[c.ID] = true
+		}
+		var problems []string
+		for _, c := range rubric {
+			if !seen[c.ID] {
+				problems = append(problems, fmt.Sprintf("criterion %d was not scored", c.ID))
+			}
+		}
+		if len(raw.Criteria) != len(rubric) {
+			problems = append(problems, fmt.Sprintf("expected %d criteria, got %d", len(rubric), len(raw.Criteria)))
+		}
+		return joinErrors(problems)
+	}
+	if err := completeStructured(context.Background(), provider, TaskGrading, prompt, rubricGradingSchema(rubric), &raw, check); err != nil {
+		return RubricGradingResult{}, err
+	}
+
+	scored := make(map[uint]CriterionScore)
+	for _, c := range raw.Criteria {
+		scored[c.ID] = CriterionScore{Score: c.Score, Justification: c.Justification}
+	}
+
+	result := RubricGradingResult{Feedback: raw.Feedback, PromptVersion: prompt.Version, Detections: in.Detections}
+	for _, c := range rubric {
+		s := scored[c.ID]
+		s.CriterionID = c.ID
+		s.Criterion = c.Description
+		s.MaxPoints = c.Points
+		var clamped bool
+		s.Score, clamped = clampFlag(s.Score, 0, c.Points)
+		result.OutOfRange = result.OutOfRange || clamped
+		result.Criteria = append(result.Criteria, s)
+		result.Score += s.Score
+	}
+
+	return result, nil
+}
+
+func rubricGradingSchema(rubric []RubricCriterion) *Schema {
+	var highest float64
+	for _, c := range rubric {
+		if c.Points > highest {
+			highest = c.Points
+		}
+	}
+	return ObjectSchema(map[string]*Schema{
+		"criteria": {Type: "array", Items: ObjectSchema(map[string]*Schema{
+			"id":            {Type: "integer"},
+			"score":         NumberSchema(0, highest),
+			"justification": {Type: "string"},
+		})},
+		"feedback": {Type: "string"},
+	})
+}
@@ -0,0 +1,50 @@
+package ai
+
+import "strings"
+
+// DuplicateThreshold is the Similarity at or above which a generated exercise
+// is considered a repeat of an existing one.
+var DuplicateThreshold = 0.5
+
+var accentReplacer = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ã", "a", "é", "e", "ê", "e", "í", "i",
+	"ó", "o", "ô", "o", "õ", "o", "ú", "u", "ü", "u", "ç", "c", "ñ", "n",
+)
+
+// Words too common in exercise statements to tell two exercises apart.
+var similarityStopwords = map[string]bool{
+	"que": true, "uma": true, "dos": true, "das": true, "para": true, "com": true,
+	"programa": true, "escreva": true, "faca": true, "imprima": true, "numero": true,
+	"the": true, "and": true, "that": true, "write": true, "program": true, "print": true,
+	"una": true, "los": true, "las": true, "escribe": true, "imprime": true,
+}
+
+// Similarity is the Jaccard index of the significant words of two texts,
+// ignoring case, accents and punctuation: 1 for the same words, 0 for none shared.
+func Similarity(a string, b string) float64 {
+	wa, wb := wordSet(a), wordSet(b)
+	if len(wa) == 0 || len(wb) == 0 {
+		return 0
+	}
+	shared := 0
+	for w := range wa {
+		if wb[w] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(wa)+len(wb)-shared)
+}
+
+func wordSet(text string) map[string]bool {
+	text = accentReplacer.Replace(strings.ToLower(text))
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	})
+	set := make(map[string]bool, len(words))
+	for _, w := range words {
+		if len(w) >= 3 && !similarityStopwords[w] {
+			set[w] = true
+		}
+	}
+	return set
+}
@@ -0,0 +1,187 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidOutput is returned when the model keeps answering with JSON that
+// does not match the requested schema after every repair attempt.
+var ErrInvalidOutput = errors.New("AI returned invalid structured output")
+
+// Schema is the subset of JSON Schema sent to providers that support
+// constrained decoding (Ollama "format", OpenAI "response_format") and used to
+// validate the response.
+type Schema struct {
+	Type                 string             `json:"type"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+}
+
+// ObjectSchema describes an object whose properties are all required.
+func ObjectSchema(properties map[string]*Schema) *Schema {
+	required := make([]string, 0, len(properties))
+	for name := range properties {
+		required = append(required, name)
+	}
+	sort.Strings(required)
+	closed := false
+	return &Schema{Type: "object", Properties: properties, Required: required, AdditionalProperties: &closed}
+}
+
+// NumberSchema describes a number in [min, max].
+func NumberSchema(min float64, max float64) *Schema {
+	return &Schema{Type: "number", Minimum: &min, Maximum: &max}
+}
+
+// Validate checks a decoded JSON value against the schema. Minimum and Maximum
+// are not enforced here: out-of-range numbers are clamped and flagged by the
+// caller, which knows what the bounds mean.
+func (s *Schema) Validate(value any) error {
+	return s.validate("$", value)
+}
+
+func (s *Schema) validate(path string, value any) error {
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expected object", path)
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s.%s: missing required field", path, name)
+			}
+		}
+		for name, v := range obj {
+			prop, ok := s.Properties[name]
+			if !ok {
+				continue
+			}
+			if err := prop.validate(path+"."+name, v); err != nil {
+				return err
+			}
+		}
+	case "array":
+		arr, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s: expected array", path)
+		}
+		if s.Items != nil {
+			for i, v := range arr {
+				if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), v); err != nil {
+					return err
+				}
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s: expected string", path)
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%s: expected number", path)
+		}
+	case "integer":
+		f, ok := value.(float64)
+		if !ok || f != float64(int64(f)) {
+			return fmt.Errorf("%s: expected integer", path)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: expected boolean", path)
+		}
+	}
+	return nil
+}
+
+// repairRetries is AI_JSON_REPAIR_RETRIES (default 2): how many times an
+// invalid response is sent back to the model with the validation error.
+func repairRetries() int {
+	if n, err := strconv.Atoi(os.Getenv("AI_JSON_REPAIR_RETRIES")); err == nil && n >= 0 {
+		return n
+	}
+	return 2
+}
+
+// completeStructured asks for JSON matching schema and decodes it into v. A
+// response that is not valid JSON, does not match the schema or fails check is
+// sent back with a repair prompt; once the retries run out the last validation
+// error is returned wrapped in ErrInvalidOutput. check may be nil.
+func completeStructured(ctx context.Context, providerName string, task Task, prompt renderedPrompt, schema *Schema, v any, check func() error) error {
+	current := prompt
+	var lastErr error
+	for attempt := 0; attempt <= repairRetries(); attempt++ {
+		response, _, err := complete(ctx, providerName, task, current, Request{JSON: true, Schema: schema})
+		if err != nil {
+			return err
+		}
+
+		if lastErr = decodeStructured(response, schema, v, check); lastErr == nil {
+			return nil
+		}
+
+		repair, err := renderPrompt(PromptJSONRepair, LocaleFrom(ctx), map[string]any{
+			"Error":    lastErr.Error(),
+			"Previous": response,
+			"Schema":   schemaJSON(schema),
+		})
+		if err != nil {
+			return err
+		}
+		current.Text = prompt.Text + "\n\n" + repair.Text
+	}
+	return fmt.Errorf("%w: %v", ErrInvalidOutput, lastErr)
+}
+
+func decodeStructured(response string, schema *Schema, v any, check func() error) error {
+	text := removeMarkdown(response)
+	var raw any
+	if err := json.Unmarshal([]byte(text), &raw); err != nil {
+		return fmt.Errorf("invalid JSON: %v", err)
+	}
+	if err := schema.Validate(raw); err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(text), v); err != nil {
+		return fmt.Errorf("invalid JSON: %v", err)
+	}
+	if check != nil {
+		return check()
+	}
+	return nil
+}
+
+func schemaJSON(schema *Schema) string {
+	data, _ := json.Marshal(schema)
+	return string(data)
+}
+
+// clampFlag limits value to [min, max] and reports whether it had to.
+func clampFlag(value float64, min float64, max float64) (float64, bool) {
+	switch {
+	case value < min:
+		return min, true
+	case value > max:
+		return max, true
+	}
+	return value, false
+}
+
+// joinErrors formats validation problems found after decoding.
+func joinErrors(problems []string) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
@@ -0,0 +1,454 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// StubProvider answers from rules and canned Portuguese text instead of a
+// model. It is deterministic and needs no network, so it works in tests and on
+// offline lab networks, and it answers in place of the configured provider
+// when that one fails (see AI_FALLBACK).
+type StubProvider struct {
+	cfg ProviderConfig
+}
+
+func (p *StubProvider) Complete(ctx context.Context, req Request) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	data := req.Data
+	switch req.Template {
+	case PromptAnalysis:
+		return stubAnalysis(dataString(data, "Code"), dataString(data, "Output")), nil
+	case PromptErrorAnalysis:
+		return stubErrorAnalysis(dataString(data, "Error")), nil
+	case PromptHint:
+		level, _ := data["Level"].(int)
+		return stubHint(level, dataString(data, "Output")), nil
+	case PromptTutor:
+		return stubTutor(dataString(data, "LastOutput")), nil
+	case PromptGrading:
+		return stubJSON(stubGrading(data)), nil
+	case PromptExamGrading:
+		return stubJSON(stubExamGrading(data)), nil
+	case PromptExamError:
+		rule := matchErrorRule(dataString(data, "Error"))
+		return stubJSON(map[string]any{"score": 0, "feedback": rule.Error + " " + rule.Cause}), nil
+	case PromptRubricGrading:
+		return stubJSON(stubRubricGrading(data)), nil
+	case PromptGenerateTests:
+		return stubJSON(stubTestCases(data)), nil
+	case PromptGenerateQuestions:
+		return stubJSON(stubQuestions(data)), nil
+	}
+	return "", fmt.Errorf("stub provider has no rule for prompt %q", req.Template)
+}
+
+func (p *StubProvider) CompleteJSON(ctx context.Context, req Request, v any) error {
+	text, err := p.Complete(ctx, req)
+	if err != nil {
+		return err
+	}
+	return decodeJSONResponse(text, v)
+}
+
+// Stream delivers the Complete response word by word.
+func (p *StubProvider) Stream(ctx context.Context, req Request, onChunk func(string)) (string, error) {
+	text, err := p.Complete(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	for _, chunk := range strings.SplitAfter(text, " ") {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		if chunk != "" {
+			onChunk(chunk)
+		}
+	}
+	return text, nil
+}
+
+// fallbackEnabled reports whether the stub answers when the provider for the
+// task fails. AI_FALLBACK=off disables it. Grading and generation never fall
+// back: a rule-based grade must not silently replace the model's, and canned
+// questions or test inputs would be saved as if the model had written them.
+func fallbackEnabled(task Task) bool {
+	return task != TaskGrading && task != TaskGeneration && envOr("AI_FALLBACK", "stub") == "stub"
+}
+
+func fallbackComplete(ctx context.Context, task Task, prompt renderedPrompt, opts Request, cause error) (string, bool, error) {
+	if !fallbackEnabled(task) {
+		return "", false, cause
+	}
+	log.Printf("AI provider failed (%v), answering %s with the stub provider", cause, prompt.Name)
+	response, err := (&StubProvider{}).Complete(ctx, newRequest(ctx, prompt, opts))
+	if err != nil {
+		return "", false, cause
+	}
+	return response, true, nil
+}
+
+func fallbackStream(ctx context.Context, task Task, prompt renderedPrompt, onChunk func(string), cause error) (string, bool, error) {
+	if !fallbackEnabled(task) {
+		return "", false, cause
+	}
+	log.Printf("AI provider failed (%v), answering %s with the stub provider", cause, prompt.Name)
+	response, err := (&StubProvider{}).Stream(ctx, newRequest(ctx, prompt, Request{}), onChunk)
+	if err != nil {
+		return "", false, cause
+	}
+	return response, true, nil
+}
+
+// errorRule maps a compiler or runtime message to a canned explanation.
+type errorRule struct {
+	pattern *regexp.Regexp
+	Error   string
+	Cause   string
+	Fix     string
+	Concept string
+	Tip     string
+}
+
+// errorRules are tried in order; the last one matches anything.
+var errorRules = []errorRule{
+	{
+		pattern: regexp.MustCompile(`expected ['‘"]?;['’"]?`),
+		Error:   "Falta um ponto e vírgula (`;`).",
+		Cause:   "Em C toda instrução termina com `;`. O compilador chegou à próxima instrução sem encontrar o fim da anterior.",
+		Fix:     "Olhe o fim da linha indicada e da linha anterior a ela e veja qual instrução não foi terminada.",
+		Concept: "Instruções e declarações em C são separadas por `;`; quebras de linha não têm significado para o compilador.",
+		Tip:     "Ao terminar de digitar uma instrução, confira o `;` antes de passar para a próxima linha.",
+	},
+	{
+		pattern: regexp.MustCompile(`['‘"]?(\w+)['’"]? undeclared`),
+		Error:   "Uma variável foi usada sem ter sido declarada.",
+		Cause:   "O nome usado não existe no escopo atual: ou a declaração está faltando, ou o nome foi digitado diferente (C diferencia maiúsculas de minúsculas).",
+		Fix:     "Declare a variável com seu tipo antes do primeiro uso, ou corrija a grafia para o nome já declarado.",
+		Concept: "Em C toda variável precisa ser declarada com um tipo (`int x;`) antes de ser usada, e só existe dentro do bloco `{}` onde foi declarada.",
+		Tip:     "Use nomes consistentes e declare as variáveis no início do bloco onde serão usadas.",
+	},
+	{
+		pattern: regexp.MustCompile(`implicit declaration of function`),
+		Error:   "Uma função foi chamada sem ter sido declarada.",
+		Cause:   "Falta o `#include` da biblioteca que define a função (por exemplo `<stdio.h>` para `printf`/`scanf`, `<math.h>` para `sqrt`/`pow`, `<stdlib.h>` para `malloc`, `<string.h>` para `strlen`), ou o nome está digitado errado, ou a função foi definida depois de `main` sem protótipo.",
+		Fix:     "Confira a grafia do nome, inclua o cabeçalho correto ou declare o protótipo da sua função antes de `main`.",
+		Concept: "O compilador lê o arquivo de cima para baixo e precisa conhecer a assinatura de uma função antes da primeira chamada.",
+		Tip:     "Mantenha os `#include` no topo do arquivo e os protótipos das suas funções logo abaixo deles.",
+	},
+	{
+		pattern: regexp.MustCompile(`expected declaration or statement at end of input`),
+		Error:   "Falta fechar uma chave (`}`).",
+		Cause:   "O arquivo terminou com algum bloco ainda aberto, geralmente de uma função, `if` ou laço.",
+		Fix:     "Conte as chaves abertas e fechadas e descubra qual bloco não foi fechado.",
+		Concept: "Blocos em C são delimitados por `{` e `}`, e cada chave aberta precisa ser fechada.",
+		Tip:     "Indente o código: blocos mal fechados ficam visíveis quando a indentação não volta para a margem.",
+	},
+	{
+		pattern: regexp.MustCompile(`expected ['‘"]?\)['’"]?`),
+		Error:   "Falta fechar um parêntese.",
+		Cause:   "Uma chamada de função ou condição foi aberta com `(` e não foi fechada, ou há um separador faltando entre argumentos.",
+		Fix:     "Confira os parênteses e as vírgulas da expressão na linha indicada.",
+		Concept: "Chamadas de função e condições de `if`/`while`/`for` exigem parênteses balanceados.",
+		Tip:     "Ao abrir um parêntese, feche-o logo em seguida e escreva o conteúdo depois.",
+	},
+	{
+		pattern: regexp.MustCompile(`missing terminating ['‘"]?["']['’"]? character`),
+		Error:   "Uma string ou caractere não foi fechado.",
+		Cause:   "Faltam as aspas de fechamento em um texto entre aspas.",
+		Fix:     "Feche a string com `\"` (ou o caractere com `'`) na mesma linha.",
+		Concept: "Strings em C ficam entre aspas duplas e não podem atravessar linhas sem `\\n` ou concatenação.",
+		Tip:     "Use `\\n` dentro da string para quebrar linhas na saída.",
+	},
+	{
+		pattern: regexp.MustCompile(`stray ['‘"]?\\\d+['’"]? in program`),
+		Error:   "Há um caractere inválido no código.",
+		Cause:   "Normalmente são aspas tipográficas (“ ” ‘ ’) ou espaços especiais copiados de um documento ou página web.",
+		Fix:     "Redigite as aspas e os espaços da linha indicada diretamente no editor.",
+		Concept: "O código C só aceita aspas retas (`\"` e `'`) e caracteres ASCII fora de strings e comentários.",
+		Tip:     "Evite copiar código de PDFs ou editores de texto formatado.",
+	},
+	{
+		pattern: regexp.MustCompile(`format ['‘"]?%\w+['’"]? expects argument of type ['‘"]?\w+ \*`),
+		Error:   "O `scanf` recebeu um valor em vez de um endereço.",
+		Cause:   "O `scanf` precisa saber onde guardar o valor lido, então espera um ponteiro para a variável.",
+		Fix:     "Passe o endereço da variável ao `scanf` usando o operador `&`.",
+		Concept: "O operador `&` obtém o endereço de memória de uma variável; funções que alteram argumentos recebem endereços.",
+		Tip:     "Com `scanf`, use `&` antes de variáveis simples (`int`, `float`, `char`), mas não antes de vetores de `char`.",
+	},
+	{
+		pattern: regexp.MustCompile(`format ['‘"]?%\w+['’"]? expects`),
+		Error:   "O especificador de formato não corresponde ao tipo do argumento.",
+		Cause:   "O `%` usado no `printf`/`scanf` espera um tipo diferente do valor passado.",
+		Fix:     "Use `%d` para `int`, `%f` para `float`, `%lf` para `double` no `scanf`, `%c` para `char` e `%s` para strings.",
+		Concept: "As funções de formatação confiam no especificador para interpretar os bytes do argumento.",
+		Tip:     "Sempre compile com `-Wall` e leia os avisos de formato.",
+	},
+	{
+		pattern: regexp.MustCompile(`too (few|many) arguments to function`),
+		Error:   "Uma função foi chamada com o número errado de argumentos.",
+		Cause:   "A quantidade de argumentos da chamada não corresponde aos parâmetros da declaração.",
+		Fix:     "Compare a chamada com a assinatura da função e ajuste os argumentos.",
+		Concept: "Em C a chamada deve fornecer exatamente um argumento para cada parâmetro declarado.",
+		Tip:     "Mantenha o protótipo da função à vista ao escrever as chamadas.",
+	},
+	{
+		pattern: regexp.MustCompile(`lvalue required`),
+		Error:   "Tentativa de atribuir valor a algo que não é uma variável.",
+		Cause:   "O lado esquerdo de `=` precisa ser uma variável; muitas vezes `=` foi usado no lugar de `==` ou a expressão está invertida.",
+		Fix:     "Verifique se a intenção era comparar (`==`) ou se os lados da atribuição estão trocados.",
+		Concept: "Só é possível atribuir a posições de memória nomeadas (lvalues), como variáveis e elementos de vetor.",
+		Tip:     "Em condições, escreva a constante à esquerda (`0 == x`) para o compilador acusar um `=` acidental.",
+	},
+	{
+		pattern: regexp.MustCompile(`undefined reference to`),
+		Error:   "O programa referencia uma função que não foi encontrada na ligação.",
+		Cause:   "A função foi declarada ou chamada, mas não há definição dela; também acontece quando `main` está com o nome errado.",
+		Fix:     "Confira se a função foi definida com o mesmo nome da chamada e se existe uma função `main`.",
+		Concept: "Declarar uma função só informa sua assinatura; o corpo precisa ser definido em algum lugar do programa.",
+		Tip:     "Ao criar um protótipo, escreva logo a definição correspondente.",
+	},
+	{
+		pattern: regexp.MustCompile(`(?i)segmentation fault|SIGSEGV`),
+		Error:   "O programa acessou memória inválida (segmentation fault).",
+		Cause:   "Causas comuns: índice fora dos limites de um vetor, ponteiro não inicializado ou nulo, ou `scanf` sem `&`.",
+		Fix:     "Verifique os limites dos laços que percorrem vetores e se todo ponteiro aponta para memória válida antes de usá-lo.",
+		Concept: "Um vetor de N elementos tem índices de 0 a N-1; acessar fora disso é comportamento indefinido.",
+		Tip:     "Imprima os índices dentro do laço para descobrir onde o acesso sai dos limites.",
+	},
+	{
+		pattern: regexp.MustCompile(`(?i)floating point exception|SIGFPE`),
+		Error:   "O programa fez uma divisão por zero.",
+		Cause:   "Uma divisão ou resto (`/`, `%`) entre inteiros teve divisor igual a zero.",
+		Fix:     "Verifique o divisor antes da operação e trate o caso zero.",
+		Concept: "Divisão inteira por zero interrompe o programa em C.",
+		Tip:     "Teste seu programa com entradas zero e negativas.",
+	},
+	{
+		pattern: regexp.MustCompile(`(?s).*`),
+		Error:   "O compilador encontrou um problema no código.",
+		Cause:   "A mensagem do compilador acima indica o arquivo, a linha e a coluna onde o problema foi detectado.",
+		Fix:     "Leia a primeira mensagem de erro: as seguintes costumam ser consequência dela. Corrija-a e compile novamente.",
+		Concept: "O compilador verifica a sintaxe e os tipos antes de gerar o programa; qualquer erro impede a execução.",
+		Tip:     "Compile com frequência, a cada pequena alteração, para localizar erros rapidamente.",
+	},
+}
+
+var errorLocation = regexp.MustCompile(`:(\d+):\d+: (?:fatal )?error:`)
+
+func matchErrorRule(message string) errorRule {
+	for _, rule := range errorRules {
+		if rule.pattern.MatchString(message) {
+			return rule
+		}
+	}
+	return errorRules[len(errorRules)-1]
+}
+
+// errorLine returns the line of the first compiler error, or "".
+func errorLine(message string) string {
+	if m := errorLocation.FindStringSubmatch(message); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+func stubErrorAnalysis(message string) string {
+	rule := matchErrorRule(message)
+	where := ""
+	if line := errorLine(message); line != "" {
+		where = fmt.Sprintf(" (linha %s)", line)
+	}
+	return fmt.Sprintf("## Erro\n%s%s\n\n## Causa\n%s\n\n## Como Corrigir\n%s\n\n## Conceito\n%s\n\n## Dicas\n%s",
+		rule.Error, where, rule.Cause, rule.Fix, rule.Concept, rule.Tip)
+}
+
+// codeFeatures lists the C constructs the stub knows how to describe.
+var codeFeatures = []struct {
+	pattern     *regexp.Regexp
+	description string
+}{
+	{regexp.MustCompile(`\bprintf\s*\(`), "`printf` (stdio.h): imprime texto formatado na saída"},
+	{regexp.MustCompile(`\bscanf\s*\(`), "`scanf` (stdio.h): lê valores da entrada"},
+	{regexp.MustCompile(`\bfor\s*\(`), "laço `for`: repete um bloco um número conhecido de vezes"},
+	{regexp.MustCompile(`\bwhile\s*\(`), "laço `while`: repete enquanto a condição for verdadeira"},
+	{regexp.MustCompile(`\bif\s*\(`), "`if`: executa um bloco conforme uma condição"},
+	{regexp.MustCompile(`\w+\s*\[\s*\w*\s*\]\s*[;=]`), "vetores: guardam vários valores do mesmo tipo"},
+	{regexp.MustCompile(`\b(malloc|calloc|free)\s*\(`), "alocação dinâmica (stdlib.h): reserva e libera memória em tempo de execução"},
+	{regexp.MustCompile(`\bstruct\s+\w+`), "`struct`: agrupa campos relacionados em um tipo"},
+	{regexp.MustCompile(`\b(sqrt|pow|fabs)\s*\(`), "funções matemáticas (math.h)"},
+	{regexp.MustCompile(`\b(strlen|strcpy|strcmp|strcat)\s*\(`), "funções de string (string.h)"},
+}
+
+func stubAnalysis(code string, output string) string {
+	var features []string
+	for _, f := range codeFeatures {
+		if f.pattern.MatchString(code) {
+			features = append(features, "- "+f.description)
+		}
+	}
+	if len(features) == 0 {
+		features = append(features, "- Nenhuma função de biblioteca reconhecida.")
+	}
+
+	lines := strings.Count(strings.TrimSpace(code), "\n") + 1
+	outputLines := 0
+	if strings.TrimSpace(output) != "" {
+		outputLines = strings.Count(strings.TrimSpace(output), "\n") + 1
+	}
+
+	outputNote := "O programa não produziu saída. Verifique se os resultados estão sendo impressos com `printf`."
+	if outputLines > 0 {
+		outputNote = fmt.Sprintf("O programa imprimiu %d linha(s). Compare a saída com o resultado esperado para a entrada usada.", outputLines)
+	}
+
+	return fmt.Sprintf("## Resumo\nO programa compilou e executou sem erros.\n\n## Estrutura\nO código tem %d linha(s).\n\n## Funções\n%s\n\n## Fluxo\nA execução começa em `main` e segue as instruções de cima para baixo, desviando nos laços e condições.\n\n## Análise da Saída\n%s\n\n## Dicas\nAnálise gerada automaticamente sem IA. Teste o programa com entradas diferentes, incluindo valores nos limites (zero, negativos, máximos).",
+		lines, strings.Join(features, "\n"), outputNote)
+}
+
+func stubHint(level int, output string) string {
+	rule := matchErrorRule(output)
+	hasError := strings.Contains(output, "error:") || !strings.HasPrefix(rule.Error, "O compilador")
+	switch {
+	case !hasError && level <= HintConceptual:
+		return "Releia o enunciado e liste as entradas e a saída esperada. Pense em quais passos transformam uma na outra antes de escrever código."
+	case !hasError && level == HintLocation:
+		return "Acompanhe a execução com uma entrada pequena, anotando o valor de cada variável a cada passo, e compare com o que o enunciado pede."
+	case !hasError:
+		return "Verifique as condições de parada dos laços e os valores iniciais das variáveis: são as causas mais comuns de resultados errados."
+	case level <= HintConceptual:
+		return rule.Concept
+	case level == HintLocation:
+		if line := errorLine(output); line != "" {
+			return fmt.Sprintf("O problema está na linha %s ou logo antes dela. %s", line, rule.Cause)
+		}
+		return rule.Cause
+	}
+	return rule.Fix
+}
+
+func stubTutor(lastOutput string) string {
+	if strings.Contains(lastOutput, "error:") {
+		return "O tutor está em modo offline e só reconhece erros comuns. " + stubHint(HintLocation, lastOutput)
+	}
+	return "O tutor está em modo offline e não consegue responder perguntas livres agora. Tente pedir uma dica ou rode o programa para receber a análise automática."
+}
+
+func stubGrading(data map[string]any) map[string]any {
+	if outputMatches(data) {
+		return map[string]any{"passed": true, "feedback": "A saída corresponde à saída esperada."}
+	}
+	return map[string]any{"passed": false, "feedback": "A saída difere da saída esperada."}
+}
+
+func stubExamGrading(data map[string]any) map[string]any {
+	maxNote, _ := data["MaxNote"].(float64)
+	if outputMatches(data) {
+		return map[string]any{"score": maxNote, "feedback": "Correção automática sem IA: a saída corresponde à saída esperada."}
+	}
+	return map[string]any{"score": 0, "feedback": "Correção automática sem IA: a saída difere da saída esperada. Revise manualmente."}
+}
+
+func stubRubricGrading(data map[string]any) map[string]any {
+	criteria, _ := data["Criteria"].([]RubricCriterion)
+	matches := outputMatches(data)
+	scores := make([]map[string]any, 0, len(criteria))
+	for _, c := range criteria {
+		score, justification := 0.0, "A saída difere da saída esperada."
+		if matches {
+			score, justification = c.Points, "A saída corresponde à saída esperada."
+		}
+		scores = append(scores, map[string]any{"id": c.ID, "score": score, "justification": justification})
+	}
+	return map[string]any{"criteria": scores, "feedback": "Correção automática sem IA, baseada apenas na saída."}
+}
+
+func outputMatches(data map[string]any) bool {
+	expected := normalizeOutput(dataString(data, "ExpectedOutput"))
+	return expected != "" && normalizeOutput(dataString(data, "Output")) == expected
+}
+
+var stubTestInputs = []GeneratedTestCase{
+	{Input: "0", Category: "boundary", Rationale: "Valor zero."},
+	{Input: "1", Category: "boundary", Rationale: "Menor valor positivo."},
+	{Input: "-1", Category: "boundary", Rationale: "Valor negativo."},
+	{Input: "", Category: "empty", Rationale: "Entrada vazia."},
+	{Input: "5", Category: "typical", Rationale: "Valor típico."},
+	{Input: "1000000", Category: "large", Rationale: "Valor grande."},
+	{Input: "2147483647", Category: "large", Rationale: "Maior int de 32 bits."},
+	{Input: "10", Category: "typical", Rationale: "Outro valor típico."},
+	{Input: "abc", Category: "invalid", Rationale: "Entrada não numérica."},
+}
+
+func stubTestCases(data map[string]any) map[string]any {
+	count, _ := data["Count"].(int)
+	if count <= 0 || count > len(stubTestInputs) {
+		count = len(stubTestInputs)
+	}
+	return map[string]any{"cases": stubTestInputs[:count]}
+}
+
+// stubTasks are the exercise statements the stub generator cycles through.
+var stubTasks = []struct{ title, description, output string }{
+	{"Soma de %d números", "Leia %d números inteiros e imprima a soma deles.", "15"},
+	{"Maior de %d valores", "Leia %d números inteiros e imprima o maior deles.", "9"},
+	{"Contagem de pares entre %d", "Leia %d números inteiros e imprima quantos deles são pares.", "2"},
+	{"Média de %d notas", "Leia %d notas reais e imprima a média com duas casas decimais.", "7.50"},
+	{"Fatorial até %d", "Leia um inteiro N entre 0 e %d e imprima N!.", "120"},
+	{"Inverter %d elementos", "Leia um vetor de %d inteiros e imprima-o em ordem inversa.", "5 4 3 2 1"},
+	{"Vogais em frase de %d caracteres", "Leia uma frase de até %d caracteres e imprima quantas vogais ela tem.", "4"},
+	{"Tabuada até %d", "Leia um inteiro e imprima sua tabuada de 1 até %d.", "5 x 1 = 5"},
+}
+
+func stubQuestions(data map[string]any) map[string]any {
+	count, _ := data["NumQuestions"].(int)
+	variants, _ := data["VariantsPerQuestion"].(int)
+	targets, _ := data["Targets"].([]string)
+	avoid, _ := data["Avoid"].([]string)
+	topic := dataString(data, "Topic")
+
+	// Start after the exercises already avoided so repeated calls move on
+	offset := len(avoid)
+	questions := make([]map[string]any, 0, count)
+	for i := 0; i < count; i++ {
+		concept := topic
+		if i < len(targets) {
+			concept = targets[i]
+		}
+		var vs []map[string]any
+		for j := 0; j < variants; j++ {
+			task := stubTasks[(offset+i*variants+j)%len(stubTasks)]
+			n := 5 + 5*i
+			vs = append(vs, map[string]any{
+				"title":          fmt.Sprintf(task.title, n),
+				"description":    fmt.Sprintf(task.description, n),
+				"expectedOutput": task.output,
+				"initialCode":    "#include <stdio.h>\n\nint main() {\n    // Seu código aqui\n    return 0;\n}",
+			})
+		}
+		questions = append(questions, map[string]any{"concept": concept, "variants": vs})
+	}
+	return map[string]any{"questions": questions}
+}
+
+func stubJSON(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func dataString(data map[string]any, key string) string {
+	switch v := data[key].(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
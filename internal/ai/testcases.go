@@ -0,0 +1,82 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Test case categories the model may assign.
+var TestCaseCategories = []string{"boundary", "empty", "large", "invalid", "typical"}
+
+// GeneratedTestCase is a candidate stdin input proposed by the model. Its
+// ExpectedOutput is the model's guess and should be replaced by the output of a
+// reference solution when there is one.
+type GeneratedTestCase struct {
+	Input          string `json:"input"`
+	ExpectedOutput string `json:"expectedOutput"`
+	Category       string `json:"category"`
+	Rationale      string `json:"rationale"`
+}
+
+var testCasesSchema = ObjectSchema(map[string]*Schema{
+	"cases": {Type: "array", Items: ObjectSchema(map[string]*Schema{
+		"input":          {Type: "string"},
+		"expectedOutput": {Type: "string"},
+		"category":       {Type: "string"},
+		"rationale":      {Type: "string"},
+	})},
+})
+
+// GenerateTestCases asks the model for count edge-case inputs for an exercise.
+func GenerateTestCases(ctx context.Context, title string, description string, expectedOutput string, count int) ([]GeneratedTestCase, error) {
+	prompt, err := renderPrompt(PromptGenerateTests, LocaleFrom(ctx), map[string]any{
+		"Title":          title,
+		"Description":    description,
+		"ExpectedOutput": expectedOutput,
+		"Count":          count,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Cases []GeneratedTestCase `json:"cases"`
+	}
+	check := func() error {
+		if len(response.Cases) == 0 {
+			return fmt.Errorf("no test cases returned")
+		}
+		return nil
+	}
+	if err := completeStructured(ctx, "", TaskGeneration, prompt, testCasesSchema, &response, check); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var cases []GeneratedTestCase
+	for _, tc := range response.Cases {
+		key := strings.TrimSpace(tc.Input)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if !isTestCaseCategory(tc.Category) {
+			tc.Category = "typical"
+		}
+		cases = append(cases, tc)
+		if len(cases) == count {
+			break
+		}
+	}
+	return cases, nil
+}
+
+func isTestCaseCategory(category string) bool {
+	for _, c := range TestCaseCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package ai
+
+import "context"
+
+type ChatTurn struct {
+	Role    string
+	Content string
+}
+
+// TutorContext is everything the tutor knows about the student's current work.
+type TutorContext struct {
+	ExerciseTitle       string
+	ExerciseDescription string
+	Code                string
+	LastOutput          string
+	Turns               []ChatTurn
+}
+
+// StreamTutorReply answers a student's follow-up question, keeping the prior turns as context.
+func StreamTutorReply(ctx context.Context, tc TutorContext, question string, onChunk func(string)) (string, error) {
+	prompt, err := renderPrompt(PromptTutor, LocaleFrom(ctx), map[string]any{
+		"ExerciseTitle":       tc.ExerciseTitle,
+		"ExerciseDescription": tc.ExerciseDescription,
+		"Code":                tc.Code,
+		"LastOutput":          tc.LastOutput,
+		"Turns":               tc.Turns,
+		"Question":            question,
+	})
+	if err != nil {
+		return "", err
+	}
+	return streamAI(ctx, TaskAnalysis, prompt, onChunk)
+}
@@ -0,0 +1,114 @@
+package ai
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Usage describes one model call.
+type Usage struct {
+	// UserID is the user who triggered the call; 0 with Interactive set means
+	// an anonymous user, and Interactive false means a system call (grading,
+	// question generation).
+	UserID        uint
+	Interactive   bool
+	ClassroomID   uint // Classroom the caller was working in, 0 if none
+	Task          Task
+	Provider      string
+	Model         string
+	PromptChars   int
+	ResponseChars int
+	Tokens        int
+	Latency       time.Duration
+	Err           error
+}
+
+// UsageHooks let another package enforce quotas and keep a ledger of model
+// calls without the ai package depending on the database.
+type UsageHooks struct {
+	// Check runs before every model call; a non-nil error aborts the call.
+	Check func(ctx context.Context, task Task) error
+	// Record runs after every model call, successful or not.
+	Record func(ctx context.Context, usage Usage)
+}
+
+type callerKey struct{}
+
+type classroomKey struct{}
+
+var (
+	hooksMu    sync.RWMutex
+	usageHooks UsageHooks
+)
+
+// SetUsageHooks installs the quota check and usage recorder.
+func SetUsageHooks(h UsageHooks) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	usageHooks = h
+}
+
+// WithCaller marks ctx as a call triggered by userID (0 for anonymous users),
+// so it counts against that user's quota.
+func WithCaller(ctx context.Context, userID uint) context.Context {
+	return context.WithValue(ctx, callerKey{}, userID)
+}
+
+// CallerFrom returns the user set by WithCaller.
+func CallerFrom(ctx context.Context) (uint, bool) {
+	userID, ok := ctx.Value(callerKey{}).(uint)
+	return userID, ok
+}
+
+// WithClassroom marks ctx as a call made while working in the classroom, so
+// it also counts against that classroom's quota.
+func WithClassroom(ctx context.Context, classroomID uint) context.Context {
+	return context.WithValue(ctx, classroomKey{}, classroomID)
+}
+
+// ClassroomFrom returns the classroom set by WithClassroom, or 0.
+func ClassroomFrom(ctx context.Context) uint {
+	classroomID, _ := ctx.Value(classroomKey{}).(uint)
+	return classroomID
+}
+
+// EstimateTokens approximates the token count of a text. Providers do not
+// report usage uniformly, so budgets are kept in estimated tokens.
+func EstimateTokens(chars int) int {
+	return (chars + 3) / 4
+}
+
+func checkUsage(ctx context.Context, task Task) error {
+	hooksMu.RLock()
+	check := usageHooks.Check
+	hooksMu.RUnlock()
+	if check == nil {
+		return nil
+	}
+	return check(ctx, task)
+}
+
+func recordUsage(ctx context.Context, cfg ProviderConfig, task Task, prompt string, response string, start time.Time, err error) {
+	hooksMu.RLock()
+	record := usageHooks.Record
+	hooksMu.RUnlock()
+	if record == nil {
+		return
+	}
+
+	userID, interactive := CallerFrom(ctx)
+	record(ctx, Usage{
+		UserID:        userID,
+		Interactive:   interactive,
+		ClassroomID:   ClassroomFrom(ctx),
+		Task:          task,
+		Provider:      cfg.Name,
+		Model:         cfg.Model,
+		PromptChars:   len(prompt),
+		ResponseChars: len(response),
+		Tokens:        EstimateTokens(len(prompt) + len(response)),
+		Latency:       time.Since(start),
+		Err:           err,
+	})
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vitub/CLabServer/internal/ai"
+	"github.com/vitub/CLabServer/internal/dtos"
+	"github.com/vitub/CLabServer/internal/initializers"
+	"github.com/vitub/CLabServer/internal/models"
+	"github.com/vitub/CLabServer/internal/quota"
+	"github.com/vitub/CLabServer/internal/ws"
+)
+
+// requireAdmin writes a 403 and returns false unless the user is an admin.
+func requireAdmin(c *gin.Context) bool {
+	user, _ := c.Get("user")
+	if u, ok := user.(models.User); !ok || u.Role != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, dtos.ErrorResponse{Error: "Requires Admin privileges"})
+		return false
+	}
+	return true
+}
+
+func GetAICacheStats(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+
+	c.JSON(http.StatusOK, dtos.SuccessResponse{
+		Success: true,
+		Data:    ai.GetCacheStats(),
+	})
+}
+
+func GetAIUsage(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+
+	days, err := strconv.Atoi(c.DefaultQuery("days", "1"))
+	if err != nil || days < 1 {
+		days = 1
+	}
+	now := time.Now()
+	since := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, 1-days)
+
+	var users []dtos.AIUserUsage
+	err = initializers.DB.Model(&models.AIUsage{}).
+		Select("ai_usages.user_id, users.name AS user_name, COUNT(*) AS requests, COALESCE(SUM(ai_usages.tokens), 0) AS tokens").
+		Joins("JOIN users ON users.id = ai_usages.user_id").
+		Where("ai_usages.created_at >= ?", since).
+		Group("ai_usages.user_id, users.name").
+		Order("tokens desc").
+		Scan(&users).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Failed to fetch AI usage"})
+		return
+	}
+	for i := range users {
+		budget := quota.BudgetFor(models.BudgetScopeUser, users[i].UserID)
+		users[i].Budget = dtos.AIBudgetResponse{DailyRequests: budget.DailyRequests, DailyTokens: budget.DailyTokens}
+	}
+
+	var providers []dtos.AIProviderUsage
+	initializers.DB.Model(&models.AIUsage{}).
+		Select("provider, task, COUNT(*) AS requests, COALESCE(SUM(tokens), 0) AS tokens, COALESCE(AVG(latency_ms), 0) AS avg_latency_ms, SUM(CASE WHEN success THEN 0 ELSE 1 END) AS failures").
+		Where("created_at >= ?", since).
+		Group("provider, task").
+		Order("provider, task").
+		Scan(&providers)
+
+	c.JSON(http.StatusOK, dtos.SuccessResponse{
+		Success: true,
+		Data: dtos.AIUsageResponse{
+			Since:     since.Format(time.RFC3339),
+			Users:     users,
+			Providers: providers,
+		},
+	})
+}
+
+func ListAIBudgets(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+
+	var budgets []models.AIBudget
+	if err := initializers.DB.Order("scope, scope_id").Find(&budgets).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Failed to fetch budgets"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dtos.SuccessResponse{
+		Success: true,
+		Data: gin.H{
+			"defaults": gin.H{
+				"user":      quota.DefaultBudget(models.BudgetScopeUser),
+				"classroom": quota.DefaultBudget(models.BudgetScopeClassroom),
+				"anonymous": quota.DefaultBudget(""),
+			},
+			"overrides": budgets,
+		},
+	})
+}
+
+func UpdateUserAIBudget(c *gin.Context) {
+	updateAIBudget(c, models.BudgetScopeUser)
+}
+
+func UpdateClassroomAIBudget(c *gin.Context) {
+	updateAIBudget(c, models.BudgetScopeClassroom)
+}
+
+func updateAIBudget(c *gin.Context, scope string) {
+	if !requireAdmin(c) {
+		return
+	}
+
+	scopeID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dtos.ErrorResponse{Error: "Invalid ID"})
+		return
+	}
+
+	var req dtos.UpdateAIBudgetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dtos.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var target interface{} = &models.User{}
+	if scope == models.BudgetScopeClassroom {
+		target = &models.Classroom{}
+	}
+	if err := initializers.DB.First(target, scopeID).Error; err != nil {
+		c.JSON(http.StatusNotFound, dtos.ErrorResponse{Error: "Not found"})
+		return
+	}
+
+	budget, err := quota.SetBudget(scope, uint(scopeID), quota.Budget{DailyRequests: req.DailyRequests, DailyTokens: req.DailyTokens})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Failed to update budget"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dtos.SuccessResponse{
+		Success: true,
+		Data:    budget,
+	})
+}
+
+func ListPrompts(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+
+	c.JSON(http.StatusOK, dtos.SuccessResponse{
+		Success: true,
+		Data:    ai.ListPrompts(),
+	})
+}
+
+// UpdatePrompt installs a prompt override here and, through the hub, on the
+// other replicas, which reload the overrides from the database.
+func UpdatePrompt(c *gin.Context, hub *ws.Hub) {
+	if !requireAdmin(c) {
+		return
+	}
+
+	var req dtos.UpdatePromptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dtos.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	language, locale, name := c.Param("language"), c.Param("locale"), c.Param("name")
+	info, err := ai.SetPromptOverride(name, language, locale, req.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dtos.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	user, _ := c.Get("user")
+	override := models.PromptOverride{Name: name, Language: language, Locale: locale}
+	initializers.DB.Where(&override).First(&override)
+	override.Body = req.Body
+	override.UpdatedBy = user.(models.User).ID
+	if err := initializers.DB.Save(&override).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Failed to save prompt override"})
+		return
+	}
+	hub.PublishEvent(ws.EventPromptsChanged, nil)
+
+	c.JSON(http.StatusOK, dtos.SuccessResponse{
+		Success: true,
+		Data:    info,
+	})
+}
+
+func ResetPrompt(c *gin.Context, hub *ws.Hub) {
+	if !requireAdmin(c) {
+		return
+	}
+
+	language, locale, name := c.Param("language"), c.Param("locale"), c.Param("name")
+	if err := initializers.DB.Unscoped().Where("name = ? AND language = ? AND locale = ?", name, language, locale).
+		Delete(&models.PromptOverride{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Failed to reset prompt"})
+		return
+	}
+	ai.ClearPromptOverride(name, language, locale)
+	hub.PublishEvent(ws.EventPromptsChanged, nil)
+
+	c.JSON(http.StatusOK, dtos.SuccessResponse{
+		Success: true,
+		Message: "Prompt restored to the built-in template",
+	})
+}
@@ -1,12 +1,12 @@
 package handlers
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/vitub/CLabServer/internal/access"
 	"github.com/vitub/CLabServer/internal/dtos"
 	"github.com/vitub/CLabServer/internal/initializers"
 	"github.com/vitub/CLabServer/internal/models"
@@ -15,15 +15,7 @@ import (
 )
 
 func isTeacherOfClassroom(userID uint, classroom *models.Classroom) bool {
-	if classroom.TeacherID == userID {
-		return true
-	}
-	for _, t := range classroom.Teachers {
-		if t.ID == userID {
-			return true
-		}
-	}
-	return false
+	return access.Teaches(userID, classroom.ID)
 }
 
 func loadClassroomWithTeachers(classroomID string) (*models.Classroom, error) {
@@ -32,6 +24,25 @@ func loadClassroomWithTeachers(classroomID string) (*models.Classroom, error) {
 	return &classroom, err
 }
 
+// teacherClassroom loads the route's classroom, writing the error response and
+// returning false when the user does not teach it.
+func teacherClassroom(c *gin.Context) (*models.Classroom, bool) {
+	user, _ := c.Get("user")
+	currentUser := user.(models.User)
+
+	classroom, err := loadClassroomWithTeachers(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, dtos.ErrorResponse{Error: "Classroom not found"})
+		return nil, false
+	}
+
+	if !isTeacherOfClassroom(currentUser.ID, classroom) {
+		c.JSON(http.StatusForbidden, dtos.ErrorResponse{Error: "Not authorized"})
+		return nil, false
+	}
+	return classroom, true
+}
+
 func CreateClassroom(c *gin.Context) {
 	var req dtos.CreateClassroomRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -166,7 +177,7 @@ func ListClassrooms(c *gin.Context) {
 	})
 }
 
-func AddTeacher(c *gin.Context) {
+func AddTeacher(c *gin.Context, hub *ws.Hub) {
 	classroomID := c.Param("id")
 	var req dtos.AddTeacherRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -198,6 +209,9 @@ func AddTeacher(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Failed to add teacher"})
 		return
 	}
+	if hub != nil {
+		hub.NotifyMembershipChanged(teacher.ID, classroom.ID)
+	}
 
 	c.JSON(http.StatusOK, dtos.SuccessResponse{
 		Success: true,
@@ -205,7 +219,7 @@ func AddTeacher(c *gin.Context) {
 	})
 }
 
-func RemoveTeacher(c *gin.Context) {
+func RemoveTeacher(c *gin.Context, hub *ws.Hub) {
 	classroomID := c.Param("id")
 	teacherID := c.Param("teacherId")
 
@@ -233,6 +247,9 @@ func RemoveTeacher(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Failed to remove teacher"})
 		return
 	}
+	if hub != nil {
+		hub.NotifyMembershipChanged(teacher.ID, classroom.ID)
+	}
 
 	c.JSON(http.StatusOK, dtos.SuccessResponse{
 		Success: true,
@@ -240,7 +257,7 @@ func RemoveTeacher(c *gin.Context) {
 	})
 }
 
-func AddStudent(c *gin.Context) {
+func AddStudent(c *gin.Context, hub *ws.Hub) {
 	classroomID := c.Param("id")
 	var req dtos.AddStudentRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -282,6 +299,9 @@ func AddStudent(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Failed to add student"})
 		return
 	}
+	if hub != nil {
+		hub.NotifyMembershipChanged(student.ID, classroom.ID)
+	}
 
 	c.JSON(http.StatusOK, dtos.SuccessResponse{
 		Success: true,
@@ -316,7 +336,7 @@ func DeleteClassroom(c *gin.Context) {
 	})
 }
 
-func RemoveStudent(c *gin.Context) {
+func RemoveStudent(c *gin.Context, hub *ws.Hub) {
 	classroomID := c.Param("id")
 	studentID := c.Param("studentId")
 
@@ -344,6 +364,9 @@ func RemoveStudent(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Failed to remove student from classroom"})
 		return
 	}
+	if hub != nil {
+		hub.NotifyMembershipChanged(student.ID, classroom.ID)
+	}
 
 	c.JSON(http.StatusOK, dtos.SuccessResponse{
 		Success: true,
@@ -394,15 +417,13 @@ func ToggleExamMode(c *gin.Context, hub *ws.Hub) {
 		return
 	}
 
-	// Notify all connected clients that an exam just started or stopped
+	// Notify the classroom's students and teachers that an exam just started or stopped
 	if hub != nil {
-		msg := ws.WSMsg{
-			Type:    "exam_status_changed",
-			Payload: fmt.Sprintf("%d", classroom.ID),
-		}
-		if msgBytes, err := json.Marshal(msg); err == nil {
-			hub.BroadcastToAll(msgBytes)
-		}
+		hub.PublishToRoom(ws.ClassroomRoom(classroom.ID), ws.WSMsg{
+			Type:        "exam_status_changed",
+			Payload:     fmt.Sprintf("%d", classroom.ID),
+			ClassroomID: classroom.ID,
+		})
 	}
 
 	c.JSON(http.StatusOK, dtos.SuccessResponse{
@@ -429,20 +450,18 @@ func ResetStudentPassword(c *gin.Context) {
 		return
 	}
 
-	// Verify the student actually belongs to this classroom
-	var studentCount int64
-	initializers.DB.Table("classroom_students").Where("classroom_id = ? AND user_id = ?", classroomID, studentID).Count(&studentCount)
-	if studentCount == 0 {
-		c.JSON(http.StatusNotFound, dtos.ErrorResponse{Error: "Student is not in this classroom"})
-		return
-	}
-
 	var student models.User
 	if err := initializers.DB.First(&student, studentID).Error; err != nil {
 		c.JSON(http.StatusNotFound, dtos.ErrorResponse{Error: "Student not found"})
 		return
 	}
 
+	// Verify the student actually belongs to this classroom
+	if !access.Enrolled(student.ID, classroom.ID) {
+		c.JSON(http.StatusNotFound, dtos.ErrorResponse{Error: "Student is not in this classroom"})
+		return
+	}
+
 	// Generate new random password
 	newPassword := generateSimplePassword()
 	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), 10)
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/vitub/CLabServer/internal/ai"
 	"github.com/vitub/CLabServer/internal/compiler"
 	"github.com/vitub/CLabServer/internal/initializers"
 	"github.com/vitub/CLabServer/internal/models"
@@ -48,7 +49,14 @@ func HandleCompile(c *gin.Context) {
 	}
 	log.Printf("Received compilation request, code length: %d%s", len(req.Code), inputInfo)
 
-	response := compiler.CompileAndRun(req)
+	var callerID uint
+	var locale string
+	if u, ok := user.(models.User); ok {
+		callerID = u.ID
+		locale = u.Locale
+	}
+	aiCtx := ai.WithLocale(ai.WithCaller(c.Request.Context(), callerID), locale)
+	response := compiler.CompileAndRun(aiCtx, req)
 
 	// Log the response
 	if response.Error != "" {
@@ -65,6 +73,7 @@ func HandleCompile(c *gin.Context) {
 				Code:   req.Code,
 				Input:  req.Input,
 				Output: response.Output,
+				Stderr: response.Stderr,
 				Error:  response.Error,
 			}
 			initializers.DB.Create(&history)
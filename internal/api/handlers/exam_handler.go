@@ -17,7 +17,7 @@ func ListExams(c *gin.Context) {
 
 	folderId := c.Query("folderId")
 
-	query := initializers.DB.Preload("Exercises").
+	query := initializers.DB.Preload("Exercises.Rubric").
 		Where("teacher_id = ? AND is_exam = ?", currentUser.ID, true)
 
 	if folderId == "none" {
@@ -43,6 +43,9 @@ func ListExams(c *gin.Context) {
 				InitialCode:    ex.InitialCode,
 				ExamMaxNote:    ex.ExamMaxNote,
 				VariantGroupID: ex.VariantGroupID,
+				Rubric:         toRubricResponse(ex.Rubric),
+				Concept:        ex.Concept,
+				Difficulty:     ex.Difficulty,
 				CreatedAt:      ex.CreatedAt.Format(time.RFC3339),
 			})
 		}
@@ -116,9 +119,13 @@ func CreateExam(c *gin.Context) {
 				ExpectedOutput: variant.ExpectedOutput,
 				InitialCode:    variant.InitialCode,
 				ExamMaxNote:    variant.ExamMaxNote,
+				MaxHintLevel:   maxHintLevel(variant.MaxHintLevel),
 				VariantGroupID: group.VariantGroupID,
+				Rubric:         buildRubric(variant.Rubric),
+				Concept:        variant.Concept,
+				Difficulty:     variant.Difficulty,
 			}
-			initializers.DB.Create(&exercise)
+			createExercise(&exercise)
 		}
 	}
 
@@ -8,6 +8,7 @@ import (
 	"github.com/vitub/CLabServer/internal/dtos"
 	"github.com/vitub/CLabServer/internal/initializers"
 	"github.com/vitub/CLabServer/internal/models"
+	"gorm.io/gorm"
 )
 
 func CreateExercise(c *gin.Context) {
@@ -41,9 +42,15 @@ func CreateExercise(c *gin.Context) {
 		ExpectedOutput: req.ExpectedOutput,
 		InitialCode:    req.InitialCode,
 		ExamMaxNote:    req.ExamMaxNote,
+		MaxHintLevel:   maxHintLevel(req.MaxHintLevel),
+		Rubric:         buildRubric(req.Rubric),
+		Concept:        req.Concept,
+		Difficulty:     req.Difficulty,
+
+		ReferenceSolution: req.ReferenceSolution,
 	}
 
-	if err := initializers.DB.Create(&exercise).Error; err != nil {
+	if err := createExercise(&exercise); err != nil {
 		c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Failed to create exercise"})
 		return
 	}
@@ -60,6 +67,10 @@ func CreateExercise(c *gin.Context) {
 			InitialCode:    exercise.InitialCode,
 			CreatedAt:      exercise.CreatedAt.Format(time.RFC3339),
 			ExamMaxNote:    exercise.ExamMaxNote,
+			MaxHintLevel:   exercise.MaxHintLevel,
+			Rubric:         toRubricResponse(exercise.Rubric),
+			Concept:        exercise.Concept,
+			Difficulty:     exercise.Difficulty,
 		},
 	})
 }
@@ -68,7 +79,7 @@ func ListExercises(c *gin.Context) {
 	classroomId := c.Param("id")
 
 	var exercises []models.Exercise
-	if err := initializers.DB.Where("classroom_id = ?", classroomId).Find(&exercises).Error; err != nil {
+	if err := initializers.DB.Preload("Rubric").Where("classroom_id = ?", classroomId).Find(&exercises).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Failed to fetch exercises"})
 		return
 	}
@@ -85,6 +96,10 @@ func ListExercises(c *gin.Context) {
 			InitialCode:    ex.InitialCode,
 			CreatedAt:      ex.CreatedAt.Format(time.RFC3339),
 			ExamMaxNote:    ex.ExamMaxNote,
+			MaxHintLevel:   ex.MaxHintLevel,
+			Rubric:         toRubricResponse(ex.Rubric),
+			Concept:        ex.Concept,
+			Difficulty:     ex.Difficulty,
 		})
 	}
 
@@ -93,3 +108,115 @@ func ListExercises(c *gin.Context) {
 		Data:    response,
 	})
 }
+
+func UpdateRubric(c *gin.Context) {
+	classroomId := c.Param("id")
+	exerciseId := c.Param("exerciseId")
+	var req dtos.UpdateRubricRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dtos.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	user, _ := c.Get("user")
+	currentUser := user.(models.User)
+
+	classroom, err := loadClassroomWithTeachers(classroomId)
+	if err != nil {
+		c.JSON(http.StatusNotFound, dtos.ErrorResponse{Error: "Classroom not found"})
+		return
+	}
+
+	if !isTeacherOfClassroom(currentUser.ID, classroom) {
+		c.JSON(http.StatusForbidden, dtos.ErrorResponse{Error: "Not authorized"})
+		return
+	}
+
+	var exercise models.Exercise
+	if err := initializers.DB.Where("id = ? AND classroom_id = ?", exerciseId, classroom.ID).First(&exercise).Error; err != nil {
+		c.JSON(http.StatusNotFound, dtos.ErrorResponse{Error: "Exercise not found"})
+		return
+	}
+
+	saveRubric(c, &exercise, req.Rubric)
+}
+
+// UpdateExamRubric defines the rubric of an exercise in the exam bank, which
+// may not belong to any classroom yet.
+func UpdateExamRubric(c *gin.Context) {
+	var req dtos.UpdateRubricRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dtos.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	user, _ := c.Get("user")
+	currentUser := user.(models.User)
+
+	var topic models.ExerciseTopic
+	if err := initializers.DB.Where("id = ? AND is_exam = ?", c.Param("id"), true).First(&topic).Error; err != nil {
+		c.JSON(http.StatusNotFound, dtos.ErrorResponse{Error: "Exam not found"})
+		return
+	}
+	if !canManageTopic(currentUser.ID, &topic) {
+		c.JSON(http.StatusForbidden, dtos.ErrorResponse{Error: "Not authorized"})
+		return
+	}
+
+	var exercise models.Exercise
+	if err := initializers.DB.Where("id = ? AND topic_id = ?", c.Param("exerciseId"), topic.ID).First(&exercise).Error; err != nil {
+		c.JSON(http.StatusNotFound, dtos.ErrorResponse{Error: "Exercise not found"})
+		return
+	}
+
+	saveRubric(c, &exercise, req.Rubric)
+}
+
+// saveRubric replaces the exercise's rubric and responds with the new one.
+func saveRubric(c *gin.Context, exercise *models.Exercise, criteria []dtos.RubricCriterionRequest) {
+	rubric := buildRubric(criteria)
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("exercise_id = ?", exercise.ID).Delete(&models.RubricCriterion{}).Error; err != nil {
+			return err
+		}
+		for i := range rubric {
+			rubric[i].ExerciseID = exercise.ID
+		}
+		if len(rubric) == 0 {
+			return nil
+		}
+		return tx.Create(&rubric).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Failed to update rubric"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dtos.SuccessResponse{
+		Success: true,
+		Data:    toRubricResponse(rubric),
+	})
+}
+
+func buildRubric(criteria []dtos.RubricCriterionRequest) []models.RubricCriterion {
+	var rubric []models.RubricCriterion
+	for _, c := range criteria {
+		rubric = append(rubric, models.RubricCriterion{
+			Description: c.Description,
+			Points:      c.Points,
+		})
+	}
+	return rubric
+}
+
+func toRubricResponse(rubric []models.RubricCriterion) []dtos.RubricCriterionResponse {
+	var response []dtos.RubricCriterionResponse
+	for _, c := range rubric {
+		response = append(response, dtos.RubricCriterionResponse{
+			ID:          c.ID,
+			Description: c.Description,
+			Points:      c.Points,
+		})
+	}
+	return response
+}
@@ -57,9 +57,15 @@ func CreateTopic(c *gin.Context) {
 				ExpectedOutput: variant.ExpectedOutput,
 				InitialCode:    variant.InitialCode,
 				ExamMaxNote:    variant.ExamMaxNote,
+				MaxHintLevel:   maxHintLevel(variant.MaxHintLevel),
 				VariantGroupID: group.VariantGroupID,
+				Rubric:         buildRubric(variant.Rubric),
+				Concept:        variant.Concept,
+				Difficulty:     variant.Difficulty,
+
+				ReferenceSolution: variant.ReferenceSolution,
 			}
-			initializers.DB.Create(&exercise)
+			createExercise(&exercise)
 		}
 	}
 
@@ -81,7 +87,7 @@ func ListTopics(c *gin.Context) {
 	currentUser := user.(models.User)
 
 	var topics []models.ExerciseTopic
-	if err := initializers.DB.Preload("Exercises").Where("classroom_id = ?", classroomId).Find(&topics).Error; err != nil {
+	if err := initializers.DB.Preload("Exercises.Rubric").Where("classroom_id = ?", classroomId).Find(&topics).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Failed to fetch topics"})
 		return
 	}
@@ -134,7 +140,11 @@ func ListTopics(c *gin.Context) {
 				ExpectedOutput: ex.ExpectedOutput,
 				InitialCode:    ex.InitialCode,
 				ExamMaxNote:    ex.ExamMaxNote,
+				MaxHintLevel:   ex.MaxHintLevel,
 				VariantGroupID: ex.VariantGroupID,
+				Rubric:         toRubricResponse(ex.Rubric),
+				Concept:        ex.Concept,
+				Difficulty:     ex.Difficulty,
 				CreatedAt:      ex.CreatedAt.Format("2006-01-02 15:04:05"),
 			})
 		}
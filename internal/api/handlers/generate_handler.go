@@ -2,10 +2,12 @@ package handlers
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/vitub/CLabServer/internal/ai"
 	"github.com/vitub/CLabServer/internal/dtos"
+	"github.com/vitub/CLabServer/internal/initializers"
 	"github.com/vitub/CLabServer/internal/models"
 )
 
@@ -15,6 +17,11 @@ type GenerateQuestionsRequest struct {
 	Difficulty          string  `json:"difficulty"`
 	Topic               string  `json:"topic"`
 	NotePerQuestion     float64 `json:"notePerQuestion"`
+	// Week targets the concepts of that syllabus week; Concepts targets these
+	// concepts directly. Without either the whole syllabus is used, and without a
+	// syllabus the free-text Topic.
+	Week     int      `json:"week"`
+	Concepts []string `json:"concepts"`
 }
 
 func GenerateQuestions(c *gin.Context) {
@@ -47,9 +54,6 @@ func GenerateQuestions(c *gin.Context) {
 	if req.VariantsPerQuestion <= 0 {
 		req.VariantsPerQuestion = 2
 	}
-	if req.Difficulty == "" {
-		req.Difficulty = "médio"
-	}
 	if req.Topic == "" {
 		req.Topic = "programação C geral"
 	}
@@ -57,13 +61,34 @@ func GenerateQuestions(c *gin.Context) {
 		req.NotePerQuestion = 10.0
 	}
 
-	questions, err := ai.GenerateExamQuestions(
-		req.NumQuestions,
-		req.VariantsPerQuestion,
-		req.Difficulty,
-		req.Topic,
-		req.NotePerQuestion,
-	)
+	syllabus, err := loadSyllabus(classroom.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Failed to fetch syllabus"})
+		return
+	}
+	targets, known := syllabusTargets(syllabus, req.Week, req.Concepts)
+
+	var existing []models.Exercise
+	if err := initializers.DB.Select("title", "description").Where("classroom_id = ?", classroom.ID).
+		Order("id").Find(&existing).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Failed to fetch exercises"})
+		return
+	}
+	spec := ai.QuestionSpec{
+		NumQuestions:        req.NumQuestions,
+		VariantsPerQuestion: req.VariantsPerQuestion,
+		Difficulty:          req.Difficulty,
+		Topic:               req.Topic,
+		Concepts:            targets,
+		Known:               known,
+		NotePerQuestion:     req.NotePerQuestion,
+	}
+	for _, ex := range existing {
+		spec.Existing = append(spec.Existing, ai.ExistingExercise{Title: ex.Title, Description: ex.Description})
+	}
+
+	aiCtx := ai.WithLocale(ai.WithCaller(c.Request.Context(), currentUser.ID), currentUser.Locale)
+	questions, err := ai.GenerateExamQuestions(aiCtx, spec)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Falha ao gerar questões: " + err.Error()})
 		return
@@ -74,3 +99,33 @@ func GenerateQuestions(c *gin.Context) {
 		Data:    questions,
 	})
 }
+
+// syllabusTargets picks the concepts to generate questions for and the concepts
+// students already know: everything taught up to the targeted week.
+func syllabusTargets(syllabus []models.SyllabusConcept, week int, concepts []string) ([]string, []string) {
+	targets := concepts
+	lastWeek := week
+	if len(targets) == 0 {
+		for _, s := range syllabus {
+			if week == 0 || s.Week == week {
+				targets = append(targets, s.Name)
+			}
+		}
+	} else if week == 0 {
+		for _, s := range syllabus {
+			for _, t := range targets {
+				if strings.EqualFold(s.Name, t) && s.Week > lastWeek {
+					lastWeek = s.Week
+				}
+			}
+		}
+	}
+
+	var known []string
+	for _, s := range syllabus {
+		if lastWeek == 0 || s.Week <= lastWeek {
+			known = append(known, s.Name)
+		}
+	}
+	return targets, known
+}
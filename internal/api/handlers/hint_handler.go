@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vitub/CLabServer/internal/dtos"
+	"github.com/vitub/CLabServer/internal/initializers"
+	"github.com/vitub/CLabServer/internal/models"
+	"github.com/vitub/CLabServer/internal/quota"
+	"github.com/vitub/CLabServer/internal/tutor"
+)
+
+func RequestHint(c *gin.Context) {
+	user, _ := c.Get("user")
+	currentUser := user.(models.User)
+
+	exerciseID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dtos.ErrorResponse{Error: "Invalid exercise ID"})
+		return
+	}
+
+	var req dtos.NextHintRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dtos.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	hint, err := tutor.NextHint(c.Request.Context(), currentUser.ID, uint(exerciseID), req.Level, req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, tutor.ErrExamMode), errors.Is(err, tutor.ErrHintsDisabled), errors.Is(err, tutor.ErrNoHintsLeft),
+			errors.Is(err, tutor.ErrNotEnrolled):
+			c.JSON(http.StatusForbidden, dtos.ErrorResponse{Error: err.Error()})
+		case errors.Is(err, quota.ErrQuotaExceeded):
+			c.JSON(http.StatusTooManyRequests, dtos.ErrorResponse{Error: err.Error()})
+		case errors.Is(err, tutor.ErrHintLevelOrder):
+			c.JSON(http.StatusBadRequest, dtos.ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Falha ao gerar a dica: " + err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, dtos.SuccessResponse{
+		Success: true,
+		Data:    hint,
+	})
+}
+
+func ListMyHints(c *gin.Context) {
+	user, _ := c.Get("user")
+	currentUser := user.(models.User)
+
+	var hints []models.HintRequest
+	if err := initializers.DB.Where("user_id = ? AND exercise_id = ?", currentUser.ID, c.Param("id")).
+		Order("level").Find(&hints).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Failed to fetch hints"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dtos.SuccessResponse{
+		Success: true,
+		Data:    hints,
+	})
+}
+
+func UpdateHintLevel(c *gin.Context) {
+	var req dtos.UpdateHintLevelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dtos.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	exercise, ok := teacherExercise(c)
+	if !ok {
+		return
+	}
+
+	if err := initializers.DB.Model(exercise).Update("max_hint_level", *req.MaxHintLevel).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Failed to update hint level"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dtos.SuccessResponse{
+		Success: true,
+		Data:    gin.H{"maxHintLevel": *req.MaxHintLevel},
+	})
+}
+
+func GetHintUsage(c *gin.Context) {
+	exercise, ok := teacherExercise(c)
+	if !ok {
+		return
+	}
+
+	var rows []struct {
+		UserID   uint
+		Name     string
+		MaxLevel int
+		Requests int
+		LastAt   time.Time
+	}
+	err := initializers.DB.Model(&models.HintRequest{}).
+		Select("hint_requests.user_id, users.name, MAX(hint_requests.level) AS max_level, COUNT(*) AS requests, MAX(hint_requests.created_at) AS last_at").
+		Joins("JOIN users ON users.id = hint_requests.user_id").
+		Where("hint_requests.exercise_id = ?", exercise.ID).
+		Group("hint_requests.user_id, users.name").
+		Order("users.name").
+		Scan(&rows).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Failed to fetch hint usage"})
+		return
+	}
+
+	response := []dtos.HintUsageResponse{}
+	for _, r := range rows {
+		response = append(response, dtos.HintUsageResponse{
+			UserID:   r.UserID,
+			UserName: r.Name,
+			MaxLevel: r.MaxLevel,
+			Requests: r.Requests,
+			LastHint: r.LastAt.Format(time.RFC3339),
+		})
+	}
+
+	c.JSON(http.StatusOK, dtos.SuccessResponse{
+		Success: true,
+		Data:    response,
+	})
+}
+
+// maxHintLevel is the requested hint level of a new exercise, or the default
+// when none was given. An explicit 0 disables hints.
+func maxHintLevel(requested *int) int {
+	if requested == nil {
+		return models.DefaultMaxHintLevel
+	}
+	return *requested
+}
+
+// teacherExercise loads the exercise in the route's classroom, writing the
+// error response and returning false when the user does not teach it.
+func teacherExercise(c *gin.Context) (*models.Exercise, bool) {
+	classroom, ok := teacherClassroom(c)
+	if !ok {
+		return nil, false
+	}
+
+	var exercise models.Exercise
+	if err := initializers.DB.Where("id = ? AND classroom_id = ?", c.Param("exerciseId"), classroom.ID).First(&exercise).Error; err != nil {
+		c.JSON(http.StatusNotFound, dtos.ErrorResponse{Error: "Exercise not found"})
+		return nil, false
+	}
+	return &exercise, true
+}
+
+// createExercise inserts the exercise. gorm leaves zero values of defaulted
+// columns to the database, so an explicit 0 for max_hint_level (hints disabled)
+// is written after the insert instead of falling back to the default.
+func createExercise(exercise *models.Exercise) error {
+	disabled := exercise.MaxHintLevel == 0
+	if err := initializers.DB.Create(exercise).Error; err != nil {
+		return err
+	}
+	if disabled {
+		return initializers.DB.Model(exercise).Update("max_hint_level", 0).Error
+	}
+	return nil
+}
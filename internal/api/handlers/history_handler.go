@@ -5,6 +5,8 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/vitub/CLabServer/internal/dtos"
+	"github.com/vitub/CLabServer/internal/grading"
 	"github.com/vitub/CLabServer/internal/initializers"
 	"github.com/vitub/CLabServer/internal/models"
 )
@@ -44,7 +46,7 @@ func ListHistory(c *gin.Context) {
 	var total int64
 
 	// Preload Exercise as well since we might be showing exercise titles
-	query := initializers.DB.Model(&models.History{}).Preload("User").Preload("Exercise")
+	query := initializers.DB.Model(&models.History{}).Preload("User").Preload("Exercise").Preload("RubricScores")
 
 	// If not admin/teacher, restrict to own history
 	if u.Role != "ADMIN" && u.Role != "TEACHER" {
@@ -54,6 +56,10 @@ func ListHistory(c *gin.Context) {
 		if filterUserID != "" {
 			query = query.Where("histories.user_id = ?", filterUserID)
 		}
+		query = query.Preload("GradingSamples").Preload("IntegrityEvents")
+		if c.Query("needsReview") == "true" {
+			query = query.Where("histories.needs_review = ?", true)
+		}
 	}
 
 	if filterClassroomID != "" {
@@ -94,6 +100,98 @@ func ListHistory(c *gin.Context) {
 	})
 }
 
+func ReviewHistory(c *gin.Context) {
+	user, _ := c.Get("user")
+	currentUser := user.(models.User)
+
+	var req dtos.ReviewHistoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dtos.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var history models.History
+	if err := initializers.DB.Preload("Exercise.Rubric").Preload("Exercise.Topic").First(&history, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, dtos.ErrorResponse{Error: "Submission not found"})
+		return
+	}
+	if history.Exercise == nil {
+		c.JSON(http.StatusBadRequest, dtos.ErrorResponse{Error: "Submission is not linked to an exercise"})
+		return
+	}
+	if !canManageExercise(currentUser.ID, history.Exercise) {
+		c.JSON(http.StatusForbidden, dtos.ErrorResponse{Error: "Not authorized"})
+		return
+	}
+
+	maxScore := grading.MaxPoints(*history.Exercise)
+	if req.Score < 0 || req.Score > maxScore {
+		c.JSON(http.StatusBadRequest, dtos.ErrorResponse{Error: fmt.Sprintf("Score must be between 0 and %.2f", maxScore)})
+		return
+	}
+
+	updates := map[string]interface{}{
+		"score":        req.Score,
+		"needs_review": false,
+	}
+	if req.Feedback != "" {
+		updates["teacher_grading"] = req.Feedback
+	}
+	if err := initializers.DB.Model(&history).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Failed to save review"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dtos.SuccessResponse{
+		Success: true,
+		Message: "Review saved",
+	})
+}
+
+// GetHistoryRecording serves the asciicast v2 recording of a run's terminal to
+// the student who ran it, the teachers of the exercise's classroom, the
+// teachers who manage its exam or topic, and admins.
+func GetHistoryRecording(c *gin.Context) {
+	user, _ := c.Get("user")
+	currentUser := user.(models.User)
+
+	var history models.History
+	if err := initializers.DB.Preload("Exercise.Topic").First(&history, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, dtos.ErrorResponse{Error: "Submission not found"})
+		return
+	}
+
+	allowed := currentUser.Role == "ADMIN" || history.UserID == currentUser.ID
+	if !allowed && history.Exercise != nil {
+		allowed = canManageExercise(currentUser.ID, history.Exercise)
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, dtos.ErrorResponse{Error: "Not authorized"})
+		return
+	}
+
+	var recording models.TerminalRecording
+	if err := initializers.DB.Where("history_id = ?", history.ID).First(&recording).Error; err != nil {
+		c.JSON(http.StatusNotFound, dtos.ErrorResponse{Error: "Recording not found"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=\"history-%d.cast\"", history.ID))
+	c.Data(http.StatusOK, "application/x-asciicast", []byte(recording.Cast))
+}
+
+// canManageExercise reports whether the user teaches the exercise's classroom or
+// manages the exam topic it belongs to. The exercise's Topic must be preloaded.
+func canManageExercise(userID uint, exercise *models.Exercise) bool {
+	if exercise.ClassroomID != nil {
+		classroom, err := loadClassroomWithTeachers(fmt.Sprintf("%d", *exercise.ClassroomID))
+		if err == nil && isTeacherOfClassroom(userID, classroom) {
+			return true
+		}
+	}
+	return exercise.Topic != nil && canManageTopic(userID, exercise.Topic)
+}
+
 func parseUint(s string) (int, error) {
 	var val int
 	_, err := fmt.Sscanf(s, "%d", &val)
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vitub/CLabServer/internal/dtos"
+	"github.com/vitub/CLabServer/internal/ws"
+)
+
+// GetClassroomPresence returns the live roster of the classroom's students:
+// who is online, what exercise they have open and how their last run went.
+func GetClassroomPresence(c *gin.Context) {
+	classroom, ok := teacherClassroom(c)
+	if !ok {
+		return
+	}
+
+	roster, err := ws.ClassroomPresence(classroom.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Failed to fetch presence"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dtos.SuccessResponse{
+		Success: true,
+		Data:    roster,
+	})
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vitub/CLabServer/internal/dtos"
+	"github.com/vitub/CLabServer/internal/grading"
+	"github.com/vitub/CLabServer/internal/initializers"
+	"github.com/vitub/CLabServer/internal/models"
+)
+
+// canManageTopic reports whether the user owns the topic or teaches the classroom it is assigned to.
+func canManageTopic(userID uint, topic *models.ExerciseTopic) bool {
+	if topic.TeacherID == userID {
+		return true
+	}
+	if topic.ClassroomID == nil {
+		return false
+	}
+	classroom, err := loadClassroomWithTeachers(strconv.FormatUint(uint64(*topic.ClassroomID), 10))
+	if err != nil {
+		return false
+	}
+	return isTeacherOfClassroom(userID, classroom)
+}
+
+func loadRegradeJob(c *gin.Context, currentUser models.User) (*models.RegradeJob, bool) {
+	var topic models.ExerciseTopic
+	if err := initializers.DB.First(&topic, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, dtos.ErrorResponse{Error: "Exam not found"})
+		return nil, false
+	}
+	if !canManageTopic(currentUser.ID, &topic) {
+		c.JSON(http.StatusForbidden, dtos.ErrorResponse{Error: "Not authorized"})
+		return nil, false
+	}
+
+	var job models.RegradeJob
+	if err := initializers.DB.Where("id = ? AND topic_id = ?", c.Param("jobId"), topic.ID).First(&job).Error; err != nil {
+		c.JSON(http.StatusNotFound, dtos.ErrorResponse{Error: "Regrade job not found"})
+		return nil, false
+	}
+	return &job, true
+}
+
+func StartRegrade(c *gin.Context) {
+	user, _ := c.Get("user")
+	currentUser := user.(models.User)
+
+	var topic models.ExerciseTopic
+	if err := initializers.DB.First(&topic, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, dtos.ErrorResponse{Error: "Exam not found"})
+		return
+	}
+	if !canManageTopic(currentUser.ID, &topic) {
+		c.JSON(http.StatusForbidden, dtos.ErrorResponse{Error: "Not authorized"})
+		return
+	}
+
+	var running int64
+	initializers.DB.Model(&models.RegradeJob{}).
+		Where("topic_id = ? AND status = ?", topic.ID, models.RegradeRunning).
+		Count(&running)
+	if running > 0 {
+		c.JSON(http.StatusConflict, dtos.ErrorResponse{Error: "A regrade is already running for this exam"})
+		return
+	}
+
+	job, err := grading.StartRegrade(topic.ID, currentUser.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Failed to start regrade"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, dtos.SuccessResponse{
+		Success: true,
+		Data:    dtos.RegradeJobResponse{ID: job.ID, TopicID: job.TopicID, Status: job.Status, Total: job.Total},
+	})
+}
+
+func GetRegrade(c *gin.Context) {
+	user, _ := c.Get("user")
+	currentUser := user.(models.User)
+
+	job, ok := loadRegradeJob(c, currentUser)
+	if !ok {
+		return
+	}
+
+	var revisions []models.GradingRevision
+	initializers.DB.Preload("History.User").Preload("History.Exercise").
+		Where("job_id = ?", job.ID).Order("id").Find(&revisions)
+
+	response := dtos.RegradeJobResponse{
+		ID:        job.ID,
+		TopicID:   job.TopicID,
+		Status:    job.Status,
+		Total:     job.Total,
+		Processed: job.Processed,
+		Error:     job.Error,
+	}
+	for _, r := range revisions {
+		diff := dtos.RegradeDiff{
+			HistoryID:   r.HistoryID,
+			UserID:      r.History.UserID,
+			UserName:    r.History.User.Name,
+			ExerciseID:  r.History.ExerciseID,
+			OldScore:    r.OldScore,
+			NewScore:    r.NewScore,
+			Delta:       r.NewScore - r.OldScore,
+			OldFeedback: r.OldFeedback,
+			NewFeedback: r.NewFeedback,
+			Error:       r.Error,
+		}
+		if r.History.Exercise != nil {
+			diff.ExerciseTitle = r.History.Exercise.Title
+		}
+		if r.NewScore != r.OldScore {
+			response.Changed++
+		}
+		response.Revisions = append(response.Revisions, diff)
+	}
+
+	c.JSON(http.StatusOK, dtos.SuccessResponse{
+		Success: true,
+		Data:    response,
+	})
+}
+
+func PublishRegrade(c *gin.Context) {
+	user, _ := c.Get("user")
+	currentUser := user.(models.User)
+
+	job, ok := loadRegradeJob(c, currentUser)
+	if !ok {
+		return
+	}
+	if job.Status != models.RegradeCompleted {
+		c.JSON(http.StatusConflict, dtos.ErrorResponse{Error: "Only completed regrades can be published"})
+		return
+	}
+
+	if err := grading.Publish(job); err != nil {
+		c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Failed to publish regrade"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dtos.SuccessResponse{
+		Success: true,
+		Message: "Regrade published",
+	})
+}
+
+func DiscardRegrade(c *gin.Context) {
+	user, _ := c.Get("user")
+	currentUser := user.(models.User)
+
+	job, ok := loadRegradeJob(c, currentUser)
+	if !ok {
+		return
+	}
+	if job.Status != models.RegradeCompleted && job.Status != models.RegradeFailed {
+		c.JSON(http.StatusConflict, dtos.ErrorResponse{Error: "Only finished regrades can be discarded"})
+		return
+	}
+
+	initializers.DB.Model(job).Update("status", models.RegradeDiscarded)
+
+	c.JSON(http.StatusOK, dtos.SuccessResponse{
+		Success: true,
+		Message: "Regrade discarded",
+	})
+}
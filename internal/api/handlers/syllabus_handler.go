@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vitub/CLabServer/internal/dtos"
+	"github.com/vitub/CLabServer/internal/initializers"
+	"github.com/vitub/CLabServer/internal/models"
+	"gorm.io/gorm"
+)
+
+func GetSyllabus(c *gin.Context) {
+	classroom, ok := teacherClassroom(c)
+	if !ok {
+		return
+	}
+
+	concepts, err := loadSyllabus(classroom.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Failed to fetch syllabus"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dtos.SuccessResponse{
+		Success: true,
+		Data:    toSyllabusResponse(concepts),
+	})
+}
+
+// UpdateSyllabus replaces the classroom's syllabus with the uploaded weeks.
+func UpdateSyllabus(c *gin.Context) {
+	var req dtos.UpdateSyllabusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dtos.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	classroom, ok := teacherClassroom(c)
+	if !ok {
+		return
+	}
+
+	var concepts []models.SyllabusConcept
+	for _, w := range req.Weeks {
+		for _, name := range w.Concepts {
+			if name = strings.TrimSpace(name); name != "" {
+				concepts = append(concepts, models.SyllabusConcept{ClassroomID: classroom.ID, Week: w.Week, Name: name})
+			}
+		}
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("classroom_id = ?", classroom.ID).Delete(&models.SyllabusConcept{}).Error; err != nil {
+			return err
+		}
+		if len(concepts) == 0 {
+			return nil
+		}
+		return tx.Create(&concepts).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Failed to update syllabus"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dtos.SuccessResponse{
+		Success: true,
+		Data:    toSyllabusResponse(concepts),
+	})
+}
+
+func loadSyllabus(classroomID uint) ([]models.SyllabusConcept, error) {
+	var concepts []models.SyllabusConcept
+	err := initializers.DB.Where("classroom_id = ?", classroomID).Order("week, id").Find(&concepts).Error
+	return concepts, err
+}
+
+func toSyllabusResponse(concepts []models.SyllabusConcept) []dtos.SyllabusWeekResponse {
+	response := []dtos.SyllabusWeekResponse{}
+	for _, c := range concepts {
+		if n := len(response); n > 0 && response[n-1].Week == c.Week {
+			response[n-1].Concepts = append(response[n-1].Concepts, c.Name)
+			continue
+		}
+		response = append(response, dtos.SyllabusWeekResponse{Week: c.Week, Concepts: []string{c.Name}})
+	}
+	return response
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vitub/CLabServer/internal/dtos"
+	"github.com/vitub/CLabServer/internal/initializers"
+	"github.com/vitub/CLabServer/internal/models"
+)
+
+// ListTeacherActions returns the audit log of teachers watching, messaging and
+// pushing code to the classroom's students, newest first.
+func ListTeacherActions(c *gin.Context) {
+	classroom, ok := teacherClassroom(c)
+	if !ok {
+		return
+	}
+
+	query := initializers.DB.Where("classroom_id = ?", classroom.ID)
+	if studentID := c.Query("studentId"); studentID != "" {
+		query = query.Where("student_id = ?", studentID)
+	}
+	var actions []models.TeacherAction
+	if err := query.Order("id DESC").Limit(500).Find(&actions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Failed to fetch teacher actions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dtos.SuccessResponse{
+		Success: true,
+		Data:    actions,
+	})
+}
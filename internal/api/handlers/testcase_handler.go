@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vitub/CLabServer/internal/ai"
+	"github.com/vitub/CLabServer/internal/dtos"
+	"github.com/vitub/CLabServer/internal/grading"
+	"github.com/vitub/CLabServer/internal/initializers"
+	"github.com/vitub/CLabServer/internal/models"
+	"github.com/vitub/CLabServer/internal/quota"
+)
+
+func GenerateTestCases(c *gin.Context) {
+	var req dtos.GenerateTestCasesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dtos.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if req.Count <= 0 {
+		req.Count = 5
+	}
+
+	exercise, ok := teacherExercise(c)
+	if !ok {
+		return
+	}
+
+	newReference := strings.TrimSpace(req.ReferenceSolution) != ""
+	if newReference {
+		exercise.ReferenceSolution = req.ReferenceSolution
+	}
+
+	user, _ := c.Get("user")
+	currentUser := user.(models.User)
+	aiCtx := ai.WithLocale(ai.WithCaller(c.Request.Context(), currentUser.ID), currentUser.Locale)
+
+	cases, err := grading.GenerateTestCases(aiCtx, *exercise, req.Count)
+	var compileErr *grading.ReferenceCompileError
+	if errors.As(err, &compileErr) {
+		c.JSON(http.StatusUnprocessableEntity, dtos.ErrorResponse{Error: "A solução de referência não compila:\n" + compileErr.Output})
+		return
+	}
+	// The reference compiled, so it is kept even if the AI call failed.
+	if newReference {
+		if err := initializers.DB.Model(exercise).Update("reference_solution", req.ReferenceSolution).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Failed to save reference solution"})
+			return
+		}
+	}
+	if err != nil {
+		if errors.Is(err, quota.ErrQuotaExceeded) {
+			c.JSON(http.StatusTooManyRequests, dtos.ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Falha ao gerar casos de teste: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dtos.SuccessResponse{
+		Success: true,
+		Data:    toTestCaseResponses(cases),
+	})
+}
+
+func ListTestCases(c *gin.Context) {
+	exercise, ok := teacherExercise(c)
+	if !ok {
+		return
+	}
+
+	query := initializers.DB.Where("exercise_id = ?", exercise.ID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", strings.ToUpper(status))
+	}
+	var cases []models.TestCase
+	if err := query.Order("id").Find(&cases).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Failed to fetch test cases"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dtos.SuccessResponse{
+		Success: true,
+		Data:    toTestCaseResponses(cases),
+	})
+}
+
+// AcceptTestCase marks a candidate as reviewed, applying the teacher's edits.
+// Editing the expected output makes the case verified by the teacher.
+func AcceptTestCase(c *gin.Context) {
+	var req dtos.ReviewTestCaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dtos.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	exercise, ok := teacherExercise(c)
+	if !ok {
+		return
+	}
+
+	var tc models.TestCase
+	if err := initializers.DB.Where("id = ? AND exercise_id = ?", c.Param("caseId"), exercise.ID).First(&tc).Error; err != nil {
+		c.JSON(http.StatusNotFound, dtos.ErrorResponse{Error: "Test case not found"})
+		return
+	}
+
+	if req.Input != nil {
+		tc.Input = *req.Input
+	}
+	if req.ExpectedOutput != nil {
+		tc.ExpectedOutput = *req.ExpectedOutput
+		tc.Verified = true
+		tc.RunError = ""
+	}
+	if req.Hidden != nil {
+		tc.Hidden = *req.Hidden
+	}
+	tc.Status = models.TestCaseAccepted
+
+	if err := initializers.DB.Save(&tc).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Failed to update test case"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dtos.SuccessResponse{
+		Success: true,
+		Data:    toTestCaseResponse(tc),
+	})
+}
+
+func DeleteTestCase(c *gin.Context) {
+	exercise, ok := teacherExercise(c)
+	if !ok {
+		return
+	}
+
+	result := initializers.DB.Where("id = ? AND exercise_id = ?", c.Param("caseId"), exercise.ID).Delete(&models.TestCase{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Failed to delete test case"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, dtos.ErrorResponse{Error: "Test case not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dtos.SuccessResponse{
+		Success: true,
+		Message: "Test case deleted",
+	})
+}
+
+func toTestCaseResponse(tc models.TestCase) dtos.TestCaseResponse {
+	return dtos.TestCaseResponse{
+		ID:             tc.ID,
+		ExerciseID:     tc.ExerciseID,
+		Input:          tc.Input,
+		ExpectedOutput: tc.ExpectedOutput,
+		Category:       tc.Category,
+		Rationale:      tc.Rationale,
+		Status:         tc.Status,
+		Source:         tc.Source,
+		Verified:       tc.Verified,
+		Hidden:         tc.Hidden,
+		RunError:       tc.RunError,
+	}
+}
+
+func toTestCaseResponses(cases []models.TestCase) []dtos.TestCaseResponse {
+	response := []dtos.TestCaseResponse{}
+	for _, tc := range cases {
+		response = append(response, toTestCaseResponse(tc))
+	}
+	return response
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vitub/CLabServer/internal/access"
+	"github.com/vitub/CLabServer/internal/dtos"
+	"github.com/vitub/CLabServer/internal/initializers"
+	"github.com/vitub/CLabServer/internal/models"
+	"github.com/vitub/CLabServer/internal/quota"
+	"github.com/vitub/CLabServer/internal/tutor"
+	"gorm.io/gorm"
+)
+
+func canReadConversation(user models.User, conversation *models.TutorConversation) bool {
+	if conversation.UserID == user.ID || user.Role == models.RoleAdmin {
+		return true
+	}
+	if user.Role != models.RoleTeacher || conversation.Exercise == nil {
+		return false
+	}
+	classroomID := tutor.ExerciseClassroom(conversation.Exercise)
+	return classroomID != 0 && access.Teaches(user.ID, classroomID)
+}
+
+func AskTutor(c *gin.Context) {
+	user, _ := c.Get("user")
+	currentUser := user.(models.User)
+
+	var req dtos.TutorMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dtos.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	reply, err := tutor.Ask(c.Request.Context(), currentUser.ID, req.ExerciseID, req.Code, req.Message, nil)
+	if err != nil {
+		switch {
+		case errors.Is(err, tutor.ErrExamMode), errors.Is(err, tutor.ErrNotEnrolled):
+			c.JSON(http.StatusForbidden, dtos.ErrorResponse{Error: err.Error()})
+		case errors.Is(err, quota.ErrQuotaExceeded):
+			c.JSON(http.StatusTooManyRequests, dtos.ErrorResponse{Error: err.Error()})
+		case errors.Is(err, tutor.ErrEmptyQuestion):
+			c.JSON(http.StatusBadRequest, dtos.ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Falha ao consultar o tutor: " + err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, dtos.SuccessResponse{
+		Success: true,
+		Data:    reply,
+	})
+}
+
+func ListTutorConversations(c *gin.Context) {
+	user, _ := c.Get("user")
+	currentUser := user.(models.User)
+
+	query := initializers.DB.Model(&models.TutorConversation{}).Preload("User").Preload("Exercise")
+
+	switch currentUser.Role {
+	case models.RoleAdmin:
+	case models.RoleTeacher:
+		query = query.Joins("JOIN exercises ON exercises.id = tutor_conversations.exercise_id").
+			Scopes(tutor.ExerciseInClassrooms(access.TaughtClassrooms(currentUser.ID)))
+	default:
+		query = query.Where("tutor_conversations.user_id = ?", currentUser.ID)
+	}
+
+	if exerciseID := c.Query("exerciseId"); exerciseID != "" {
+		query = query.Where("tutor_conversations.exercise_id = ?", exerciseID)
+	}
+	if userID := c.Query("userId"); userID != "" {
+		query = query.Where("tutor_conversations.user_id = ?", userID)
+	}
+
+	var conversations []models.TutorConversation
+	if err := query.Order("tutor_conversations.updated_at desc").Find(&conversations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, dtos.ErrorResponse{Error: "Failed to fetch conversations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dtos.SuccessResponse{
+		Success: true,
+		Data:    conversations,
+	})
+}
+
+func GetTutorConversation(c *gin.Context) {
+	user, _ := c.Get("user")
+	currentUser := user.(models.User)
+
+	var conversation models.TutorConversation
+	err := initializers.DB.Preload("User").Preload("Exercise.Topic").
+		Preload("Messages", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		First(&conversation, c.Param("id")).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, dtos.ErrorResponse{Error: "Conversation not found"})
+		return
+	}
+
+	if !canReadConversation(currentUser, &conversation) {
+		c.JSON(http.StatusForbidden, dtos.ErrorResponse{Error: "Not authorized"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dtos.SuccessResponse{
+		Success: true,
+		Data:    conversation,
+	})
+}
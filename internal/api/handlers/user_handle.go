@@ -255,6 +255,10 @@ func UpdateProfile(c *gin.Context) {
 		updates["password_changed_at"] = time.Now()
 	}
 
+	if req.Locale != "" {
+		updates["locale"] = req.Locale
+	}
+
 	if len(updates) == 0 {
 		c.JSON(http.StatusBadRequest, dtos.ErrorResponse{
 			Success: false,
@@ -37,6 +37,18 @@ func SetupRoutes(r *gin.Engine, hub *ws.Hub) {
 	admin := r.Group("/admin")
 	{
 		admin.POST("/create-teacher", handlers.CreateTeacher)
+		admin.GET("/ai-cache", middleware.RequireAuth, handlers.GetAICacheStats)
+		admin.GET("/ai-usage", middleware.RequireAuth, handlers.GetAIUsage)
+		admin.GET("/ai-budgets", middleware.RequireAuth, handlers.ListAIBudgets)
+		admin.PUT("/ai-budgets/users/:id", middleware.RequireAuth, handlers.UpdateUserAIBudget)
+		admin.PUT("/ai-budgets/classrooms/:id", middleware.RequireAuth, handlers.UpdateClassroomAIBudget)
+		admin.GET("/prompts", middleware.RequireAuth, handlers.ListPrompts)
+		admin.PUT("/prompts/:language/:locale/:name", middleware.RequireAuth, func(c *gin.Context) {
+			handlers.UpdatePrompt(c, hub)
+		})
+		admin.DELETE("/prompts/:language/:locale/:name", middleware.RequireAuth, func(c *gin.Context) {
+			handlers.ResetPrompt(c, hub)
+		})
 	}
 
 	users := r.Group("/users")
@@ -53,11 +65,19 @@ func SetupRoutes(r *gin.Engine, hub *ws.Hub) {
 		classrooms.GET("", handlers.ListClassrooms)
 		classrooms.DELETE("/:id", handlers.DeleteClassroom)
 
-		classrooms.POST("/:id/teachers", handlers.AddTeacher)
-		classrooms.DELETE("/:id/teachers/:teacherId", handlers.RemoveTeacher)
+		classrooms.POST("/:id/teachers", func(c *gin.Context) {
+			handlers.AddTeacher(c, hub)
+		})
+		classrooms.DELETE("/:id/teachers/:teacherId", func(c *gin.Context) {
+			handlers.RemoveTeacher(c, hub)
+		})
 
-		classrooms.POST("/:id/students", handlers.AddStudent)
-		classrooms.DELETE("/:id/students/:studentId", handlers.RemoveStudent)
+		classrooms.POST("/:id/students", func(c *gin.Context) {
+			handlers.AddStudent(c, hub)
+		})
+		classrooms.DELETE("/:id/students/:studentId", func(c *gin.Context) {
+			handlers.RemoveStudent(c, hub)
+		})
 		classrooms.POST("/:id/students/:studentId/reset-password", handlers.ResetStudentPassword)
 
 		classrooms.POST("/:id/topics", handlers.CreateTopic)
@@ -66,18 +86,46 @@ func SetupRoutes(r *gin.Engine, hub *ws.Hub) {
 
 		classrooms.POST("/:id/exercises", handlers.CreateExercise)
 		classrooms.GET("/:id/exercises", handlers.ListExercises)
+		classrooms.PUT("/:id/exercises/:exerciseId/rubric", handlers.UpdateRubric)
+		classrooms.PUT("/:id/exercises/:exerciseId/hints", handlers.UpdateHintLevel)
+		classrooms.GET("/:id/exercises/:exerciseId/hints", handlers.GetHintUsage)
 
 		classrooms.POST("/:id/exam", func(c *gin.Context) {
 			handlers.ToggleExamMode(c, hub)
 		})
 
+		classrooms.GET("/:id/syllabus", handlers.GetSyllabus)
+		classrooms.PUT("/:id/syllabus", handlers.UpdateSyllabus)
+		classrooms.GET("/:id/teacher-actions", handlers.ListTeacherActions)
+		classrooms.GET("/:id/presence", handlers.GetClassroomPresence)
 		classrooms.POST("/:id/generate-questions", handlers.GenerateQuestions)
+		classrooms.POST("/:id/exercises/:exerciseId/generate-tests", handlers.GenerateTestCases)
+		classrooms.GET("/:id/exercises/:exerciseId/test-cases", handlers.ListTestCases)
+		classrooms.PUT("/:id/exercises/:exerciseId/test-cases/:caseId", handlers.AcceptTestCase)
+		classrooms.DELETE("/:id/exercises/:exerciseId/test-cases/:caseId", handlers.DeleteTestCase)
 	}
 
 	history := r.Group("/history")
 	history.Use(middleware.RequireAuth)
 	{
 		history.GET("", handlers.ListHistory)
+		history.PUT("/:id/review", handlers.ReviewHistory)
+		history.GET("/:id/recording", handlers.GetHistoryRecording)
+	}
+
+	tutorRoutes := r.Group("/tutor")
+	tutorRoutes.Use(middleware.RequireAuth)
+	{
+		tutorRoutes.POST("/messages", handlers.AskTutor)
+		tutorRoutes.GET("/conversations", handlers.ListTutorConversations)
+		tutorRoutes.GET("/conversations/:id", handlers.GetTutorConversation)
+	}
+
+	exercises := r.Group("/exercises")
+	exercises.Use(middleware.RequireAuth)
+	{
+		exercises.POST("/:id/hints", handlers.RequestHint)
+		exercises.GET("/:id/hints", handlers.ListMyHints)
 	}
 
 	exams := r.Group("/exams")
@@ -88,6 +136,12 @@ func SetupRoutes(r *gin.Engine, hub *ws.Hub) {
 		exams.POST("/:id/assign", handlers.AssignExamToClassroom)
 		exams.PUT("/:id/folder", handlers.MoveExamToFolder)
 		exams.DELETE("/:id", handlers.DeleteExam)
+		exams.PUT("/:id/exercises/:exerciseId/rubric", handlers.UpdateExamRubric)
+
+		exams.POST("/:id/regrade", handlers.StartRegrade)
+		exams.GET("/:id/regrade/:jobId", handlers.GetRegrade)
+		exams.POST("/:id/regrade/:jobId/publish", handlers.PublishRegrade)
+		exams.POST("/:id/regrade/:jobId/discard", handlers.DiscardRegrade)
 	}
 
 	folders := r.Group("/folders")
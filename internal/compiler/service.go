@@ -3,16 +3,15 @@ package compiler
 import (
 	"bytes"
 	"context"
+	"errors"
 	"log"
-	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/vitub/CLabServer/internal/ai"
 	"github.com/vitub/CLabServer/internal/models"
-	"github.com/vitub/CLabServer/internal/security"
+	"github.com/vitub/CLabServer/internal/quota"
 )
 
 const MaxOutputSize = 1024 * 1024 // 1MB
@@ -52,60 +51,40 @@ func (w *LimitedWriter) String() string {
 	return w.buf.String()
 }
 
-func CompileAndRun(req models.CompileRequest) models.CompileResponse {
+// CompileAndRun compiles and runs the request in the sandbox and analyzes the
+// result with AI. aiCtx identifies the caller for AI quotas (see ai.WithCaller).
+func CompileAndRun(aiCtx context.Context, req models.CompileRequest) models.CompileResponse {
 	log.Println("Starting compilation process")
 
-	tmpDir, err := os.MkdirTemp("", "ccompile")
+	workspace, err := NewWorkspace(req.Code)
 	if err != nil {
-		log.Printf("Failed to create temp directory: %v", err)
-		return models.CompileResponse{Error: "failed to create temp dir"}
+		log.Printf("Failed to prepare workspace: %v", err)
+		return models.CompileResponse{Error: err.Error()}
 	}
-	defer os.RemoveAll(tmpDir)
-	log.Printf("Created temporary directory: %s", tmpDir)
-
-	srcPath := filepath.Join(tmpDir, "program.c")
-	binPath := filepath.Join(tmpDir, "program")
-
-	if err := os.WriteFile(srcPath, []byte(req.Code), 0644); err != nil {
-		log.Printf("Failed to write source file: %v", err)
-		return models.CompileResponse{Error: "failed to write source"}
-	}
-	log.Printf("Source code written to: %s", srcPath)
+	defer workspace.Close()
+	log.Printf("Created temporary directory: %s", workspace.Dir)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	security.DefaultManager.SetWorkspaceDir(tmpDir, false)
-	compileCmd, cleanupCompile, err := security.DefaultManager.CreateSecureCommand(ctx, "gcc", srcPath, "-o", binPath, "-Wall", "-Wextra")
-	if err != nil {
-		log.Printf("Failed to create secure compile command: %v", err)
-		return models.CompileResponse{Error: "server security configuration error creating compile sandbox"}
-	}
-	compileCmd.Dir = tmpDir
-	log.Printf("Compiling with command: gcc %s -o %s -Wall -Wextra", srcPath, binPath)
-	compileOut, err := compileCmd.CombinedOutput()
-	cleanupCompile()
-
-	if err != nil {
-		log.Printf("Compilation failed: %v\nOutput: %s", err, string(compileOut))
+	compileOut, err := workspace.Compile(ctx, "-Wextra")
+	if errors.Is(err, ErrCompilation) {
+		log.Printf("Compilation failed: %v\nOutput: %s", err, compileOut)
 
-		errorAnalysis, analysisErr := ai.GetErrorAnalysis(req.Code, string(compileOut))
+		errorAnalysis, analysisErr := ai.GetErrorAnalysis(aiCtx, req.Code, compileOut)
 		if analysisErr != nil {
 			log.Printf("Error analysis failed: %v", analysisErr)
-			errorAnalysis = "===Analysis===\n# Análise do Erro\n\nDesculpe, não foi possível gerar a análise detalhada do erro neste momento. Por favor, verifique a mensagem de erro do compilador acima."
+			errorAnalysis = analysisFailure(aiCtx, analysisErr, "error_analysis_unavailable")
 		}
 
 		return models.CompileResponse{
-			Error:    string(compileOut),
+			Error:    compileOut,
 			Analysis: errorAnalysis,
 		}
 	}
-
-	if err := security.DefaultManager.ValidateExecutable(binPath); err != nil {
-		log.Printf("Executable validation failed: %v", err)
-		return models.CompileResponse{
-			Error: "Executable validation failed: " + err.Error(),
-		}
+	if err != nil {
+		log.Printf("Compilation setup failed: %v", err)
+		return models.CompileResponse{Error: err.Error()}
 	}
 
 	timeout := 10 * time.Second
@@ -116,37 +95,21 @@ func CompileAndRun(req models.CompileRequest) models.CompileResponse {
 	runCtx, runCancel := context.WithTimeout(context.Background(), timeout)
 	defer runCancel()
 
-	security.DefaultManager.SetWorkspaceDir(tmpDir, true)
-
-	runCmd, cleanupRun, err := security.DefaultManager.CreateSecureCommand(runCtx, binPath)
-	if err != nil {
-		log.Printf("Failed to create secure run command: %v", err)
-		return models.CompileResponse{Error: "server security configuration error creating execution sandbox"}
-	}
-	defer cleanupRun()
-	runCmd.Dir = tmpDir
-
 	var inputData string
 	if len(req.InputLines) > 0 {
 		inputData = strings.Join(req.InputLines, "\n") + "\n"
 		log.Printf("Using input lines: %v", req.InputLines)
 	} else if req.Input != "" {
 		inputData = req.Input
-		if !strings.HasSuffix(inputData, "\n") {
-			inputData += "\n"
-		}
 		log.Printf("Using single input: %q", req.Input)
 	}
 
-	if inputData != "" {
-		runCmd.Stdin = strings.NewReader(inputData)
-	}
-
-	runOut, err := runCmd.CombinedOutput()
+	result := workspace.Run(runCtx, inputData)
+	runOut := result.Stdout
 
-	if err != nil {
-		log.Printf("Execution failed: %v\nOutput: %s", err, string(runOut))
-		errorMsg := string(runOut)
+	if err := result.Err; err != nil {
+		log.Printf("Execution failed: %v\nStderr: %s", err, result.Stderr)
+		errorMsg := result.Stderr
 
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			switch exitErr.ExitCode() {
@@ -167,16 +130,18 @@ func CompileAndRun(req models.CompileRequest) models.CompileResponse {
 		var analysisErr error
 
 		if len(errorMsg) > 20000 {
-			errorAnalysis = "===Analysis===\n# Limite Excedido\n\nNão foi possível analisar o seu código pois a saída de erro ultrapassou o limite de tokens permitidos para a IA."
+			errorAnalysis = ai.Message(ai.LocaleFrom(aiCtx), "error_output_too_large", nil)
 		} else {
-			errorAnalysis, analysisErr = ai.GetErrorAnalysis(req.Code, errorMsg)
+			errorAnalysis, analysisErr = ai.GetErrorAnalysis(aiCtx, req.Code, CombineOutput(runOut, errorMsg))
 			if analysisErr != nil {
 				log.Printf("Error analysis failed: %v", analysisErr)
-				errorAnalysis = "===Analysis===\n# Erro de Execução\n\nO programa compilou com sucesso, mas encontrou um erro durante a execução. Verifique a divisão por zero, acesso a memória inválida, ou loops infinitos."
+				errorAnalysis = analysisFailure(aiCtx, analysisErr, "runtime_error_unavailable")
 			}
 		}
 
 		return models.CompileResponse{
+			Output:   runOut,
+			Stderr:   result.Stderr,
 			Error:    errorMsg,
 			Analysis: errorAnalysis,
 		}
@@ -185,19 +150,111 @@ func CompileAndRun(req models.CompileRequest) models.CompileResponse {
 	var analysis string
 	var errAI error
 
-	if len(string(runOut)) > 20000 {
-		analysis = "## Limite Excedido\n\nNão foi possível analisar o seu código pois a saída ultrapassou o limite de tokens permitidos para a IA."
+	if len(runOut)+len(result.Stderr) > 20000 {
+		analysis = ai.Message(ai.LocaleFrom(aiCtx), "output_too_large", nil)
 	} else {
-		analysis, errAI = ai.GetAIAnalysis(req.Code, string(runOut))
+		analysis, errAI = ai.GetAIAnalysis(aiCtx, req.Code, CombineOutput(runOut, result.Stderr))
 		if errAI != nil {
 			log.Printf("AI analysis failed: %v", errAI)
-			analysis = "===Analysis===\n# Análise do Código\n\nDesculpe, não foi possível gerar a análise detalhada do código neste momento. O programa compilou e executou com sucesso."
+			analysis = analysisFailure(aiCtx, errAI, "analysis_unavailable")
 		}
 	}
 
-	log.Printf("Program executed successfully. Output length: %d", len(string(runOut)))
+	log.Printf("Program executed successfully. Output length: %d", len(runOut))
 	return models.CompileResponse{
-		Output:   string(runOut),
+		Output:   runOut,
+		Stderr:   result.Stderr,
 		Analysis: analysis,
 	}
 }
+
+// CombineOutput appends the program's error output to its standard output for
+// the AI, which should see both. Grading and test cases compare stdout only.
+func CombineOutput(stdout string, stderr string) string {
+	if stderr == "" {
+		return stdout
+	}
+	if stdout != "" && !strings.HasSuffix(stdout, "\n") {
+		stdout += "\n"
+	}
+	return stdout + "[stderr]\n" + stderr
+}
+
+// analysisFailure returns the message shown instead of the analysis when the
+// AI call failed, explaining quota exhaustion rather than hiding it behind the
+// generic fallback message.
+func analysisFailure(aiCtx context.Context, err error, fallback string) string {
+	locale := ai.LocaleFrom(aiCtx)
+	if errors.Is(err, quota.ErrQuotaExceeded) {
+		return ai.Message(locale, "quota_exceeded", err.Error())
+	}
+	return ai.Message(locale, fallback, nil)
+}
+
+// ExecResult holds the outcome of a non-interactive compile and run, without AI analysis.
+type ExecResult struct {
+	CompileError string
+	Stdout       string
+	Stderr       string
+	RunError     error
+}
+
+// Execute compiles and runs code in the sandbox feeding input on stdin.
+// It is used by background jobs (e.g. regrading) that only need the raw outcome.
+func Execute(code string, input string, timeout time.Duration) ExecResult {
+	workspace, err := NewWorkspace(code)
+	if err != nil {
+		return ExecResult{RunError: err}
+	}
+	defer workspace.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	compileOut, err := workspace.Compile(ctx)
+	if errors.Is(err, ErrCompilation) {
+		return ExecResult{CompileError: compileOut}
+	}
+	if err != nil {
+		return ExecResult{RunError: err}
+	}
+
+	runCtx, runCancel := context.WithTimeout(context.Background(), timeout)
+	defer runCancel()
+
+	result := workspace.Run(runCtx, input)
+	return ExecResult{Stdout: result.Stdout, Stderr: result.Stderr, RunError: result.Err}
+}
+
+// ExecuteCases compiles code once and runs the binary on each input, each run
+// with its own timeout. On a compilation failure CompileError is set and no
+// results are returned; any other setup failure is returned as the error.
+func ExecuteCases(code string, inputs []string, timeout time.Duration) (compileError string, results []RunResult, err error) {
+	workspace, err := NewWorkspace(code)
+	if err != nil {
+		return "", nil, err
+	}
+	defer workspace.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	compileOut, err := workspace.Compile(ctx)
+	if errors.Is(err, ErrCompilation) {
+		if compileOut == "" {
+			compileOut = err.Error()
+		}
+		return compileOut, nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	results = make([]RunResult, 0, len(inputs))
+	for _, input := range inputs {
+		runCtx, runCancel := context.WithTimeout(context.Background(), timeout)
+		results = append(results, workspace.Run(runCtx, input))
+		runCancel()
+	}
+	return "", results, nil
+}
@@ -0,0 +1,110 @@
+package compiler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/vitub/CLabServer/internal/security"
+)
+
+// ErrCompilation is returned by Workspace.Compile when gcc rejected the code;
+// any other error is a server problem.
+var ErrCompilation = errors.New("compilation failed")
+
+// Workspace is a temporary directory with a program's source and binary. The
+// HTTP compiler, the WebSocket terminal and the background graders all build
+// and run code through it, so they share one sandbox setup.
+type Workspace struct {
+	Dir string
+	src string
+	bin string
+}
+
+// NewWorkspace writes code to a new temporary directory. Close removes it.
+func NewWorkspace(code string) (*Workspace, error) {
+	dir, err := os.MkdirTemp("", "ccompile")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	w := &Workspace{Dir: dir, src: filepath.Join(dir, "program.c"), bin: filepath.Join(dir, "program")}
+	if err := os.WriteFile(w.src, []byte(code), 0644); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to write source: %w", err)
+	}
+	return w, nil
+}
+
+func (w *Workspace) Close() {
+	os.RemoveAll(w.Dir)
+}
+
+// Compile builds the program with -Wall and the extra flags. The compiler
+// output is returned in both cases: errors on failure, warnings on success.
+func (w *Workspace) Compile(ctx context.Context, extraFlags ...string) (string, error) {
+	args := append([]string{w.src, "-o", w.bin, "-Wall"}, extraFlags...)
+	cmd, cleanup, err := security.DefaultManager.CreateWorkspaceCommand(ctx, w.Dir, false, "gcc", args...)
+	if err != nil {
+		return "", fmt.Errorf("server security configuration error creating compile sandbox: %w", err)
+	}
+	cmd.Dir = w.Dir
+	out, err := cmd.CombinedOutput()
+	cleanup()
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return string(out), fmt.Errorf("%w: %v", ErrCompilation, err)
+		}
+		return string(out), fmt.Errorf("failed to run compiler: %w", err)
+	}
+
+	if err := security.DefaultManager.ValidateExecutable(w.bin); err != nil {
+		return string(out), fmt.Errorf("executable validation failed: %w", err)
+	}
+	return string(out), nil
+}
+
+// Command returns the sandboxed command running the compiled program in the
+// read-only workspace. The caller wires its streams and calls cleanup after
+// it exits.
+func (w *Workspace) Command(ctx context.Context) (*exec.Cmd, func(), error) {
+	cmd, cleanup, err := security.DefaultManager.CreateWorkspaceCommand(ctx, w.Dir, true, w.bin)
+	if err != nil {
+		return nil, nil, fmt.Errorf("server security configuration error creating execution sandbox: %w", err)
+	}
+	cmd.Dir = w.Dir
+	return cmd, cleanup, nil
+}
+
+// RunResult is the outcome of a non-interactive run. Each stream is capped at
+// MaxOutputSize.
+type RunResult struct {
+	Stdout string
+	Stderr string
+	Err    error // Exit or signal of the program, or a sandbox failure
+}
+
+// Run runs the compiled program feeding input on stdin.
+func (w *Workspace) Run(ctx context.Context, input string) RunResult {
+	cmd, cleanup, err := w.Command(ctx)
+	if err != nil {
+		return RunResult{Err: err}
+	}
+	defer cleanup()
+
+	if input != "" {
+		if !strings.HasSuffix(input, "\n") {
+			input += "\n"
+		}
+		cmd.Stdin = strings.NewReader(input)
+	}
+	stdout := &LimitedWriter{limit: MaxOutputSize}
+	stderr := &LimitedWriter{limit: MaxOutputSize}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err = cmd.Run()
+	return RunResult{Stdout: stdout.String(), Stderr: stderr.String(), Err: err}
+}
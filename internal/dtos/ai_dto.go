@@ -0,0 +1,38 @@
+package dtos
+
+type UpdateAIBudgetRequest struct {
+	DailyRequests int `json:"dailyRequests" binding:"min=0"`
+	DailyTokens   int `json:"dailyTokens" binding:"min=0"`
+}
+
+type AIBudgetResponse struct {
+	DailyRequests int `json:"dailyRequests"`
+	DailyTokens   int `json:"dailyTokens"`
+}
+
+type AIUserUsage struct {
+	UserID   uint             `json:"userId"`
+	UserName string           `json:"userName"`
+	Requests int              `json:"requests"`
+	Tokens   int              `json:"tokens"`
+	Budget   AIBudgetResponse `json:"budget" gorm:"-"`
+}
+
+type AIProviderUsage struct {
+	Provider     string  `json:"provider"`
+	Task         string  `json:"task"`
+	Requests     int     `json:"requests"`
+	Tokens       int     `json:"tokens"`
+	AvgLatencyMs float64 `json:"avgLatencyMs"`
+	Failures     int     `json:"failures"`
+}
+
+type AIUsageResponse struct {
+	Since     string            `json:"since"`
+	Users     []AIUserUsage     `json:"users"`
+	Providers []AIProviderUsage `json:"providers"`
+}
+
+type UpdatePromptRequest struct {
+	Body string `json:"body" binding:"required"`
+}
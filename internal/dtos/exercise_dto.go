@@ -4,27 +4,52 @@ import (
 	"time"
 )
 
+type RubricCriterionRequest struct {
+	Description string  `json:"description" binding:"required"`
+	Points      float64 `json:"points" binding:"required,gt=0"`
+}
+
+type RubricCriterionResponse struct {
+	ID          uint    `json:"id"`
+	Description string  `json:"description"`
+	Points      float64 `json:"points"`
+}
+
+type UpdateRubricRequest struct {
+	Rubric []RubricCriterionRequest `json:"rubric" binding:"dive"`
+}
+
 type CreateExerciseRequest struct {
-	TopicID        *uint   `json:"topicId"`
-	Title          string  `json:"title" binding:"required"`
-	Description    string  `json:"description" binding:"required"`
-	ExpectedOutput string  `json:"expectedOutput"`
-	InitialCode    string  `json:"initialCode"`
-	ExamMaxNote    float64 `json:"examMaxNote"`
-	VariantGroupID string  `json:"variantGroupId"`
+	TopicID        *uint                    `json:"topicId"`
+	Title          string                   `json:"title" binding:"required"`
+	Description    string                   `json:"description" binding:"required"`
+	ExpectedOutput string                   `json:"expectedOutput"`
+	InitialCode    string                   `json:"initialCode"`
+	ExamMaxNote    float64                  `json:"examMaxNote"`
+	MaxHintLevel   *int                     `json:"maxHintLevel" binding:"omitempty,min=0,max=3"` // Default models.DefaultMaxHintLevel
+	VariantGroupID string                   `json:"variantGroupId"`
+	Concept        string                   `json:"concept"`
+	Difficulty     string                   `json:"difficulty" binding:"omitempty,oneof=easy medium hard"`
+	Rubric         []RubricCriterionRequest `json:"rubric" binding:"omitempty,dive"`
+	// ReferenceSolution is stored for test case generation and never returned.
+	ReferenceSolution string `json:"referenceSolution"`
 }
 
 type ExerciseResponse struct {
-	ID             uint    `json:"id"`
-	ClassroomID    *uint   `json:"classroomId"`
-	TopicID        *uint   `json:"topicId"`
-	Title          string  `json:"title"`
-	Description    string  `json:"description"`
-	ExpectedOutput string  `json:"expectedOutput"`
-	InitialCode    string  `json:"initialCode"`
-	CreatedAt      string  `json:"createdAt"`
-	ExamMaxNote    float64 `json:"examMaxNote"`
-	VariantGroupID string  `json:"variantGroupId"`
+	ID             uint                      `json:"id"`
+	ClassroomID    *uint                     `json:"classroomId"`
+	TopicID        *uint                     `json:"topicId"`
+	Title          string                    `json:"title"`
+	Description    string                    `json:"description"`
+	ExpectedOutput string                    `json:"expectedOutput"`
+	InitialCode    string                    `json:"initialCode"`
+	CreatedAt      string                    `json:"createdAt"`
+	ExamMaxNote    float64                   `json:"examMaxNote"`
+	MaxHintLevel   int                       `json:"maxHintLevel"`
+	VariantGroupID string                    `json:"variantGroupId"`
+	Concept        string                    `json:"concept,omitempty"`
+	Difficulty     string                    `json:"difficulty,omitempty"`
+	Rubric         []RubricCriterionResponse `json:"rubric,omitempty"`
 }
 
 type CreateTopicRequest struct {
@@ -47,3 +72,65 @@ type TopicResponse struct {
 	ExpireDate  *time.Time         `json:"expireDate"`
 	IsExam      bool               `json:"isExam"`
 }
+
+type ReviewHistoryRequest struct {
+	Score    float64 `json:"score"`
+	Feedback string  `json:"feedback"`
+}
+
+type UpdateHintLevelRequest struct {
+	MaxHintLevel *int `json:"maxHintLevel" binding:"required,min=0,max=3"`
+}
+
+type NextHintRequest struct {
+	Level int    `json:"level" binding:"omitempty,min=1,max=3"`
+	Code  string `json:"code"`
+}
+
+type HintUsageResponse struct {
+	UserID   uint   `json:"userId"`
+	UserName string `json:"userName"`
+	MaxLevel int    `json:"maxLevel"`
+	Requests int    `json:"requests"`
+	LastHint string `json:"lastHintAt"`
+}
+
+type GenerateTestCasesRequest struct {
+	Count int `json:"count" binding:"omitempty,min=1,max=20"`
+	// ReferenceSolution replaces the solution stored on the exercise when set.
+	ReferenceSolution string `json:"referenceSolution"`
+}
+
+type ReviewTestCaseRequest struct {
+	Input          *string `json:"input"`
+	ExpectedOutput *string `json:"expectedOutput"`
+	Hidden         *bool   `json:"hidden"`
+}
+
+type TestCaseResponse struct {
+	ID             uint   `json:"id"`
+	ExerciseID     uint   `json:"exerciseId"`
+	Input          string `json:"input"`
+	ExpectedOutput string `json:"expectedOutput"`
+	Category       string `json:"category"`
+	Rationale      string `json:"rationale"`
+	Status         string `json:"status"`
+	Source         string `json:"source"`
+	Verified       bool   `json:"verified"`
+	Hidden         bool   `json:"hidden"`
+	RunError       string `json:"runError,omitempty"`
+}
+
+type SyllabusWeekRequest struct {
+	Week     int      `json:"week" binding:"required,min=1"`
+	Concepts []string `json:"concepts" binding:"required,min=1,dive,required"`
+}
+
+type UpdateSyllabusRequest struct {
+	Weeks []SyllabusWeekRequest `json:"weeks" binding:"dive"`
+}
+
+type SyllabusWeekResponse struct {
+	Week     int      `json:"week"`
+	Concepts []string `json:"concepts"`
+}
@@ -0,0 +1,26 @@
+package dtos
+
+type RegradeDiff struct {
+	HistoryID     uint    `json:"historyId"`
+	UserID        uint    `json:"userId"`
+	UserName      string  `json:"userName"`
+	ExerciseID    *uint   `json:"exerciseId"`
+	ExerciseTitle string  `json:"exerciseTitle"`
+	OldScore      float64 `json:"oldScore"`
+	NewScore      float64 `json:"newScore"`
+	Delta         float64 `json:"delta"`
+	OldFeedback   string  `json:"oldFeedback"`
+	NewFeedback   string  `json:"newFeedback"`
+	Error         string  `json:"error,omitempty"`
+}
+
+type RegradeJobResponse struct {
+	ID        uint          `json:"id"`
+	TopicID   uint          `json:"topicId"`
+	Status    string        `json:"status"`
+	Total     int           `json:"total"`
+	Processed int           `json:"processed"`
+	Changed   int           `json:"changed"`
+	Error     string        `json:"error,omitempty"`
+	Revisions []RegradeDiff `json:"revisions,omitempty"`
+}
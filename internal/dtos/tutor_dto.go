@@ -0,0 +1,7 @@
+package dtos
+
+type TutorMessageRequest struct {
+	ExerciseID uint   `json:"exerciseId"`
+	Code       string `json:"code"`
+	Message    string `json:"message" binding:"required"`
+}
@@ -19,6 +19,7 @@ type LoginMatriculaRequest struct {
 type UpdateProfileRequest struct {
 	Email    string `json:"email" binding:"omitempty,email"`
 	Password string `json:"password" binding:"omitempty,min=4"`
+	Locale   string `json:"locale" binding:"omitempty,oneof=pt en es"`
 }
 
 type UserResponse struct {
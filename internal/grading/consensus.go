@@ -0,0 +1,137 @@
+package grading
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/vitub/CLabServer/internal/ai"
+	"github.com/vitub/CLabServer/internal/models"
+)
+
+type consensusConfig struct {
+	Samples   int
+	Providers []string
+	MaxSpread float64 // Fraction of the maximum score
+}
+
+// loadConsensusConfig reads GRADING_SAMPLES, GRADING_PROVIDERS and GRADING_MAX_SPREAD.
+// With the defaults every submission is graded once by the grading provider.
+func loadConsensusConfig() consensusConfig {
+	cfg := consensusConfig{Samples: 1, MaxSpread: 0.2}
+
+	for _, p := range strings.Split(os.Getenv("GRADING_PROVIDERS"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			cfg.Providers = append(cfg.Providers, p)
+		}
+	}
+	if len(cfg.Providers) == 0 {
+		cfg.Providers = []string{ai.ProviderName(ai.TaskGrading)}
+	}
+
+	if n, err := strconv.Atoi(os.Getenv("GRADING_SAMPLES")); err == nil && n > 0 {
+		cfg.Samples = n
+	}
+	if cfg.Samples < len(cfg.Providers) {
+		cfg.Samples = len(cfg.Providers)
+	}
+
+	if f, err := strconv.ParseFloat(os.Getenv("GRADING_MAX_SPREAD"), 64); err == nil && f >= 0 {
+		cfg.MaxSpread = f
+	}
+	return cfg
+}
+
+// gradeConsensus grades the submission cfg.Samples times, rotating through the
+// configured providers, and keeps the median. Submissions whose samples disagree by
+// more than MaxSpread of the maximum score, that got fewer than two valid
+// samples, or where any sample had to be clamped, are flagged for teacher review.
+func gradeConsensus(cfg consensusConfig, code string, output string, exercise models.Exercise) (Result, error) {
+	results := make([]Result, cfg.Samples)
+	errs := make([]error, cfg.Samples)
+
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Samples; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = gradeOnce(cfg.Providers[i%len(cfg.Providers)], code, output, exercise)
+		}(i)
+	}
+	wg.Wait()
+
+	var valid []Result
+	var samples []models.GradingSample
+	var firstErr error
+	for i := range results {
+		sample := models.GradingSample{Provider: cfg.Providers[i%len(cfg.Providers)]}
+		if errs[i] != nil {
+			sample.Error = errs[i].Error()
+			if firstErr == nil {
+				firstErr = errs[i]
+			}
+		} else {
+			sample.Score = results[i].Score
+			sample.Feedback = results[i].Feedback
+			valid = append(valid, results[i])
+		}
+		samples = append(samples, sample)
+	}
+	if len(valid) == 0 {
+		return Result{}, fmt.Errorf("all %d grading samples failed: %w", cfg.Samples, firstErr)
+	}
+
+	scores := make([]float64, len(valid))
+	for i, r := range valid {
+		scores[i] = r.Score
+	}
+
+	// Every sample saw the same sanitized submission, so their detections agree
+	result := Result{Samples: samples, PromptVersion: valid[0].PromptVersion, IntegrityEvents: valid[0].IntegrityEvents}
+	if len(exercise.Rubric) == 0 {
+		result.Score = median(scores)
+	} else {
+		for c := range valid[0].RubricScores {
+			points := make([]float64, len(valid))
+			for i, r := range valid {
+				points[i] = r.RubricScores[c].Points
+			}
+			score := valid[0].RubricScores[c]
+			score.Points = median(points)
+			result.RubricScores = append(result.RubricScores, score)
+			result.Score += score.Points
+		}
+	}
+
+	// Report the feedback of the sample that agrees best with the final score
+	closest := valid[0]
+	for _, r := range valid[1:] {
+		if math.Abs(r.Score-result.Score) < math.Abs(closest.Score-result.Score) {
+			closest = r
+		}
+	}
+	result.Feedback = closest.Feedback
+
+	sort.Float64s(scores)
+	spread := scores[len(scores)-1] - scores[0]
+	result.NeedsReview = len(valid) < 2 || spread > cfg.MaxSpread*MaxPoints(exercise)
+	for _, r := range valid {
+		result.NeedsReview = result.NeedsReview || r.NeedsReview
+	}
+
+	return result, nil
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
@@ -0,0 +1,114 @@
+package grading
+
+import (
+	"github.com/vitub/CLabServer/internal/ai"
+	"github.com/vitub/CLabServer/internal/models"
+)
+
+// Result is the outcome of grading one exam submission.
+type Result struct {
+	Score        float64
+	Feedback     string
+	RubricScores []models.RubricScore
+	Samples      []models.GradingSample
+	NeedsReview  bool
+	// PromptVersion identifies the prompt template that produced the grade.
+	PromptVersion string
+	// IntegrityEvents are the injection detections and rejected grades to log on the submission.
+	IntegrityEvents []models.IntegrityEvent
+}
+
+// GradeExam grades a submission that compiled and ran. Exercises with a rubric are
+// graded per criterion; the rest fall back to a single AI score out of ExamMaxNote.
+// When consensus grading is configured the submission is graded several times and
+// aggregated by median. Scores outside the allowed range are clamped and the
+// submission flagged for review. Grades that contradict the program's run are rejected and
+// flagged for review. The exercise must be loaded with its Rubric.
+func GradeExam(code string, output string, exercise models.Exercise) (Result, error) {
+	cfg := loadConsensusConfig()
+	var result Result
+	var err error
+	if cfg.Samples <= 1 {
+		result, err = gradeOnce(cfg.Providers[0], code, output, exercise)
+	} else {
+		result, err = gradeConsensus(cfg, code, output, exercise)
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	checkRunConsistency(&result, code, output, exercise)
+	return result, nil
+}
+
+func gradeOnce(provider string, code string, output string, exercise models.Exercise) (Result, error) {
+	if len(exercise.Rubric) == 0 {
+		grading, err := ai.GetExamGradingAnalysisFrom(provider, code, output, exercise.ExpectedOutput, exercise.ExamMaxNote)
+		if err != nil {
+			return Result{}, err
+		}
+		return Result{
+			Score:           grading.Score,
+			Feedback:        grading.Feedback,
+			PromptVersion:   grading.PromptVersion,
+			IntegrityEvents: detectionEvents(grading.Detections),
+			NeedsReview:     grading.OutOfRange,
+		}, nil
+	}
+
+	rubric := make([]ai.RubricCriterion, 0, len(exercise.Rubric))
+	for _, c := range exercise.Rubric {
+		rubric = append(rubric, ai.RubricCriterion{ID: c.ID, Description: c.Description, Points: c.Points})
+	}
+
+	grading, err := ai.GetRubricGradingAnalysisFrom(provider, code, output, exercise.ExpectedOutput, rubric)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{
+		Score:           grading.Score,
+		Feedback:        grading.Feedback,
+		PromptVersion:   grading.PromptVersion,
+		IntegrityEvents: detectionEvents(grading.Detections),
+		NeedsReview:     grading.OutOfRange,
+	}
+	for _, c := range grading.Criteria {
+		result.RubricScores = append(result.RubricScores, models.RubricScore{
+			CriterionID:   c.CriterionID,
+			Criterion:     c.Criterion,
+			Points:        c.Score,
+			MaxPoints:     c.MaxPoints,
+			Justification: c.Justification,
+		})
+	}
+	return result, nil
+}
+
+// GradeCompileError grades a submission that failed to compile. Any points the
+// model awards are rejected, since the code never ran.
+func GradeCompileError(code string, errorOutput string) (Result, error) {
+	grading, err := ai.GetExamErrorAnalysis(code, errorOutput)
+	if err != nil {
+		return Result{}, err
+	}
+	result := Result{
+		Score:           grading.Score,
+		Feedback:        grading.Feedback,
+		PromptVersion:   grading.PromptVersion,
+		IntegrityEvents: detectionEvents(grading.Detections),
+	}
+	checkCompileConsistency(&result)
+	return result, nil
+}
+
+// MaxPoints is the highest score a submission to the exercise can receive.
+func MaxPoints(exercise models.Exercise) float64 {
+	if len(exercise.Rubric) == 0 {
+		return exercise.ExamMaxNote
+	}
+	var total float64
+	for _, c := range exercise.Rubric {
+		total += c.Points
+	}
+	return total
+}
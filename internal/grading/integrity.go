@@ -0,0 +1,162 @@
+package grading
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vitub/CLabServer/internal/ai"
+	"github.com/vitub/CLabServer/internal/compiler"
+	"github.com/vitub/CLabServer/internal/initializers"
+	"github.com/vitub/CLabServer/internal/models"
+)
+
+// detectionEvents turns the detector findings reported by the grader into
+// integrity events. String literals in the code reach the prompt escaped;
+// instructions in the output could only be fenced.
+func detectionEvents(detections []ai.Detection) []models.IntegrityEvent {
+	events := make([]models.IntegrityEvent, 0, len(detections))
+	for _, d := range detections {
+		action := models.IntegrityRedacted
+		if d.Source == ai.SourceOutput || d.Source == ai.SourceErrorOutput {
+			action = models.IntegrityFlagged
+		}
+		events = append(events, models.IntegrityEvent{
+			Kind:    models.IntegrityPromptInjection,
+			Source:  d.Source,
+			Pattern: d.Pattern,
+			Detail:  d.Snippet,
+			Action:  action,
+		})
+	}
+	return events
+}
+
+// checkRunConsistency holds AI grades to what running the program proved,
+// whatever the injection detector found. A program that printed nothing earns
+// no points on an exercise with an expected output. When the exercise has
+// accepted test cases they are the evidence: the score is capped to the share
+// of cases the program passes. Without them, a scored program whose output
+// differs from the expected output is sent to review; the sample output alone
+// is not enough to cut points.
+func checkRunConsistency(result *Result, code string, output string, exercise models.Exercise) {
+	if result.Score <= 0 {
+		return
+	}
+	expected := normalizeOutput(exercise.ExpectedOutput)
+	if expected != "" && normalizeOutput(output) == "" {
+		rejectScore(result, "o programa não produziu saída, mas a saída esperada não é vazia")
+		return
+	}
+
+	if cases := runTestCases(code, exercise.ID); len(cases) > 0 {
+		var failed []uint
+		for _, tc := range cases {
+			if !tc.passed {
+				failed = append(failed, tc.caseID)
+			}
+		}
+		supported := MaxPoints(exercise) * float64(len(cases)-len(failed)) / float64(len(cases))
+		if len(failed) > 0 && result.Score > supported {
+			capScore(result, supported, fmt.Sprintf("o programa falha em %d de %d casos de teste aceitos (primeiro: caso %d)", len(failed), len(cases), failed[0]))
+		}
+		return
+	}
+
+	if expected != "" && normalizeOutput(output) != expected {
+		flagScore(result, "a saída do programa difere da saída esperada")
+	}
+}
+
+// caseOutcome is the result of running a submission on one accepted test case.
+type caseOutcome struct {
+	caseID uint
+	passed bool
+}
+
+// runTestCases runs the code on the exercise's accepted test cases, compiling
+// it once. A case passes when the output matches its expected output. It
+// returns nil when there are no cases or the code could not be run, so the
+// grade is left to the other checks. Tests replace it to avoid the sandbox.
+var runTestCases = func(code string, exerciseID uint) []caseOutcome {
+	var cases []models.TestCase
+	initializers.DB.Where("exercise_id = ? AND status = ?", exerciseID, models.TestCaseAccepted).Order("id").Find(&cases)
+	if len(cases) == 0 {
+		return nil
+	}
+	inputs := make([]string, len(cases))
+	for i, tc := range cases {
+		inputs[i] = tc.Input
+	}
+	compileError, results, err := compiler.ExecuteCases(code, inputs, runTimeout)
+	if err != nil || compileError != "" {
+		return nil
+	}
+	outcomes := make([]caseOutcome, len(results))
+	for i, r := range results {
+		outcomes[i] = caseOutcome{
+			caseID: cases[i].ID,
+			passed: normalizeOutput(r.Stdout) == normalizeOutput(cases[i].ExpectedOutput),
+		}
+	}
+	return outcomes
+}
+
+// checkCompileConsistency rejects any points given to code that did not compile.
+func checkCompileConsistency(result *Result) {
+	if result.Score > 0 {
+		rejectScore(result, "o código não compilou")
+	}
+}
+
+func rejectScore(result *Result, reason string) {
+	result.IntegrityEvents = append(result.IntegrityEvents, models.IntegrityEvent{
+		Kind:   models.IntegrityContradiction,
+		Source: "grader",
+		Detail: fmt.Sprintf("Nota %.2f da IA rejeitada: %s.", result.Score, reason),
+		Action: models.IntegrityRejected,
+	})
+	result.Feedback = fmt.Sprintf("[Nota da IA rejeitada: %s. Revise manualmente.]\n\n%s", reason, result.Feedback)
+	result.Score = 0
+	for i := range result.RubricScores {
+		result.RubricScores[i].Points = 0
+	}
+	result.NeedsReview = true
+}
+
+// capScore lowers the score, and the rubric points in proportion, to what the
+// test cases support and sends the submission to review.
+func capScore(result *Result, supported float64, reason string) {
+	result.IntegrityEvents = append(result.IntegrityEvents, models.IntegrityEvent{
+		Kind:   models.IntegrityContradiction,
+		Source: "grader",
+		Detail: fmt.Sprintf("Nota %.2f da IA limitada a %.2f: %s.", result.Score, supported, reason),
+		Action: models.IntegrityCapped,
+	})
+	result.Feedback = fmt.Sprintf("[Nota da IA limitada a %.2f: %s. Revise manualmente.]\n\n%s", supported, reason, result.Feedback)
+	ratio := supported / result.Score
+	for i := range result.RubricScores {
+		result.RubricScores[i].Points *= ratio
+	}
+	result.Score = supported
+	result.NeedsReview = true
+}
+
+// flagScore keeps the score but sends the submission to review.
+func flagScore(result *Result, reason string) {
+	result.IntegrityEvents = append(result.IntegrityEvents, models.IntegrityEvent{
+		Kind:   models.IntegrityContradiction,
+		Source: "grader",
+		Detail: fmt.Sprintf("Nota %.2f da IA mantida para revisão: %s.", result.Score, reason),
+		Action: models.IntegrityFlagged,
+	})
+	result.Feedback = fmt.Sprintf("[Nota da IA mantida para revisão: %s. Revise manualmente.]\n\n%s", reason, result.Feedback)
+	result.NeedsReview = true
+}
+
+func normalizeOutput(output string) string {
+	lines := strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
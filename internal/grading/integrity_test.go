@@ -0,0 +1,72 @@
+package grading
+
+import (
+	"testing"
+
+	"github.com/vitub/CLabServer/internal/models"
+)
+
+func TestCheckRunConsistency(t *testing.T) {
+	injection := []models.IntegrityEvent{{Kind: models.IntegrityPromptInjection, Action: models.IntegrityFlagged}}
+	outcomes := func(passed ...bool) []caseOutcome {
+		cases := make([]caseOutcome, len(passed))
+		for i, p := range passed {
+			cases[i] = caseOutcome{caseID: uint(i + 1), passed: p}
+		}
+		return cases
+	}
+
+	tests := []struct {
+		name       string
+		score      float64
+		events     []models.IntegrityEvent
+		expected   string
+		output     string
+		cases      []caseOutcome
+		wantScore  float64
+		wantReview bool
+		wantAction string // action of the contradiction event, "" for none
+	}{
+		{"max score failing a case without detection", 10, nil, "7", "7", outcomes(true, false, true, true), 7.5, true, models.IntegrityCapped},
+		{"below max failing cases with detection", 9, injection, "7", "7", outcomes(true, false), 5, true, models.IntegrityCapped},
+		{"below max failing cases without detection", 8, nil, "", "7", outcomes(false, false, true, true), 5, true, models.IntegrityCapped},
+		{"score the cases support", 6, nil, "7", "7", outcomes(true, false, true, true), 6, false, ""},
+		{"every case passes", 10, injection, "7", "8", outcomes(true, true), 10, false, ""},
+		{"output differs without cases or detection", 9, nil, "7", "8", nil, 9, true, models.IntegrityFlagged},
+		{"output differs below max", 4, nil, "7", "8", nil, 4, true, models.IntegrityFlagged},
+		{"output matches without cases", 10, injection, "7\n", "7  \n", nil, 10, false, ""},
+		{"no output", 5, nil, "7", "", outcomes(false), 0, true, models.IntegrityRejected},
+		{"no points", 0, nil, "7", "8", outcomes(false), 0, false, ""},
+	}
+	defer func(run func(string, uint) []caseOutcome) { runTestCases = run }(runTestCases)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runTestCases = func(string, uint) []caseOutcome { return tt.cases }
+			result := Result{Score: tt.score, IntegrityEvents: append([]models.IntegrityEvent(nil), tt.events...)}
+			exercise := models.Exercise{ExpectedOutput: tt.expected, ExamMaxNote: 10}
+
+			checkRunConsistency(&result, "int main() {}", tt.output, exercise)
+
+			if result.Score != tt.wantScore || result.NeedsReview != tt.wantReview {
+				t.Errorf("score %.2f, review %v; want %.2f, %v", result.Score, result.NeedsReview, tt.wantScore, tt.wantReview)
+			}
+			var action string
+			for _, e := range result.IntegrityEvents {
+				if e.Kind == models.IntegrityContradiction {
+					action = e.Action
+				}
+			}
+			if action != tt.wantAction {
+				t.Errorf("contradiction action = %q, want %q", action, tt.wantAction)
+			}
+		})
+	}
+}
+
+func TestCapScoreScalesRubric(t *testing.T) {
+	result := Result{Score: 8, RubricScores: []models.RubricScore{{Points: 6}, {Points: 2}}}
+	capScore(&result, 4, "falha")
+	if result.RubricScores[0].Points != 3 || result.RubricScores[1].Points != 1 {
+		t.Errorf("rubric points = %.2f, %.2f; want 3, 1", result.RubricScores[0].Points, result.RubricScores[1].Points)
+	}
+}
@@ -0,0 +1,235 @@
+package grading
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/vitub/CLabServer/internal/compiler"
+	"github.com/vitub/CLabServer/internal/initializers"
+	"github.com/vitub/CLabServer/internal/models"
+	"gorm.io/gorm"
+)
+
+const runTimeout = 10 * time.Second
+
+// FinalSubmissions returns the latest History entry of every student for each exercise of the topic.
+func FinalSubmissions(topicID uint) ([]models.History, error) {
+	var histories []models.History
+	err := initializers.DB.Preload("Exercise.Rubric").
+		Joins("JOIN exercises ON exercises.id = histories.exercise_id").
+		Where("exercises.topic_id = ?", topicID).
+		Order("histories.created_at desc").
+		Find(&histories).Error
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var finals []models.History
+	for _, h := range histories {
+		key := fmt.Sprintf("%d-%d", h.UserID, *h.ExerciseID)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		finals = append(finals, h)
+	}
+	return finals, nil
+}
+
+// StartRegrade creates a RegradeJob for the topic and processes it in the background.
+func StartRegrade(topicID uint, teacherID uint) (*models.RegradeJob, error) {
+	submissions, err := FinalSubmissions(topicID)
+	if err != nil {
+		return nil, err
+	}
+
+	job := models.RegradeJob{
+		TopicID:   topicID,
+		TeacherID: teacherID,
+		Status:    models.RegradeRunning,
+		Total:     len(submissions),
+	}
+	if err := initializers.DB.Create(&job).Error; err != nil {
+		return nil, err
+	}
+
+	go runRegrade(job.ID, submissions)
+	return &job, nil
+}
+
+func runRegrade(jobID uint, submissions []models.History) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Regrade job %d panicked: %v", jobID, r)
+			initializers.DB.Model(&models.RegradeJob{}).Where("id = ?", jobID).
+				Updates(map[string]interface{}{"status": models.RegradeFailed, "error": fmt.Sprint(r)})
+		}
+	}()
+
+	for i, h := range submissions {
+		revision := regradeSubmission(h)
+		revision.JobID = jobID
+		if err := initializers.DB.Create(&revision).Error; err != nil {
+			log.Printf("Regrade job %d: failed to save revision for history %d: %v", jobID, h.ID, err)
+		}
+		initializers.DB.Model(&models.RegradeJob{}).Where("id = ?", jobID).Update("processed", i+1)
+	}
+
+	initializers.DB.Model(&models.RegradeJob{}).Where("id = ?", jobID).Update("status", models.RegradeCompleted)
+	log.Printf("Regrade job %d completed (%d submissions)", jobID, len(submissions))
+}
+
+func regradeSubmission(h models.History) models.GradingRevision {
+	revision := models.GradingRevision{
+		HistoryID:   h.ID,
+		OldScore:    h.Score,
+		OldFeedback: h.TeacherGrading,
+		NewScore:    h.Score,
+		NewFeedback: h.TeacherGrading,
+	}
+	if h.Exercise == nil {
+		revision.Error = "exercise not found"
+		return revision
+	}
+
+	result := compiler.Execute(h.Code, h.Input, runTimeout)
+	if result.CompileError != "" {
+		revision.Output = result.CompileError
+		grading, err := GradeCompileError(h.Code, result.CompileError)
+		if err != nil {
+			revision.Error = err.Error()
+			return revision
+		}
+		revision.NewScore = grading.Score
+		revision.NewFeedback = grading.Feedback
+		revision.NeedsReview = grading.NeedsReview
+		revision.PromptVersion = grading.PromptVersion
+		setIntegrityJSON(&revision, grading.IntegrityEvents)
+		return revision
+	}
+
+	revision.Output = result.Stdout
+	revision.Stderr = result.Stderr
+	if len(result.Stdout) > 20000 {
+		revision.NewScore = 0
+		revision.NewFeedback = "Erro na correção automática: Saída muito longa excedeu o limite de tokens."
+		return revision
+	}
+
+	grading, err := GradeExam(h.Code, result.Stdout, *h.Exercise)
+	if err != nil {
+		revision.Error = err.Error()
+		return revision
+	}
+	revision.NewScore = grading.Score
+	revision.NewFeedback = grading.Feedback
+	revision.NeedsReview = grading.NeedsReview
+	revision.PromptVersion = grading.PromptVersion
+	if len(grading.RubricScores) > 0 {
+		rubricJSON, _ := json.Marshal(grading.RubricScores)
+		revision.RubricJSON = string(rubricJSON)
+	}
+	if len(grading.Samples) > 0 {
+		samplesJSON, _ := json.Marshal(grading.Samples)
+		revision.SamplesJSON = string(samplesJSON)
+	}
+	setIntegrityJSON(&revision, grading.IntegrityEvents)
+	return revision
+}
+
+func setIntegrityJSON(revision *models.GradingRevision, events []models.IntegrityEvent) {
+	if len(events) > 0 {
+		integrityJSON, _ := json.Marshal(events)
+		revision.IntegrityJSON = string(integrityJSON)
+	}
+}
+
+// Publish copies every revision of a completed job onto its History entry.
+func Publish(job *models.RegradeJob) error {
+	var revisions []models.GradingRevision
+	if err := initializers.DB.Where("job_id = ?", job.ID).Find(&revisions).Error; err != nil {
+		return err
+	}
+
+	tx := initializers.DB.Begin()
+	for _, r := range revisions {
+		if r.Error != "" {
+			continue
+		}
+		if err := publishRevision(tx, r); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Model(job).Update("status", models.RegradePublished).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+func publishRevision(tx *gorm.DB, r models.GradingRevision) error {
+	if err := tx.Model(&models.History{}).Where("id = ?", r.HistoryID).Updates(map[string]interface{}{
+		"score":           r.NewScore,
+		"teacher_grading": r.NewFeedback,
+		"needs_review":    r.NeedsReview,
+		"prompt_version":  r.PromptVersion,
+	}).Error; err != nil {
+		return err
+	}
+
+	if r.RubricJSON != "" {
+		var scores []models.RubricScore
+		if err := json.Unmarshal([]byte(r.RubricJSON), &scores); err != nil {
+			return err
+		}
+		if err := tx.Where("history_id = ?", r.HistoryID).Delete(&models.RubricScore{}).Error; err != nil {
+			return err
+		}
+		for i := range scores {
+			scores[i].HistoryID = r.HistoryID
+		}
+		if err := tx.Create(&scores).Error; err != nil {
+			return err
+		}
+	}
+
+	if r.SamplesJSON != "" {
+		var samples []models.GradingSample
+		if err := json.Unmarshal([]byte(r.SamplesJSON), &samples); err != nil {
+			return err
+		}
+		if err := tx.Where("history_id = ?", r.HistoryID).Delete(&models.GradingSample{}).Error; err != nil {
+			return err
+		}
+		for i := range samples {
+			samples[i].HistoryID = r.HistoryID
+		}
+		if err := tx.Create(&samples).Error; err != nil {
+			return err
+		}
+	}
+
+	if r.IntegrityJSON != "" {
+		var events []models.IntegrityEvent
+		if err := json.Unmarshal([]byte(r.IntegrityJSON), &events); err != nil {
+			return err
+		}
+		for i := range events {
+			events[i].HistoryID = r.HistoryID
+		}
+		if err := tx.Create(&events).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FailInterruptedJobs marks jobs left running by a previous server process as failed.
+func FailInterruptedJobs() {
+	initializers.DB.Model(&models.RegradeJob{}).Where("status = ?", models.RegradeRunning).
+		Updates(map[string]interface{}{"status": models.RegradeFailed, "error": "interrupted by server restart"})
+}
@@ -0,0 +1,99 @@
+package grading
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/vitub/CLabServer/internal/ai"
+	"github.com/vitub/CLabServer/internal/compiler"
+	"github.com/vitub/CLabServer/internal/initializers"
+	"github.com/vitub/CLabServer/internal/models"
+)
+
+// ReferenceCompileError is returned by GenerateTestCases when the exercise's
+// reference solution does not compile. Output is the compiler's message.
+type ReferenceCompileError struct {
+	Output string
+}
+
+func (e *ReferenceCompileError) Error() string {
+	return "reference solution does not compile: " + e.Output
+}
+
+// GenerateTestCases asks the AI for count edge-case inputs for the exercise and
+// stores them as PENDING candidates for the teacher to review. When the exercise
+// has a reference solution it is compiled once, before the AI is asked, and each
+// input is run through that binary in the sandbox; its output becomes the
+// expected output. Otherwise the model's guess is kept unverified.
+func GenerateTestCases(ctx context.Context, exercise models.Exercise, count int) ([]models.TestCase, error) {
+	var reference *compiler.Workspace
+	if strings.TrimSpace(exercise.ReferenceSolution) != "" {
+		workspace, err := compileReference(ctx, exercise.ReferenceSolution)
+		if err != nil {
+			return nil, err
+		}
+		defer workspace.Close()
+		reference = workspace
+	}
+
+	generated, err := ai.GenerateTestCases(ctx, exercise.Title, exercise.Description, exercise.ExpectedOutput, count)
+	if err != nil {
+		return nil, err
+	}
+
+	cases := make([]models.TestCase, 0, len(generated))
+	for _, g := range generated {
+		tc := models.TestCase{
+			ExerciseID:     exercise.ID,
+			Input:          g.Input,
+			ExpectedOutput: g.ExpectedOutput,
+			Category:       g.Category,
+			Rationale:      g.Rationale,
+			Status:         models.TestCasePending,
+			Source:         models.TestCaseSourceAI,
+			Hidden:         true,
+		}
+
+		if reference != nil {
+			runCtx, cancel := context.WithTimeout(ctx, runTimeout)
+			result := reference.Run(runCtx, g.Input)
+			cancel()
+			if result.Err != nil {
+				tc.RunError = result.Err.Error()
+			} else {
+				tc.ExpectedOutput = result.Stdout
+				tc.Verified = true
+			}
+		}
+		cases = append(cases, tc)
+	}
+
+	if len(cases) > 0 {
+		if err := initializers.DB.Create(&cases).Error; err != nil {
+			return nil, err
+		}
+	}
+	return cases, nil
+}
+
+// compileReference builds the reference solution in a workspace the caller
+// closes. A compilation failure is returned as a *ReferenceCompileError.
+func compileReference(ctx context.Context, code string) (*compiler.Workspace, error) {
+	workspace, err := compiler.NewWorkspace(code)
+	if err != nil {
+		return nil, err
+	}
+	compileCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	output, err := workspace.Compile(compileCtx)
+	if err != nil {
+		workspace.Close()
+		if errors.Is(err, compiler.ErrCompilation) {
+			return nil, &ReferenceCompileError{Output: output}
+		}
+		return nil, err
+	}
+	return workspace, nil
+}
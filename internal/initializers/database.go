@@ -20,7 +20,7 @@ func ConnectToDB() error {
 		log.Fatal("Failed to connect to database: ", err)
 	}
 
-	if err := DB.AutoMigrate(&models.User{}, &models.Classroom{}, &models.History{}, &models.Exercise{}, &models.ExerciseTopic{}, &models.ExamFolder{}); err != nil {
+	if err := DB.AutoMigrate(&models.User{}, &models.Classroom{}, &models.History{}, &models.Exercise{}, &models.ExerciseTopic{}, &models.ExamFolder{}, &models.RegradeJob{}, &models.GradingRevision{}, &models.RubricCriterion{}, &models.RubricScore{}, &models.GradingSample{}, &models.TutorConversation{}, &models.TutorMessage{}, &models.HintRequest{}, &models.AICacheEntry{}, &models.AIUsage{}, &models.AIBudget{}, &models.PromptOverride{}, &models.IntegrityEvent{}, &models.TestCase{}, &models.SyllabusConcept{}, &models.TeacherAction{}, &models.TerminalRecording{}, &models.WSBrokerMessage{}, &models.Presence{}); err != nil {
 		return err
 	}
 
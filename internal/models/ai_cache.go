@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// AICacheEntry is a cached AI response shared by submissions with the same
+// normalized code and output.
+type AICacheEntry struct {
+	Key       string    `gorm:"primaryKey;size:64"`
+	Response  string    `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time `gorm:"index"`
+}
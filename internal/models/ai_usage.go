@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	BudgetScopeUser      = "user"
+	BudgetScopeClassroom = "classroom"
+)
+
+// AIUsage records one model call. UserID is nil for anonymous users and for
+// system calls such as exam grading. ClassroomID is the classroom the user was
+// working in, whose quota the call counts against.
+type AIUsage struct {
+	ID            uint      `gorm:"primarykey" json:"id"`
+	CreatedAt     time.Time `gorm:"index" json:"createdAt"`
+	UserID        *uint     `gorm:"index" json:"userId"`
+	ClassroomID   *uint     `gorm:"index" json:"classroomId"`
+	Anonymous     bool      `json:"anonymous"`
+	Task          string    `json:"task"`
+	Provider      string    `json:"provider"`
+	Model         string    `json:"model"`
+	PromptChars   int       `json:"promptChars"`
+	ResponseChars int       `json:"responseChars"`
+	Tokens        int       `json:"tokens"`
+	LatencyMs     int64     `json:"latencyMs"`
+	Success       bool      `json:"success"`
+}
+
+// AIBudget overrides the default daily AI budget of a user or classroom.
+// A zero limit means unlimited.
+type AIBudget struct {
+	gorm.Model
+	Scope         string `json:"scope" gorm:"uniqueIndex:idx_ai_budget_scope;not null"`
+	ScopeID       uint   `json:"scopeId" gorm:"uniqueIndex:idx_ai_budget_scope;not null"`
+	DailyRequests int    `json:"dailyRequests"`
+	DailyTokens   int    `json:"dailyTokens"`
+}
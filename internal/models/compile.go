@@ -8,7 +8,8 @@ type CompileRequest struct {
 }
 
 type CompileResponse struct {
-	Output   string `json:"output,omitempty"`
+	Output   string `json:"output,omitempty"` // Program stdout
+	Stderr   string `json:"stderr,omitempty"`
 	Error    string `json:"error,omitempty"`
 	Analysis string `json:"analysis,omitempty"`
 }
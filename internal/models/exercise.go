@@ -4,16 +4,28 @@ import (
 	"gorm.io/gorm"
 )
 
+// DefaultMaxHintLevel is the hint level new exercises allow when the teacher
+// does not choose one: every level up to the partial fix.
+const DefaultMaxHintLevel = 3
+
 type Exercise struct {
 	gorm.Model
-	ClassroomID    *uint          `json:"classroomId"`
-	Classroom      *Classroom     `json:"classroom,omitempty" gorm:"foreignKey:ClassroomID"`
-	TopicID        *uint          `json:"topicId"`
-	Topic          *ExerciseTopic `json:"topic,omitempty" gorm:"foreignKey:TopicID"`
-	Title          string         `json:"title" gorm:"not null"`
-	Description    string         `json:"description"`
-	ExpectedOutput string         `json:"expectedOutput"`
-	InitialCode    string         `json:"initialCode"`
-	ExamMaxNote    float64        `json:"examMaxNote" gorm:"default:10.0"`
-	VariantGroupID string         `json:"variantGroupId"`
+	ClassroomID    *uint             `json:"classroomId"`
+	Classroom      *Classroom        `json:"classroom,omitempty" gorm:"foreignKey:ClassroomID"`
+	TopicID        *uint             `json:"topicId"`
+	Topic          *ExerciseTopic    `json:"topic,omitempty" gorm:"foreignKey:TopicID"`
+	Title          string            `json:"title" gorm:"not null"`
+	Description    string            `json:"description"`
+	ExpectedOutput string            `json:"expectedOutput"`
+	InitialCode    string            `json:"initialCode"`
+	ExamMaxNote    float64           `json:"examMaxNote" gorm:"default:10.0"`
+	MaxHintLevel   int               `json:"maxHintLevel" gorm:"default:3"` // DefaultMaxHintLevel; 0 disables hints
+	VariantGroupID string            `json:"variantGroupId"`
+	Concept        string            `json:"concept"`    // Syllabus concept the exercise practices
+	Difficulty     string            `json:"difficulty"` // easy, medium or hard
+	Rubric         []RubricCriterion `json:"rubric,omitempty" gorm:"foreignKey:ExerciseID"`
+	// ReferenceSolution is the teacher's solution, run in the sandbox to produce
+	// expected outputs for test cases. Never sent to students.
+	ReferenceSolution string     `json:"-"`
+	TestCases         []TestCase `json:"-" gorm:"foreignKey:ExerciseID"`
 }
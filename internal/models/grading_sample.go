@@ -0,0 +1,14 @@
+package models
+
+import "gorm.io/gorm"
+
+// GradingSample is one of the independent AI gradings aggregated by consensus grading.
+// Samples are kept so teachers can see how much the model disagreed with itself.
+type GradingSample struct {
+	gorm.Model
+	HistoryID uint    `json:"historyId" gorm:"index;not null"`
+	Provider  string  `json:"provider"`
+	Score     float64 `json:"score"`
+	Feedback  string  `json:"feedback"`
+	Error     string  `json:"error,omitempty"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "gorm.io/gorm"
+
+// HintRequest logs every hint a student asked for on an exercise.
+type HintRequest struct {
+	gorm.Model
+	UserID     uint     `json:"userId" gorm:"index;not null"`
+	User       User     `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	ExerciseID uint     `json:"exerciseId" gorm:"index;not null"`
+	Exercise   Exercise `json:"-" gorm:"foreignKey:ExerciseID"`
+	Level      int      `json:"level" gorm:"not null"`
+	Code       string   `json:"code"`
+	Hint       string   `json:"hint"`
+}
@@ -7,20 +7,28 @@ import (
 )
 
 type History struct {
-	ID             uint      `gorm:"primarykey"`
-	CreatedAt      time.Time `gorm:"index"`
-	UpdatedAt      time.Time
-	DeletedAt      gorm.DeletedAt `gorm:"index"`
-	UserID         uint           `gorm:"index"`
-	User           User           `json:"user" gorm:"foreignKey:UserID"`
-	ExerciseID     *uint          `json:"exerciseId,omitempty" gorm:"index"`
-	Exercise       *Exercise      `json:"exercise,omitempty" gorm:"foreignKey:ExerciseID"`
-	Code           string         `json:"code"`
-	Input          string         `json:"input"`
-	Output         string         `json:"output"`
-	Error          string         `json:"error"`
-	AIAnalysis     string         `json:"aiAnalysis"`
-	TeacherGrading string         `json:"teacherGrading"`
-	Score          float64        `json:"score"`
-	IsSuccess      bool           `json:"isSuccess"`
+	ID              uint      `gorm:"primarykey"`
+	CreatedAt       time.Time `gorm:"index"`
+	UpdatedAt       time.Time
+	DeletedAt       gorm.DeletedAt   `gorm:"index"`
+	UserID          uint             `gorm:"index"`
+	User            User             `json:"user" gorm:"foreignKey:UserID"`
+	ExerciseID      *uint            `json:"exerciseId,omitempty" gorm:"index"`
+	Exercise        *Exercise        `json:"exercise,omitempty" gorm:"foreignKey:ExerciseID"`
+	Code            string           `json:"code"`
+	Input           string           `json:"input"`
+	Output          string           `json:"output"` // Program stdout, compared with the expected output
+	Stderr          string           `json:"stderr"`
+	Error           string           `json:"error"`
+	AIAnalysis      string           `json:"aiAnalysis"`
+	TeacherGrading  string           `json:"teacherGrading"`
+	Score           float64          `json:"score"`
+	IsSuccess       bool             `json:"isSuccess"`
+	NeedsReview     bool             `json:"needsReview" gorm:"default:false"`
+	HintLevel       int              `json:"hintLevel"`                              // Highest hint level used before this submission
+	PromptVersion   string           `json:"promptVersion"`                          // Template version that produced AIAnalysis/TeacherGrading
+	CollabSessionID string           `json:"collabSessionId,omitempty" gorm:"index"` // Pair-programming session the run was shared in
+	RubricScores    []RubricScore    `json:"rubricScores,omitempty" gorm:"foreignKey:HistoryID"`
+	GradingSamples  []GradingSample  `json:"gradingSamples,omitempty" gorm:"foreignKey:HistoryID"`
+	IntegrityEvents []IntegrityEvent `json:"integrityEvents,omitempty" gorm:"foreignKey:HistoryID"`
 }
@@ -0,0 +1,27 @@
+package models
+
+import "gorm.io/gorm"
+
+const (
+	IntegrityPromptInjection = "PROMPT_INJECTION" // Instruction-like text addressed to the grader
+	IntegrityContradiction   = "CONTRADICTION"    // AI grade contradicting the deterministic outcome
+)
+
+// IntegrityEvent records something suspicious found while grading a submission.
+// Events are only appended, so regrades keep the earlier findings.
+type IntegrityEvent struct {
+	gorm.Model
+	HistoryID uint   `json:"historyId" gorm:"index;not null"`
+	Kind      string `json:"kind" gorm:"not null"`
+	Source    string `json:"source"`  // code_comment, string_literal, program_output, error_output or grader
+	Pattern   string `json:"pattern"` // Detector rule that matched
+	Detail    string `json:"detail"`
+	Action    string `json:"action"` // REDACTED, FLAGGED, CAPPED or REJECTED
+}
+
+const (
+	IntegrityRedacted = "REDACTED"
+	IntegrityFlagged  = "FLAGGED"
+	IntegrityCapped   = "CAPPED"
+	IntegrityRejected = "REJECTED"
+)
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Presence is one WebSocket session of a logged-in user, shared by all
+// server replicas. A session counts as online while Connected and its
+// LastSeenAt, refreshed by every pong, is recent.
+type Presence struct {
+	SessionID   string    `json:"sessionId" gorm:"primaryKey;size:32"`
+	UserID      uint      `json:"userId" gorm:"index"`
+	ClassroomID uint      `json:"classroomId"` // Active classroom
+	ExerciseID  uint      `json:"exerciseId"`  // Exercise open in the IDE
+	Connected   bool      `json:"connected"`
+	ConnectedAt time.Time `json:"connectedAt"`
+	LastSeenAt  time.Time `json:"lastSeenAt" gorm:"index"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "gorm.io/gorm"
+
+// PromptOverride replaces a built-in AI prompt template without recompiling.
+type PromptOverride struct {
+	gorm.Model
+	Name      string `json:"name" gorm:"uniqueIndex:idx_prompt_override;not null"`
+	Language  string `json:"language" gorm:"uniqueIndex:idx_prompt_override;not null"`
+	Locale    string `json:"locale" gorm:"uniqueIndex:idx_prompt_override;not null"`
+	Body      string `json:"body" gorm:"not null"`
+	UpdatedBy uint   `json:"updatedBy"`
+}
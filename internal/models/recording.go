@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// TerminalRecording is the asciicast v2 recording of the terminal of one
+// interactive run: what the program printed and what the student typed.
+type TerminalRecording struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt" gorm:"index"`
+	HistoryID uint      `json:"historyId" gorm:"uniqueIndex;not null"`
+	UserID    uint      `json:"userId" gorm:"index"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+	Duration  float64   `json:"duration"`  // Seconds
+	Truncated bool      `json:"truncated"` // Events past RECORDING_MAX_BYTES were dropped
+	Cast      string    `json:"-"`
+}
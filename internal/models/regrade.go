@@ -0,0 +1,44 @@
+package models
+
+import "gorm.io/gorm"
+
+const (
+	RegradeRunning   = "RUNNING"
+	RegradeCompleted = "COMPLETED"
+	RegradeFailed    = "FAILED"
+	RegradePublished = "PUBLISHED"
+	RegradeDiscarded = "DISCARDED"
+)
+
+// RegradeJob re-runs every final submission of an exam topic through the sandbox and grader.
+type RegradeJob struct {
+	gorm.Model
+	TopicID   uint              `json:"topicId" gorm:"index;not null"`
+	TeacherID uint              `json:"teacherId" gorm:"not null"`
+	Status    string            `json:"status" gorm:"default:RUNNING;not null"`
+	Total     int               `json:"total"`
+	Processed int               `json:"processed"`
+	Error     string            `json:"error,omitempty"`
+	Revisions []GradingRevision `json:"revisions,omitempty" gorm:"foreignKey:JobID"`
+}
+
+// GradingRevision is a candidate grade for one submission produced by a RegradeJob.
+// It only replaces the History score once the teacher publishes the job.
+type GradingRevision struct {
+	gorm.Model
+	JobID         uint    `json:"jobId" gorm:"index;not null"`
+	HistoryID     uint    `json:"historyId" gorm:"index;not null"`
+	History       History `json:"history,omitempty" gorm:"foreignKey:HistoryID"`
+	OldScore      float64 `json:"oldScore"`
+	NewScore      float64 `json:"newScore"`
+	OldFeedback   string  `json:"oldFeedback"`
+	NewFeedback   string  `json:"newFeedback"`
+	Output        string  `json:"output"`
+	Stderr        string  `json:"stderr,omitempty"`
+	RubricJSON    string  `json:"rubricJson,omitempty"`    // Serialized []RubricScore, applied on publish
+	SamplesJSON   string  `json:"samplesJson,omitempty"`   // Serialized []GradingSample, applied on publish
+	IntegrityJSON string  `json:"integrityJson,omitempty"` // Serialized []IntegrityEvent, appended on publish
+	NeedsReview   bool    `json:"needsReview"`
+	PromptVersion string  `json:"promptVersion"`
+	Error         string  `json:"error"`
+}
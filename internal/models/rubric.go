@@ -0,0 +1,22 @@
+package models
+
+import "gorm.io/gorm"
+
+// RubricCriterion is one scored item of an exercise rubric, e.g. "uses recursion: 3 pts".
+type RubricCriterion struct {
+	gorm.Model
+	ExerciseID  uint    `json:"exerciseId" gorm:"index;not null"`
+	Description string  `json:"description" gorm:"not null"`
+	Points      float64 `json:"points" gorm:"not null"`
+}
+
+// RubricScore is the AI score given to one rubric criterion for a submission.
+type RubricScore struct {
+	gorm.Model
+	HistoryID     uint    `json:"historyId" gorm:"index;not null"`
+	CriterionID   uint    `json:"criterionId"`
+	Criterion     string  `json:"criterion"`
+	Points        float64 `json:"points"`
+	MaxPoints     float64 `json:"maxPoints"`
+	Justification string  `json:"justification"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "gorm.io/gorm"
+
+// SyllabusConcept is one concept taught in a given week of a classroom's course.
+// The generator uses it to target questions and to know what students already studied.
+type SyllabusConcept struct {
+	gorm.Model
+	ClassroomID uint   `json:"classroomId" gorm:"index;not null"`
+	Week        int    `json:"week" gorm:"not null"`
+	Name        string `json:"name" gorm:"not null"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "gorm.io/gorm"
+
+const (
+	TeacherActionWatch    = "WATCH"     // Opened the student's live editor
+	TeacherActionMessage  = "MESSAGE"   // Sent a private message or hint
+	TeacherActionPushCode = "PUSH_CODE" // Replaced or filled the student's editor
+)
+
+// TeacherAction is the audit log of a teacher reaching into a student's IDE
+// over the WebSocket during a lab session.
+type TeacherAction struct {
+	gorm.Model
+	TeacherID   uint   `json:"teacherId" gorm:"index;not null"`
+	StudentID   uint   `json:"studentId" gorm:"index;not null"`
+	ClassroomID uint   `json:"classroomId" gorm:"index;not null"`
+	ExerciseID  *uint  `json:"exerciseId"`
+	Action      string `json:"action" gorm:"not null"`
+	Detail      string `json:"detail"` // Message text or pushed code
+}
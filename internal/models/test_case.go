@@ -0,0 +1,31 @@
+package models
+
+import "gorm.io/gorm"
+
+const (
+	TestCasePending  = "PENDING"  // Candidate waiting for the teacher's review
+	TestCaseAccepted = "ACCEPTED" // Reviewed and part of the exercise
+)
+
+const (
+	TestCaseSourceAI      = "AI"
+	TestCaseSourceTeacher = "TEACHER"
+)
+
+// TestCase is an input and its expected output for an exercise. Cases generated
+// by the AI start as PENDING candidates until the teacher accepts them.
+type TestCase struct {
+	gorm.Model
+	ExerciseID     uint   `json:"exerciseId" gorm:"index;not null"`
+	Input          string `json:"input"`
+	ExpectedOutput string `json:"expectedOutput"`
+	Category       string `json:"category"` // boundary, empty, large, invalid or typical
+	Rationale      string `json:"rationale"`
+	Status         string `json:"status" gorm:"default:PENDING;not null"`
+	Source         string `json:"source" gorm:"default:TEACHER;not null"`
+	// Verified is set when ExpectedOutput came from running the reference solution
+	// rather than from the model.
+	Verified bool   `json:"verified"`
+	Hidden   bool   `json:"hidden" gorm:"default:true"`
+	RunError string `json:"runError,omitempty"`
+}
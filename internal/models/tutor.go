@@ -0,0 +1,26 @@
+package models
+
+import "gorm.io/gorm"
+
+const (
+	TutorRoleStudent = "student"
+	TutorRoleTutor   = "tutor"
+)
+
+// TutorConversation is the chat between a student and the AI tutor about one exercise.
+// ExerciseID is nil for free-practice runs outside any exercise.
+type TutorConversation struct {
+	gorm.Model
+	UserID     uint           `json:"userId" gorm:"index;not null"`
+	User       User           `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	ExerciseID *uint          `json:"exerciseId" gorm:"index"`
+	Exercise   *Exercise      `json:"exercise,omitempty" gorm:"foreignKey:ExerciseID"`
+	Messages   []TutorMessage `json:"messages,omitempty" gorm:"foreignKey:ConversationID"`
+}
+
+type TutorMessage struct {
+	gorm.Model
+	ConversationID uint   `json:"conversationId" gorm:"index;not null"`
+	Role           string `json:"role" gorm:"not null"`
+	Content        string `json:"content"`
+}
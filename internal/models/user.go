@@ -23,6 +23,7 @@ type User struct {
 	Password          string         `gorm:"not null" json:"-"`
 	PasswordChangedAt time.Time      `json:"passwordChangedAt"`
 	Role              string         `gorm:"default:USER;not null" json:"role"`
+	Locale            string         `json:"locale"` // AI prompt locale (pt, en, es); empty uses the server default
 	History           []History      `json:"history"`
 }
 
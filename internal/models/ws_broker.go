@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// WSBrokerMessage holds a hub message too large for a Postgres NOTIFY
+// payload. The notification carries its ID, and rows are dropped after a
+// minute.
+type WSBrokerMessage struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index"`
+	Payload   string    `gorm:"not null"`
+}
@@ -0,0 +1,201 @@
+// Package quota enforces daily AI budgets per user and per classroom and keeps
+// a ledger of every model call.
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/vitub/CLabServer/internal/ai"
+	"github.com/vitub/CLabServer/internal/initializers"
+	"github.com/vitub/CLabServer/internal/models"
+	"gorm.io/gorm"
+)
+
+// ErrQuotaExceeded is wrapped by every error returned when a budget is exhausted.
+var ErrQuotaExceeded = errors.New("cota diária de IA esgotada")
+
+// Budget is a daily limit. Zero means unlimited.
+type Budget struct {
+	DailyRequests int `json:"dailyRequests"`
+	DailyTokens   int `json:"dailyTokens"`
+}
+
+// Consumption is what a user or classroom has used since midnight.
+type Consumption struct {
+	Requests int `json:"requests"`
+	Tokens   int `json:"tokens"`
+}
+
+// Install registers the quota check and usage recorder with the ai package.
+func Install() {
+	ai.SetUsageHooks(ai.UsageHooks{Check: Check, Record: Record})
+}
+
+// DefaultBudget returns the budget applied to a scope without an AIBudget row,
+// read from AI_QUOTA_<SCOPE>_REQUESTS and AI_QUOTA_<SCOPE>_TOKENS.
+func DefaultBudget(scope string) Budget {
+	switch scope {
+	case models.BudgetScopeUser:
+		return Budget{
+			DailyRequests: envInt("AI_QUOTA_USER_REQUESTS", 100),
+			DailyTokens:   envInt("AI_QUOTA_USER_TOKENS", 200000),
+		}
+	case models.BudgetScopeClassroom:
+		return Budget{
+			DailyRequests: envInt("AI_QUOTA_CLASSROOM_REQUESTS", 0),
+			DailyTokens:   envInt("AI_QUOTA_CLASSROOM_TOKENS", 0),
+		}
+	default:
+		return Budget{
+			DailyRequests: envInt("AI_QUOTA_ANONYMOUS_REQUESTS", 200),
+			DailyTokens:   envInt("AI_QUOTA_ANONYMOUS_TOKENS", 400000),
+		}
+	}
+}
+
+// BudgetFor returns the budget of a user or classroom.
+func BudgetFor(scope string, scopeID uint) Budget {
+	var row models.AIBudget
+	if err := initializers.DB.Where("scope = ? AND scope_id = ?", scope, scopeID).First(&row).Error; err == nil {
+		return Budget{DailyRequests: row.DailyRequests, DailyTokens: row.DailyTokens}
+	}
+	return DefaultBudget(scope)
+}
+
+// SetBudget stores a budget override for a user or classroom.
+func SetBudget(scope string, scopeID uint, budget Budget) (*models.AIBudget, error) {
+	var row models.AIBudget
+	err := initializers.DB.Where("scope = ? AND scope_id = ?", scope, scopeID).First(&row).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	row.Scope = scope
+	row.ScopeID = scopeID
+	row.DailyRequests = budget.DailyRequests
+	row.DailyTokens = budget.DailyTokens
+	if err := initializers.DB.Save(&row).Error; err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// UserConsumption returns what the user has used today.
+func UserConsumption(userID uint) Consumption {
+	return consumption(initializers.DB.Where("user_id = ?", userID))
+}
+
+// ClassroomConsumption returns what students have used today while working
+// in the classroom.
+func ClassroomConsumption(classroomID uint) Consumption {
+	return consumption(initializers.DB.Where("classroom_id = ?", classroomID))
+}
+
+func anonymousConsumption() Consumption {
+	return consumption(initializers.DB.Where("anonymous = ?", true))
+}
+
+func consumption(scope *gorm.DB) Consumption {
+	var c Consumption
+	scope.Model(&models.AIUsage{}).
+		Where("created_at >= ?", startOfDay()).
+		Select("COUNT(*) AS requests, COALESCE(SUM(tokens), 0) AS tokens").
+		Scan(&c)
+	return c
+}
+
+// Check rejects a model call when the caller's own budget, or the budget of
+// the classroom they are working in (see ai.WithClassroom), is exhausted. Calls without a caller (grading,
+// question generation) and calls by teachers and admins are never limited.
+func Check(ctx context.Context, task ai.Task) error {
+	userID, ok := ai.CallerFrom(ctx)
+	if !ok {
+		return nil
+	}
+
+	if userID == 0 {
+		return exceeded("", DefaultBudget(""), anonymousConsumption())
+	}
+
+	var user models.User
+	if err := initializers.DB.Select("id", "role").First(&user, userID).Error; err != nil {
+		return nil
+	}
+	if user.Role == models.RoleTeacher || user.Role == models.RoleAdmin {
+		return nil
+	}
+
+	if err := exceeded(models.BudgetScopeUser, BudgetFor(models.BudgetScopeUser, userID), UserConsumption(userID)); err != nil {
+		return err
+	}
+
+	classroomID := ai.ClassroomFrom(ctx)
+	if classroomID == 0 {
+		return nil
+	}
+	budget := BudgetFor(models.BudgetScopeClassroom, classroomID)
+	if budget == (Budget{}) {
+		return nil
+	}
+	return exceeded(models.BudgetScopeClassroom, budget, ClassroomConsumption(classroomID))
+}
+
+// Record stores one model call in the usage ledger.
+func Record(ctx context.Context, usage ai.Usage) {
+	row := models.AIUsage{
+		Anonymous:     usage.Interactive && usage.UserID == 0,
+		Task:          string(usage.Task),
+		Provider:      usage.Provider,
+		Model:         usage.Model,
+		PromptChars:   usage.PromptChars,
+		ResponseChars: usage.ResponseChars,
+		Tokens:        usage.Tokens,
+		LatencyMs:     usage.Latency.Milliseconds(),
+		Success:       usage.Err == nil,
+	}
+	if usage.UserID > 0 {
+		userID := usage.UserID
+		row.UserID = &userID
+	}
+	if usage.ClassroomID > 0 {
+		classroomID := usage.ClassroomID
+		row.ClassroomID = &classroomID
+	}
+	if err := initializers.DB.Create(&row).Error; err != nil {
+		log.Printf("Failed to record AI usage: %v", err)
+	}
+}
+
+func exceeded(scope string, budget Budget, used Consumption) error {
+	who := "o limite para visitantes"
+	switch scope {
+	case models.BudgetScopeUser:
+		who = "seu limite"
+	case models.BudgetScopeClassroom:
+		who = "o limite da turma"
+	}
+	if budget.DailyRequests > 0 && used.Requests >= budget.DailyRequests {
+		return fmt.Errorf("%w (%s de %d chamadas por dia foi atingido). Tente novamente amanhã", ErrQuotaExceeded, who, budget.DailyRequests)
+	}
+	if budget.DailyTokens > 0 && used.Tokens >= budget.DailyTokens {
+		return fmt.Errorf("%w (%s de %d tokens por dia foi atingido). Tente novamente amanhã", ErrQuotaExceeded, who, budget.DailyTokens)
+	}
+	return nil
+}
+
+func startOfDay() time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+}
+
+func envInt(key string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil && n >= 0 {
+		return n
+	}
+	return fallback
+}
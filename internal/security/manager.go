@@ -162,13 +162,20 @@ func (sm *SecurityManager) adjustConfigBasedOnCapabilities() {
 }
 
 func (sm *SecurityManager) CreateSecureCommand(ctx context.Context, executable string, args ...string) (*exec.Cmd, func(), error) {
+	return sm.CreateWorkspaceCommand(ctx, sm.config.WorkspaceDir, sm.config.WorkspaceRO, executable, args...)
+}
+
+// CreateWorkspaceCommand is CreateSecureCommand with its own workspace instead
+// of the one shared through SetWorkspaceDir, so concurrent callers cannot swap
+// each other's workspace between creating the command and cleaning it up.
+func (sm *SecurityManager) CreateWorkspaceCommand(ctx context.Context, workspaceDir string, readOnly bool, executable string, args ...string) (*exec.Cmd, func(), error) {
 	if sm.config.Level != SecurityMaximum {
 		return nil, nil, fmt.Errorf("unknown or unsupported security level")
 	}
-	return sm.createContainerCommand(ctx, executable, args...)
+	return sm.createContainerCommand(ctx, workspaceDir, readOnly, executable, args...)
 }
 
-func (sm *SecurityManager) createContainerCommand(ctx context.Context, executable string, args ...string) (*exec.Cmd, func(), error) {
+func (sm *SecurityManager) createContainerCommand(ctx context.Context, workspaceDir string, readOnly bool, executable string, args ...string) (*exec.Cmd, func(), error) {
 	if !sm.capabilities["docker"] && !sm.capabilities["podman"] {
 		return nil, nil, fmt.Errorf("container runtime not available")
 	}
@@ -197,11 +204,11 @@ func (sm *SecurityManager) createContainerCommand(ctx context.Context, executabl
 		return nil, nil, fmt.Errorf("failed to start sandbox container: %w\n%s", err, string(out))
 	}
 
-	if sm.config.WorkspaceDir != "" {
-		exec.CommandContext(ctx, runtime, "exec", "-u", "root", containerName, "mkdir", "-p", sm.config.WorkspaceDir).Run()
+	if workspaceDir != "" {
+		exec.CommandContext(ctx, runtime, "exec", "-u", "root", containerName, "mkdir", "-p", workspaceDir).Run()
 
 		cpCmd := exec.CommandContext(ctx, runtime, "cp",
-			sm.config.WorkspaceDir+"/.", containerName+":"+sm.config.WorkspaceDir)
+			workspaceDir+"/.", containerName+":"+workspaceDir)
 		if out, err := cpCmd.CombinedOutput(); err != nil {
 			exec.Command(runtime, "rm", "-f", containerName).Run()
 			return nil, nil, fmt.Errorf("failed to copy workspace: %w\n%s", err, string(out))
@@ -211,11 +218,11 @@ func (sm *SecurityManager) createContainerCommand(ctx context.Context, executabl
 		// 777 = read/write/execute (needed for compilation)
 		// 555 = read/execute only (needed for running, prevents self-modification or new files)
 		perms := "777"
-		if sm.config.WorkspaceRO {
+		if readOnly {
 			perms = "555"
 		}
 
-		chmodCmd := exec.CommandContext(ctx, runtime, "exec", "-u", "root", containerName, "chmod", "-R", perms, sm.config.WorkspaceDir)
+		chmodCmd := exec.CommandContext(ctx, runtime, "exec", "-u", "root", containerName, "chmod", "-R", perms, workspaceDir)
 		if out, err := chmodCmd.CombinedOutput(); err != nil {
 			exec.Command(runtime, "rm", "-f", containerName).Run()
 			return nil, nil, fmt.Errorf("failed to set workspace permissions: %w\n%s", err, string(out))
@@ -224,9 +231,9 @@ func (sm *SecurityManager) createContainerCommand(ctx context.Context, executabl
 
 	// Step 3: Return `docker exec -i -u 65534` to run the actual command as nobody
 	execArgs := []string{"exec", "-i", "-u", "65534:65534"}
-	if sm.config.WorkspaceDir != "" {
+	if workspaceDir != "" {
 		// Set working directory to workspace
-		execArgs = append(execArgs, "-w", sm.config.WorkspaceDir)
+		execArgs = append(execArgs, "-w", workspaceDir)
 	}
 	execArgs = append(execArgs, containerName, executable)
 	execArgs = append(execArgs, args...)
@@ -239,9 +246,9 @@ func (sm *SecurityManager) createContainerCommand(ctx context.Context, executabl
 	}
 
 	cleanup := func() {
-		if sm.config.WorkspaceDir != "" && !sm.config.WorkspaceRO {
+		if workspaceDir != "" && !readOnly {
 			// Copy the workspace back to host to preserve compiled binaries
-			exec.Command(runtime, "cp", "-a", containerName+":"+sm.config.WorkspaceDir+"/.", sm.config.WorkspaceDir).Run()
+			exec.Command(runtime, "cp", "-a", containerName+":"+workspaceDir+"/.", workspaceDir).Run()
 		}
 		exec.Command(runtime, "rm", "-f", containerName).Run()
 	}
@@ -0,0 +1,121 @@
+package tutor
+
+import (
+	"context"
+	"errors"
+
+	"github.com/vitub/CLabServer/internal/access"
+	"github.com/vitub/CLabServer/internal/ai"
+	"github.com/vitub/CLabServer/internal/compiler"
+	"github.com/vitub/CLabServer/internal/initializers"
+	"github.com/vitub/CLabServer/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrHintsDisabled  = errors.New("dicas estão desativadas para este exercício")
+	ErrNoHintsLeft    = errors.New("você já usou todas as dicas disponíveis para este exercício")
+	ErrHintLevelOrder = errors.New("peça as dicas em ordem, um nível por vez")
+	ErrNotEnrolled    = errors.New("você não participa da turma deste exercício")
+)
+
+// UsedHintLevel returns the highest hint level the student has received for the exercise.
+func UsedHintLevel(userID uint, exerciseID uint) int {
+	var level int
+	initializers.DB.Model(&models.HintRequest{}).
+		Where("user_id = ? AND exercise_id = ?", userID, exerciseID).
+		Select("COALESCE(MAX(level), 0)").
+		Scan(&level)
+	return level
+}
+
+// ExerciseClassroom returns the classroom the exercise belongs to, directly or
+// through its topic, or 0. The topic must be preloaded.
+func ExerciseClassroom(exercise *models.Exercise) uint {
+	if exercise.ClassroomID != nil {
+		return *exercise.ClassroomID
+	}
+	if exercise.Topic != nil && exercise.Topic.ClassroomID != nil {
+		return *exercise.Topic.ClassroomID
+	}
+	return 0
+}
+
+// ExerciseInClassrooms is the query counterpart of ExerciseClassroom: it keeps
+// rows whose joined exercise belongs to one of the classrooms, directly or
+// through its topic.
+func ExerciseInClassrooms(classroomIDs []uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("exercises.classroom_id IN ? OR exercises.topic_id IN (SELECT id FROM exercise_topics WHERE classroom_id IN ?)", classroomIDs, classroomIDs)
+	}
+}
+
+// inExerciseClassroom reports whether the user studies or teaches in the
+// classroom the exercise belongs to.
+func inExerciseClassroom(userID uint, exercise *models.Exercise) bool {
+	classroomID := ExerciseClassroom(exercise)
+	return classroomID != 0 && (access.Enrolled(userID, classroomID) || access.Teaches(userID, classroomID))
+}
+
+// NextHint generates the hint at the level right after the last one the student
+// received, capped by the exercise's MaxHintLevel, and logs the request.
+// If code is empty the code of the student's latest run is used.
+func NextHint(ctx context.Context, userID uint, exerciseID uint, level int, code string) (*models.HintRequest, error) {
+	var exercise models.Exercise
+	if err := initializers.DB.Preload("Topic").First(&exercise, exerciseID).Error; err != nil {
+		return nil, err
+	}
+	if !inExerciseClassroom(userID, &exercise) {
+		return nil, ErrNotEnrolled
+	}
+	if InExamMode(userID, &exercise) {
+		return nil, ErrExamMode
+	}
+
+	maxLevel := exercise.MaxHintLevel
+	if maxLevel > ai.HintPartialFix {
+		maxLevel = ai.HintPartialFix
+	}
+	if maxLevel <= 0 {
+		return nil, ErrHintsDisabled
+	}
+
+	next := UsedHintLevel(userID, exerciseID) + 1
+	if level == 0 {
+		level = next
+	}
+	if level > maxLevel {
+		return nil, ErrNoHintsLeft
+	}
+	if level > next {
+		return nil, ErrHintLevelOrder
+	}
+
+	var output string
+	if latestRun := latestHistory(userID, exerciseID); latestRun != nil {
+		if code == "" {
+			code = latestRun.Code
+		}
+		output = compiler.CombineOutput(latestRun.Output, latestRun.Stderr)
+		if latestRun.Error != "" {
+			output = latestRun.Error
+		}
+	}
+
+	hint, err := ai.GetHint(aiContext(ctx, userID, &exercise), level, exercise.Title, exercise.Description, code, output)
+	if err != nil {
+		return nil, err
+	}
+
+	request := models.HintRequest{
+		UserID:     userID,
+		ExerciseID: exerciseID,
+		Level:      level,
+		Code:       code,
+		Hint:       hint,
+	}
+	if err := initializers.DB.Create(&request).Error; err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
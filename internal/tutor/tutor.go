@@ -0,0 +1,155 @@
+package tutor
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/vitub/CLabServer/internal/ai"
+	"github.com/vitub/CLabServer/internal/compiler"
+	"github.com/vitub/CLabServer/internal/initializers"
+	"github.com/vitub/CLabServer/internal/models"
+)
+
+// maxTurns bounds how many previous messages are sent back to the model.
+const maxTurns = 20
+
+var (
+	ErrExamMode      = errors.New("o tutor de IA fica desativado durante provas")
+	ErrEmptyQuestion = errors.New("a pergunta não pode ser vazia")
+)
+
+// Ask sends a student's question to the AI tutor and stores both turns in the
+// conversation for the exercise (exerciseID 0 for free practice). If code is
+// empty the code of the student's latest run is used. onChunk may be nil.
+func Ask(ctx context.Context, userID uint, exerciseID uint, code string, question string, onChunk func(string)) (*models.TutorMessage, error) {
+	question = strings.TrimSpace(question)
+	if question == "" {
+		return nil, ErrEmptyQuestion
+	}
+
+	var exercise *models.Exercise
+	if exerciseID > 0 {
+		exercise = &models.Exercise{}
+		if err := initializers.DB.Preload("Topic").First(exercise, exerciseID).Error; err != nil {
+			return nil, err
+		}
+	}
+	if exercise != nil && !inExerciseClassroom(userID, exercise) {
+		return nil, ErrNotEnrolled
+	}
+	if InExamMode(userID, exercise) {
+		return nil, ErrExamMode
+	}
+
+	conversation, err := findOrCreateConversation(userID, exerciseID)
+	if err != nil {
+		return nil, err
+	}
+
+	var previous []models.TutorMessage
+	initializers.DB.Where("conversation_id = ?", conversation.ID).
+		Order("id desc").Limit(maxTurns).Find(&previous)
+
+	tc := ai.TutorContext{Code: code}
+	if exercise != nil {
+		tc.ExerciseTitle = exercise.Title
+		tc.ExerciseDescription = exercise.Description
+	}
+	for i := len(previous) - 1; i >= 0; i-- {
+		tc.Turns = append(tc.Turns, ai.ChatTurn{Role: previous[i].Role, Content: previous[i].Content})
+	}
+
+	latestRun := latestHistory(userID, exerciseID)
+	if latestRun != nil {
+		if tc.Code == "" {
+			tc.Code = latestRun.Code
+		}
+		tc.LastOutput = compiler.CombineOutput(latestRun.Output, latestRun.Stderr)
+		if latestRun.Error != "" {
+			tc.LastOutput = latestRun.Error
+		}
+	}
+
+	if onChunk == nil {
+		onChunk = func(string) {}
+	}
+	reply, err := ai.StreamTutorReply(aiContext(ctx, userID, exercise), tc, question, onChunk)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := []models.TutorMessage{
+		{ConversationID: conversation.ID, Role: models.TutorRoleStudent, Content: question},
+		{ConversationID: conversation.ID, Role: models.TutorRoleTutor, Content: reply},
+	}
+	if err := initializers.DB.Create(&messages).Error; err != nil {
+		return nil, err
+	}
+	initializers.DB.Model(conversation).Update("updated_at", messages[1].CreatedAt)
+
+	return &messages[1], nil
+}
+
+// InExamMode reports whether the tutor must stay silent: the exercise belongs to
+// an exam, or one of the student's classrooms has an active exam.
+func InExamMode(userID uint, exercise *models.Exercise) bool {
+	if exercise != nil && exercise.Topic != nil && exercise.Topic.IsExam {
+		return true
+	}
+
+	var activeExams int64
+	initializers.DB.Model(&models.Classroom{}).
+		Joins("JOIN classroom_students cs ON cs.classroom_id = classrooms.id").
+		Where("cs.user_id = ? AND classrooms.active_exam_topic_id IS NOT NULL", userID).
+		Count(&activeExams)
+	return activeExams > 0
+}
+
+func findOrCreateConversation(userID uint, exerciseID uint) (*models.TutorConversation, error) {
+	var conversation models.TutorConversation
+	query := initializers.DB.Where("user_id = ?", userID)
+	if exerciseID > 0 {
+		query = query.Where("exercise_id = ?", exerciseID)
+	} else {
+		query = query.Where("exercise_id IS NULL")
+	}
+	if err := query.First(&conversation).Error; err == nil {
+		return &conversation, nil
+	}
+
+	conversation = models.TutorConversation{UserID: userID}
+	if exerciseID > 0 {
+		exID := exerciseID
+		conversation.ExerciseID = &exID
+	}
+	if err := initializers.DB.Create(&conversation).Error; err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+func latestHistory(userID uint, exerciseID uint) *models.History {
+	var history models.History
+	query := initializers.DB.Where("user_id = ?", userID)
+	if exerciseID > 0 {
+		query = query.Where("exercise_id = ?", exerciseID)
+	} else {
+		query = query.Where("exercise_id IS NULL")
+	}
+	if err := query.Order("created_at desc").First(&history).Error; err != nil {
+		return nil
+	}
+	return &history
+}
+
+// aiContext tags ctx with the student as the AI caller and with their locale.
+func aiContext(ctx context.Context, userID uint, exercise *models.Exercise) context.Context {
+	var user models.User
+	initializers.DB.Select("id", "locale").First(&user, userID)
+	ctx = ai.WithCaller(ctx, userID)
+	if exercise != nil {
+		ctx = ai.WithClassroom(ctx, ExerciseClassroom(exercise))
+	}
+	return ai.WithLocale(ctx, user.Locale)
+}
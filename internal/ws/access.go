@@ -0,0 +1,75 @@
+package ws
+
+import (
+	"github.com/vitub/CLabServer/internal/access"
+	"github.com/vitub/CLabServer/internal/initializers"
+	"github.com/vitub/CLabServer/internal/models"
+)
+
+// teachesClassroom reports whether the user owns or co-teaches the classroom.
+// Admins may watch any existing classroom.
+func teachesClassroom(userID uint, role string, classroomID uint) bool {
+	if role == "ADMIN" {
+		var count int64
+		initializers.DB.Model(&models.Classroom{}).Where("id = ?", classroomID).Count(&count)
+		return count > 0
+	}
+	return access.Teaches(userID, classroomID)
+}
+
+// exerciseContext returns the classroom the exercise belongs to, directly or
+// through its topic, and its exam topic. Either is 0 when there is none.
+func exerciseContext(exerciseID uint) (classroomID uint, examTopicID uint) {
+	var exercise models.Exercise
+	if err := initializers.DB.Preload("Topic").First(&exercise, exerciseID).Error; err != nil {
+		return 0, 0
+	}
+	if exercise.ClassroomID != nil {
+		classroomID = *exercise.ClassroomID
+	}
+	if exercise.Topic != nil {
+		if classroomID == 0 && exercise.Topic.ClassroomID != nil {
+			classroomID = *exercise.Topic.ClassroomID
+		}
+		if exercise.Topic.IsExam {
+			examTopicID = exercise.Topic.ID
+		}
+	}
+	return classroomID, examTopicID
+}
+
+// memberClassrooms returns the classrooms the user studies or teaches in.
+func memberClassrooms(userID uint) []uint {
+	return append(access.EnrolledClassrooms(userID), access.TaughtClassrooms(userID)...)
+}
+
+// recheckClassroom updates the client's rooms after its membership in the
+// classroom changed: it joins or leaves the classroom room, a student removed
+// from the classroom loses it as active classroom, and a teacher who no longer
+// teaches there stops receiving the classroom's monitor events and editors.
+func (c *Client) recheckClassroom(classroomID uint) {
+	teaches := teachesClassroom(c.UserDBID, c.Role, classroomID)
+	enrolled := access.Enrolled(c.UserDBID, classroomID)
+	if teaches || enrolled {
+		c.Hub.Join(c, ClassroomRoom(classroomID))
+	} else {
+		c.Hub.Leave(c, ClassroomRoom(classroomID))
+	}
+
+	c.mu.Lock()
+	active, exerciseID := c.classroomID == classroomID, c.exerciseID
+	c.mu.Unlock()
+	if active && !enrolled {
+		if err := c.setContext(0, exerciseID); err != nil {
+			c.sendJSON(WSMsg{Type: "context_error", Payload: err.Error()})
+		}
+	}
+
+	if !teaches {
+		c.Hub.LeavePrefix(c, watchRoomPrefix(classroomID))
+	}
+	if !teaches && c.Hub.InRoom(c, MonitorRoom(classroomID)) {
+		c.Hub.Leave(c, MonitorRoom(classroomID))
+		c.sendJSON(WSMsg{Type: "monitor_unsubscribed", ClassroomID: classroomID})
+	}
+}
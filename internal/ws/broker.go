@@ -0,0 +1,79 @@
+package ws
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// BrokerMessage is a message published to a room, carried between hubs as
+// the frame type and JSON of a wsproto.Typed so each hub can encode it for its
+// own clients' protocols.
+type BrokerMessage struct {
+	Room string          `json:"room"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Broker fans room messages out to every hub subscribed to it, the
+// publisher's own included. Replicas of the server share a broker so that
+// rooms span all of them.
+type Broker interface {
+	Publish(msg BrokerMessage) error
+	// Subscribe registers a handler called with every published message.
+	// Handlers must not block.
+	Subscribe(handler func(BrokerMessage))
+	Close() error
+}
+
+// MemoryBroker delivers messages synchronously to the hubs of this process.
+type MemoryBroker struct {
+	mu       sync.RWMutex
+	handlers []func(BrokerMessage)
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{}
+}
+
+func (b *MemoryBroker) Publish(msg BrokerMessage) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, handler := range b.handlers {
+		handler(msg)
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(handler func(BrokerMessage)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+}
+
+func (b *MemoryBroker) Close() error {
+	return nil
+}
+
+// BrokerFromEnv returns the broker selected by WS_BROKER: "memory" (default)
+// for a single server, or "postgres" to share rooms between replicas through
+// the database. It falls back to memory if the Postgres listener cannot start.
+func BrokerFromEnv(db *gorm.DB) Broker {
+	switch backend := os.Getenv("WS_BROKER"); backend {
+	case "", "memory":
+		return NewMemoryBroker()
+	case "postgres":
+		broker, err := NewPostgresBroker(db)
+		if err != nil {
+			log.Printf("Failed to start Postgres WS broker, using memory: %v", err)
+			return NewMemoryBroker()
+		}
+		return broker
+	default:
+		log.Printf("Unknown WS_BROKER %q, using memory", backend)
+		return NewMemoryBroker()
+	}
+}
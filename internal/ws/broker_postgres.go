@@ -0,0 +1,216 @@
+package ws
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/vitub/CLabServer/internal/models"
+	"gorm.io/gorm"
+)
+
+// brokerChannel is the LISTEN/NOTIFY channel shared by the hubs.
+const brokerChannel = "clab_ws"
+
+// maxNotifyPayload keeps messages under Postgres's 8000 byte NOTIFY limit;
+// larger ones are stored in ws_broker_messages and notified by ID.
+const maxNotifyPayload = 7000
+
+// PostgresBroker shares hub messages between server replicas with Postgres
+// LISTEN/NOTIFY. Messages are sent in order by a background worker so
+// publishers never wait on the database. Messages published while a
+// replica's listener is reconnecting are lost for that replica.
+type PostgresBroker struct {
+	db      *gorm.DB
+	sqlDB   *sql.DB
+	cancel  context.CancelFunc
+	done    chan struct{}
+	queue   chan BrokerMessage
+	flushed chan struct{}
+
+	mu       sync.RWMutex
+	handlers []func(BrokerMessage)
+}
+
+// NewPostgresBroker starts listening on a dedicated connection of db's pool.
+func NewPostgresBroker(db *gorm.DB) (*PostgresBroker, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &PostgresBroker{
+		db:      db,
+		sqlDB:   sqlDB,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		queue:   make(chan BrokerMessage, 1024),
+		flushed: make(chan struct{}),
+	}
+
+	listening := make(chan error, 1)
+	go b.listen(ctx, listening)
+	if err := <-listening; err != nil {
+		cancel()
+		<-b.done
+		return nil, err
+	}
+	go b.publishLoop()
+	return b, nil
+}
+
+// listen keeps a connection subscribed to the channel, reconnecting with
+// backoff. The first attempt's outcome is reported on started.
+func (b *PostgresBroker) listen(ctx context.Context, started chan<- error) {
+	defer close(b.done)
+	backoff := time.Second
+	for first := true; ; first = false {
+		listening := false
+		err := b.listenOnce(ctx, func() {
+			listening = true
+			if first {
+				started <- nil
+			}
+		})
+		if first && !listening {
+			started <- err
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if listening {
+			backoff = time.Second
+		}
+		log.Printf("WS broker: listener lost (%v), reconnecting in %s", err, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(backoff*2, 30*time.Second)
+	}
+}
+
+// listenOnce listens until the connection fails, calling onListening once
+// LISTEN succeeded.
+func (b *PostgresBroker) listenOnce(ctx context.Context, onListening func()) error {
+	conn, err := b.sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		stdConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return errors.New("database driver is not pgx")
+		}
+		pgConn := stdConn.Conn()
+		if _, err := pgConn.Exec(ctx, "LISTEN "+brokerChannel); err != nil {
+			return err
+		}
+		onListening()
+		defer pgConn.Exec(context.Background(), "UNLISTEN "+brokerChannel)
+
+		for {
+			notification, err := pgConn.WaitForNotification(ctx)
+			if err != nil {
+				return err
+			}
+			b.dispatch(notification.Payload)
+		}
+	})
+}
+
+// dispatch decodes a notification and hands it to the handlers.
+func (b *PostgresBroker) dispatch(payload string) {
+	if ref, ok := strings.CutPrefix(payload, "#"); ok {
+		id, err := strconv.ParseUint(ref, 10, 64)
+		if err != nil {
+			log.Printf("WS broker: invalid message reference %q", ref)
+			return
+		}
+		var stored models.WSBrokerMessage
+		if err := b.db.First(&stored, id).Error; err != nil {
+			log.Printf("WS broker: stored message %d not found: %v", id, err)
+			return
+		}
+		payload = stored.Payload
+	}
+
+	var msg BrokerMessage
+	if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+		log.Printf("WS broker: invalid message: %v", err)
+		return
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, handler := range b.handlers {
+		handler(msg)
+	}
+}
+
+// Publish queues the message. It fails when the queue is full, which means
+// the database is not keeping up.
+func (b *PostgresBroker) Publish(msg BrokerMessage) error {
+	select {
+	case b.queue <- msg:
+		return nil
+	default:
+		return errors.New("broker queue full")
+	}
+}
+
+func (b *PostgresBroker) publishLoop() {
+	defer close(b.flushed)
+	for msg := range b.queue {
+		if err := b.notify(msg); err != nil {
+			log.Printf("WS broker: failed to publish to %s: %v", msg.Room, err)
+		}
+	}
+}
+
+func (b *PostgresBroker) notify(msg BrokerMessage) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	notify := string(payload)
+	if len(payload) > maxNotifyPayload {
+		stored := models.WSBrokerMessage{Payload: string(payload)}
+		if err := b.db.Create(&stored).Error; err != nil {
+			return err
+		}
+		b.db.Where("created_at < ?", time.Now().Add(-time.Minute)).Delete(&models.WSBrokerMessage{})
+		notify = "#" + strconv.FormatUint(uint64(stored.ID), 10)
+	}
+	if err := b.db.Exec("SELECT pg_notify(?, ?)", brokerChannel, notify).Error; err != nil {
+		return fmt.Errorf("notify: %w", err)
+	}
+	return nil
+}
+
+func (b *PostgresBroker) Subscribe(handler func(BrokerMessage)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+}
+
+// Close sends the queued messages and stops listening. The database
+// connection pool stays open. The broker must not be published to afterwards.
+func (b *PostgresBroker) Close() error {
+	close(b.queue)
+	<-b.flushed
+	b.cancel()
+	<-b.done
+	return nil
+}
@@ -0,0 +1,133 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vitub/CLabServer/internal/models"
+	"github.com/vitub/CLabServer/pkg/wsproto"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestFanOutMemory(t *testing.T) {
+	shared := NewMemoryBroker()
+	checkFanOut(t, shared, shared)
+}
+
+// TestFanOutPostgres runs when DATABASE_URL points at a Postgres database.
+// Each broker listens on its own connection, like separate replicas.
+func TestFanOutPostgres(t *testing.T) {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		t.Skip("DATABASE_URL not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if err := db.AutoMigrate(&models.WSBrokerMessage{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	a, err := NewPostgresBroker(db)
+	if err != nil {
+		t.Fatalf("start broker: %v", err)
+	}
+	defer a.Close()
+	b, err := NewPostgresBroker(db)
+	if err != nil {
+		t.Fatalf("start broker: %v", err)
+	}
+	defer b.Close()
+	checkFanOut(t, a, b)
+}
+
+// checkFanOut runs two hubs as two replicas would, the first publishing
+// through broker a and the second through b. Room messages published on one
+// hub must reach the room's clients on both, in order, encoded for each
+// client's protocol, and must not leak into other rooms.
+func checkFanOut(t *testing.T, a, b Broker) {
+	hubA, hubB := NewHub(a), NewHub(b)
+
+	teacher := testClient(hubA, "teacher", wsproto.Version)
+	student := testClient(hubB, "student", 1)
+	outsider := testClient(hubB, "outsider", wsproto.Version)
+	hubA.Join(teacher, MonitorRoom(1))
+	hubA.Join(teacher, ClassroomRoom(1))
+	hubB.Join(student, ClassroomRoom(1))
+	hubB.Join(outsider, ClassroomRoom(2))
+
+	// Monitor output of a student on B reaches the teacher on A in order
+	const chunks = 100
+	for i := 0; i < chunks; i++ {
+		hubB.PublishToRoom(MonitorRoom(1), MonitorMsg{Type: "output_chunk", UserID: "student", ClassroomID: 1, Payload: strconv.Itoa(i)})
+	}
+	for i := 0; i < chunks; i++ {
+		var env wsproto.Envelope
+		expectFrame(t, teacher, &env)
+		var msg MonitorMsg
+		if err := env.Decode(&msg); err != nil || env.Type != "output_chunk" || msg.Payload != strconv.Itoa(i) {
+			t.Fatalf("monitor chunk %d: got %s %s", i, env.Type, env.Data)
+		}
+	}
+
+	// A classroom notification from A reaches both hubs, in each protocol
+	hubA.PublishToRoom(ClassroomRoom(1), WSMsg{Type: "exam_status_changed", Payload: "true", ClassroomID: 1})
+	var env wsproto.Envelope
+	expectFrame(t, teacher, &env)
+	if env.V != wsproto.Version || env.Type != "exam_status_changed" {
+		t.Fatalf("classroom notification to protocol 2 client: %+v", env)
+	}
+	var bare WSMsg
+	expectFrame(t, student, &bare)
+	if bare.Type != "exam_status_changed" || bare.ClassroomID != 1 {
+		t.Fatalf("classroom notification to protocol 1 client: %+v", bare)
+	}
+
+	// Messages larger than a Postgres notification arrive intact
+	code := strings.Repeat("int main(void) { return 0; }\n", 1000)
+	hubA.PublishToRoom(ClassroomRoom(1), WSMsg{Type: "code_pushed", Code: code})
+	expectFrame(t, student, &bare)
+	if bare.Code != code {
+		t.Fatalf("large message: got %d bytes of code, want %d", len(bare.Code), len(code))
+	}
+	expectFrame(t, teacher, &env)
+
+	if frame, ok := nextFrame(outsider, 500*time.Millisecond); ok {
+		t.Fatalf("client of another room received %s", frame)
+	}
+}
+
+func testClient(hub *Hub, userID string, protocol int32) *Client {
+	c := &Client{Hub: hub, UserID: userID, send: make(chan frame, 256)}
+	c.protocol.Store(protocol)
+	return c
+}
+
+func nextFrame(c *Client, timeout time.Duration) ([]byte, bool) {
+	select {
+	case f := <-c.send:
+		return f.bytes(c.protocol.Load()), true
+	case <-time.After(timeout):
+		return nil, false
+	}
+}
+
+func expectFrame(t *testing.T, c *Client, v any) {
+	t.Helper()
+	frame, ok := nextFrame(c, 5*time.Second)
+	if !ok {
+		t.Fatalf("%s received nothing", c.UserID)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(frame))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		t.Fatalf("%s received %s: %v", c.UserID, frame, err)
+	}
+}
@@ -3,6 +3,7 @@ package ws
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -17,10 +18,15 @@ import (
 	"github.com/creack/pty"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"github.com/vitub/CLabServer/internal/access"
 	"github.com/vitub/CLabServer/internal/ai"
+	"github.com/vitub/CLabServer/internal/compiler"
+	"github.com/vitub/CLabServer/internal/grading"
 	"github.com/vitub/CLabServer/internal/initializers"
 	"github.com/vitub/CLabServer/internal/models"
-	"github.com/vitub/CLabServer/internal/security"
+	"github.com/vitub/CLabServer/internal/quota"
+	"github.com/vitub/CLabServer/internal/tutor"
+	"github.com/vitub/CLabServer/pkg/wsproto"
 )
 
 const (
@@ -36,42 +42,61 @@ var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true
 	},
+	Subprotocols: []string{wsproto.Subprotocol},
 }
 
 type Client struct {
 	Hub *Hub
 
-	conn *websocket.Conn
-	send chan []byte
+	// The connection side. A logged-in client outlives a dropped connection
+	// for the resume grace period, buffering its frames in missed.
+	connMu     sync.Mutex
+	send       chan frame
+	gen        int // Incremented on each attached connection
+	detached   bool
+	missed     outputBuffer
+	graceTimer *time.Timer
+	resumeID   string
 
 	UserID   string
 	UserDBID uint
 	Role     string
 	Name     string
-
-	mu      sync.Mutex
-	ptyFile *os.File
-	cmd     *exec.Cmd
-
+	Locale   string
+
+	mu       sync.Mutex
+	ptyFile  *os.File
+	cmd      *exec.Cmd
+	aiCancel context.CancelFunc
+
+	// Terminal size last reported by the IDE, and the recording of the run
+	// in progress
+	cols, rows int
+	recording  *recorder
+
+	// Active classroom and exercise of a student, set by set_context and
+	// run_code; monitor events go to the teachers of that classroom
+	classroomID uint
+	exerciseID  uint
+	editorCode  string // Last editor contents, shown to watching teachers
+	collab      *collabSession
+
+	// runSession is the collaborative session of the run in progress, whose
+	// members see its output
+	runSession atomic.Pointer[collabSession]
+
+	protocol atomic.Int32 // Protocol version of the attached connection
 	isClosed atomic.Bool
-}
 
-type WSMsg struct {
-	Type       string `json:"type"`
-	Payload    string `json:"payload"`
-	Rows       int    `json:"rows,omitempty"`
-	Cols       int    `json:"cols,omitempty"`
-	ExerciseID uint   `json:"exerciseId,omitempty"`
-	IsExam     bool   `json:"isExam,omitempty"`
+	// present is whether the session is recorded as online
+	presenceMu sync.Mutex
+	present    bool
 }
 
-type MonitorMsg struct {
-	Type      string `json:"type"`
-	UserID    string `json:"userId"`
-	UserName  string `json:"userName"`
-	Payload   string `json:"payload,omitempty"`
-	Timestamp string `json:"timestamp"`
-}
+type (
+	WSMsg      = wsproto.Message
+	MonitorMsg = wsproto.MonitorMessage
+)
 
 type AnalysisPayload struct {
 	Status  string `json:"status"`
@@ -79,47 +104,109 @@ type AnalysisPayload struct {
 }
 
 func (c *Client) sendAIAnalysis(analysis string, status string) {
-	if c.isClosed.Load() {
-		return
+	payloadBytes, _ := json.Marshal(AnalysisPayload{Status: status, Content: analysis})
+	c.sendJSON(WSMsg{Type: "ai_analysis", Payload: string(payloadBytes)})
+}
+
+// streamAIAnalysis streams the analysis to the side panel as ai_analysis_chunk
+// frames followed by a final ai_analysis_done carrying the whole text, and returns
+// it with the version of the prompt template used. It reports false if the
+// analysis failed or was cancelled by a newer run.
+func (c *Client) streamAIAnalysis(code string, output string, isError bool) (string, string, bool) {
+	c.mu.Lock()
+	if c.aiCancel != nil {
+		c.aiCancel()
 	}
+	ctx := ai.WithClassroom(ai.WithCaller(context.Background(), c.UserDBID), c.classroomID)
+	ctx, cancel := context.WithCancel(ai.WithLocale(ctx, c.Locale))
+	c.aiCancel = cancel
+	c.mu.Unlock()
+	defer cancel()
 
-	payload := AnalysisPayload{Status: status, Content: analysis}
-	payloadBytes, _ := json.Marshal(payload)
+	stream, status := ai.StreamAIAnalysis, "success"
+	if isError {
+		stream, status = ai.StreamErrorAnalysis, "error"
+	}
 
-	msg := WSMsg{
-		Type:    "ai_analysis",
-		Payload: string(payloadBytes),
+	analysis, version, err := stream(ctx, code, output, func(chunk string) {
+		c.sendJSON(WSMsg{Type: "ai_analysis_chunk", Payload: chunk})
+	})
+	if ctx.Err() != nil {
+		return "", "", false
 	}
-	jsonBytes, _ := json.Marshal(msg)
-	select {
-	case c.send <- jsonBytes:
-	default:
-		log.Println("WS Send Buffer Full, dropping AI analysis")
+	if errors.Is(err, quota.ErrQuotaExceeded) {
+		c.sendOutput("\r\n\x1b[33m" + ai.Message(c.Locale, "terminal_quota_exceeded", nil) + "\x1b[0m\r\n")
+		return "", "", false
 	}
+	if err != nil {
+		c.sendOutput("\r\n" + ai.Message(c.Locale, "terminal_analysis_failed", err.Error()))
+		return "", "", false
+	}
+
+	payloadBytes, _ := json.Marshal(AnalysisPayload{Status: status, Content: analysis})
+	c.sendJSON(WSMsg{Type: "ai_analysis_done", Payload: string(payloadBytes)})
+	return analysis, version, true
 }
 
-func (c *Client) readPump() {
-	defer func() {
-		c.isClosed.Store(true)
+// handleChat answers a tutor question, streaming chat_chunk frames and finishing
+// with chat_done (or chat_error when the tutor is unavailable).
+func (c *Client) handleChat(msg WSMsg) {
+	if c.UserDBID == 0 {
+		c.sendJSON(WSMsg{Type: "chat_error", Payload: ai.Message(c.Locale, "tutor_login_required", nil)})
+		return
+	}
+	if msg.IsExam {
+		c.sendJSON(WSMsg{Type: "chat_error", Payload: tutor.ErrExamMode.Error()})
+		return
+	}
 
-		c.Hub.unregister <- c
-		c.conn.Close()
+	reply, err := tutor.Ask(context.Background(), c.UserDBID, msg.ExerciseID, msg.Code, msg.Payload, func(chunk string) {
+		c.sendJSON(WSMsg{Type: "chat_chunk", Payload: chunk, ExerciseID: msg.ExerciseID})
+	})
+	if err != nil {
+		log.Printf("WS: Tutor chat failed for user %s: %v", c.UserID, err)
+		c.sendJSON(WSMsg{Type: "chat_error", Payload: err.Error(), ExerciseID: msg.ExerciseID})
+		return
+	}
+	c.sendJSON(WSMsg{Type: "chat_done", Payload: reply.Content, ExerciseID: msg.ExerciseID})
+}
 
-		c.mu.Lock()
-		if c.ptyFile != nil {
-			c.ptyFile.Close()
-		}
-		if c.cmd != nil && c.cmd.Process != nil {
-			c.cmd.Process.Kill()
-		}
-		c.mu.Unlock()
+func (c *Client) cancelAIStream() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.aiCancel != nil {
+		c.aiCancel()
+		c.aiCancel = nil
+	}
+}
+
+func (c *Client) sendJSON(msg WSMsg) {
+	if c.isClosed.Load() {
+		return
+	}
+
+	if !c.deliver(messageFrame(msg)) {
+		log.Printf("WS Send Buffer Full, dropping %s", msg.Type)
+	}
+}
+
+// readPump reads the messages of connection gen. When it drops, the client is
+// detached and can be resumed from another connection.
+func (c *Client) readPump(conn *websocket.Conn, gen int) {
+	defer func() {
+		conn.Close()
+		c.detach(gen)
 	}()
-	c.conn.SetReadLimit(maxMessageSize)
-	c.conn.SetReadDeadline(time.Now().Add(pongWait))
-	c.conn.SetPongHandler(func(string) error { c.conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		c.presenceHeartbeat()
+		return nil
+	})
 
 	for {
-		_, message, err := c.conn.ReadMessage()
+		_, message, err := conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("error: %v", err)
@@ -136,12 +223,15 @@ func (c *Client) readPump() {
 		switch msg.Type {
 		case "input":
 			c.mu.Lock()
-			if c.ptyFile != nil {
-				c.ptyFile.Write([]byte(msg.Payload))
-			}
+			running := c.ptyFile != nil
+			c.writeInput(msg.Payload)
 			c.mu.Unlock()
+			if !running {
+				c.collabInput(msg.Payload)
+			}
 		case "resize":
 			c.mu.Lock()
+			c.cols, c.rows = msg.Cols, msg.Rows
 			if c.ptyFile != nil {
 				pty.Setsize(c.ptyFile, &pty.Winsize{
 					Rows: uint16(msg.Rows),
@@ -150,6 +240,9 @@ func (c *Client) readPump() {
 					Y:    0,
 				})
 			}
+			if c.recording != nil {
+				c.recording.resize(msg.Cols, msg.Rows)
+			}
 			c.mu.Unlock()
 		case "run_code":
 			c.mu.Lock()
@@ -157,45 +250,98 @@ func (c *Client) readPump() {
 				c.cmd.Process.Kill()
 			}
 			c.mu.Unlock()
-			go c.startCompilationAndRun(msg.Payload, msg.ExerciseID, msg.IsExam)
-		case "stop":
+			c.cancelAIStream()
+			if msg.ExerciseID > 0 || msg.ClassroomID > 0 {
+				// An exercise outside any classroom keeps the active one
+				classroomID := msg.ClassroomID
+				if classroomID == 0 {
+					c.mu.Lock()
+					classroomID = c.classroomID
+					c.mu.Unlock()
+				}
+				c.setContext(classroomID, msg.ExerciseID)
+			}
+			go c.startCompilationAndRun(msg.Payload, msg.ExerciseID, msg.IsExam, nil)
+		case "chat":
+			go c.handleChat(msg)
+		case "set_context":
+			if err := c.setContext(msg.ClassroomID, msg.ExerciseID); err != nil {
+				c.sendJSON(WSMsg{Type: "context_error", Payload: err.Error()})
+			}
+		case "editor_state":
+			c.updateEditor(msg)
+		case "watch_student":
+			c.watchStudent(msg)
+		case "unwatch_student":
+			c.Hub.Leave(c, WatchRoom(msg.ClassroomID, msg.StudentID))
+		case "teacher_message":
+			c.sendTeacherMessage(msg)
+		case "push_code":
+			c.pushCode(msg)
+		case "collab_create":
+			c.createCollab(msg)
+		case "collab_join":
+			c.joinCollab(msg)
+		case "collab_leave":
+			c.leaveCollab()
+		case "collab_op":
+			c.collabEdit(msg)
+		case "collab_cursor":
+			c.collabCursor(msg)
+		case "collab_run":
 			c.mu.Lock()
 			if c.cmd != nil && c.cmd.Process != nil {
 				c.cmd.Process.Kill()
-				c.sendOutput("\r\n[User Interruption]: Process killed by user.\r\n")
 			}
 			c.mu.Unlock()
+			c.cancelAIStream()
+			c.collabRun()
+		case "monitor_subscribe":
+			c.subscribeMonitor(msg.ClassroomID)
+		case "monitor_unsubscribe":
+			c.Hub.Leave(c, MonitorRoom(msg.ClassroomID))
+			c.sendJSON(WSMsg{Type: "monitor_unsubscribed", ClassroomID: msg.ClassroomID})
+		case "stop":
+			c.mu.Lock()
+			killed := c.cmd != nil && c.cmd.Process != nil
+			if killed {
+				c.cmd.Process.Kill()
+			}
+			c.mu.Unlock()
+			if killed {
+				c.sendOutput("\r\n[User Interruption]: Process killed by user.\r\n")
+			}
 		}
 	}
 }
 
-func (c *Client) writePump() {
+func (c *Client) writePump(conn *websocket.Conn, send chan frame, protocol int32) {
 	ticker := time.NewTicker(pingPeriod)
 	defer func() {
 		ticker.Stop()
-		c.conn.Close()
+		conn.Close()
 	}()
 	for {
 		select {
-		case message, ok := <-c.send:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+		case message, ok := <-send:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
 
-			w, err := c.conn.NextWriter(websocket.TextMessage)
+			w, err := conn.NextWriter(websocket.TextMessage)
 			if err != nil {
 				return
 			}
-			w.Write(message)
+			w.Write(message.bytes(protocol))
 
 			if err := w.Close(); err != nil {
 				return
 			}
 		case <-ticker.C:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
 		}
@@ -212,48 +358,63 @@ func ServeWs(hub *Hub, c *gin.Context) {
 	user, exists := c.Get("user")
 	var userID string
 	var userDBID uint
-	var role, name string
+	var role, name, locale string
 	if exists {
 		u := user.(models.User)
 		userID = fmt.Sprintf("%d", u.ID)
 		userDBID = u.ID
 		role = u.Role
 		name = u.Name
+		locale = u.Locale
 	} else {
 		userID = "anon"
 		role = "GUEST"
 		name = "Anonymous"
 	}
 
+	// Reattach to the session kept since the previous connection dropped
+	if client := hub.resume(c.Query("session"), userDBID); client != nil {
+		log.Printf("WS: User %s resumed session", userID)
+		client.attach(conn, negotiateProtocol(c.Request, conn))
+		return
+	}
+
 	client := &Client{
 		Hub:      hub,
-		conn:     conn,
-		send:     make(chan []byte, 256),
 		UserID:   userID,
 		UserDBID: userDBID,
 		Role:     role,
 		Name:     name,
+		Locale:   ai.NormalizeLocale(locale),
+		missed:   outputBuffer{max: resumeBufferSize()},
+		resumeID: newResumeID(),
 	}
 	client.Hub.register <- client
-
-	go client.writePump()
-	go client.readPump()
+	client.Hub.addResumable(client)
+	client.joinRooms()
+	client.attach(conn, negotiateProtocol(c.Request, conn))
 }
 
-func (c *Client) startCompilationAndRun(code string, exerciseID uint, isExamRun bool) {
+// startCompilationAndRun compiles and runs the code in the client's PTY. When
+// session is set the run is shared with the session's members.
+func (c *Client) startCompilationAndRun(code string, exerciseID uint, isExamRun bool, session *collabSession) {
+	c.runSession.Store(session)
+	defer func() {
+		if session != nil {
+			c.runSession.CompareAndSwap(session, nil)
+			session.finishRun(c)
+		}
+	}()
+
 	log.Printf("WS: Starting Run/Submission. UserID: %s (DBID: %d), Name: %s, ExerciseID: %d, IsExamRun: %v", c.UserID, c.UserDBID, c.Name, exerciseID, isExamRun)
 	c.broadcastMonitor("compile_start", "Starting compilation...")
 
-	tmpDir, err := os.MkdirTemp("", "cws")
+	workspace, err := compiler.NewWorkspace(code)
 	if err != nil {
-		c.sendOutput("Error creating temp dir: " + err.Error())
+		c.sendError("Error preparing workspace: " + err.Error())
 		return
 	}
-	defer os.RemoveAll(tmpDir)
-
-	srcPath := tmpDir + "/program.c"
-	binPath := tmpDir + "/program"
-	os.WriteFile(srcPath, []byte(code), 0644)
+	defer workspace.Close()
 
 	var isExam bool = isExamRun
 	if exerciseID > 0 {
@@ -274,13 +435,7 @@ func (c *Client) startCompilationAndRun(code string, exerciseID uint, isExamRun
 				c.sendOutput("\r\n\x1b[31m[MODO PROVA]\x1b[0m: Você já submeteu uma resposta para este exercício. Alterações não são mais permitidas.\r\n")
 				c.broadcastMonitor("compile_end", "Duplicate submission blocked")
 
-				statusMsg := WSMsg{
-					Type:    "status",
-					Payload: "stopped",
-				}
-				if statusBytes, err := json.Marshal(statusMsg); err == nil {
-					c.sendOutput(string(statusBytes))
-				}
+				c.sendStatus("stopped")
 				return
 			}
 		}
@@ -289,35 +444,31 @@ func (c *Client) startCompilationAndRun(code string, exerciseID uint, isExamRun
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	security.DefaultManager.SetWorkspaceDir(tmpDir, false)
-	compileCmd, cleanupCompile, errCmd := security.DefaultManager.CreateSecureCommand(ctx, "gcc", srcPath, "-o", binPath, "-Wall")
-	if errCmd != nil {
-		c.sendOutput("Server Security Error: " + errCmd.Error())
+	out, err := workspace.Compile(ctx)
+	if err != nil && !errors.Is(err, compiler.ErrCompilation) {
+		c.sendError("Server Security Error: " + err.Error())
 		return
 	}
-	out, err := compileCmd.CombinedOutput()
-	cleanupCompile()
 	if err != nil {
-		errorOutput := string(out)
+		errorOutput := out
 
-		c.sendOutput("Compilation Error:\r\n" + errorOutput)
+		c.sendCompileResult(false, errorOutput)
 
-		var analysis string
-		var aiErr error
+		var analysis, promptVersion string
 
 		if !isExam {
 			if c.Role == "GUEST" {
-				c.sendOutput("\r\n[IA indisponível] Faça login para receber análise da IA.\r\n")
+				c.sendOutput("\r\n" + ai.Message(c.Locale, "terminal_login_required", nil) + "\r\n")
 			} else {
 				if len(errorOutput) > 20000 {
-					analysis = "## Limite Excedido\n\nNão foi possível analisar o seu código pois a saída de erro ultrapassou o limite de tokens permitidos para a IA."
+					analysis = ai.Message(c.Locale, "error_output_too_large", nil)
 					c.sendAIAnalysis(analysis, "error")
-					c.sendOutput("\r\n[AI]: Limite de tamanho de erro excedido.\r\n")
+					c.sendOutput("\r\n" + ai.Message(c.Locale, "terminal_error_too_large", nil) + "\r\n")
 				} else {
-					analysis, aiErr = ai.GetErrorAnalysis(code, errorOutput)
-					if aiErr == nil {
-						c.sendAIAnalysis(analysis, "error")
-						c.sendOutput("\r\n[AI]: Compilation analysis sent to side panel.\r\n")
+					c.sendOutput("\r\nAnalyzing...")
+					if streamed, version, ok := c.streamAIAnalysis(code, errorOutput, true); ok {
+						analysis, promptVersion = streamed, version
+						c.sendOutput("\r\n" + ai.Message(c.Locale, "terminal_compile_analysis_sent", nil) + "\r\n")
 					}
 				}
 			}
@@ -327,13 +478,7 @@ func (c *Client) startCompilationAndRun(code string, exerciseID uint, isExamRun
 
 		c.broadcastMonitor("compile_end", "Compilation failed")
 
-		statusMsg := WSMsg{
-			Type:    "status",
-			Payload: "stopped",
-		}
-		if statusBytes, err := json.Marshal(statusMsg); err == nil {
-			c.sendOutput(string(statusBytes))
-		}
+		c.sendStatus("stopped")
 
 		if c.UserDBID != 0 {
 			history := models.History{
@@ -346,49 +491,106 @@ func (c *Client) startCompilationAndRun(code string, exerciseID uint, isExamRun
 			if exerciseID > 0 {
 				exID := exerciseID
 				history.ExerciseID = &exID
+				history.HintLevel = tutor.UsedHintLevel(c.UserDBID, exerciseID)
 			}
 
 			if isExam {
-				gradingRes, err := ai.GetExamErrorAnalysis(code, errorOutput)
+				gradingRes, err := grading.GradeCompileError(code, errorOutput)
 				if err == nil {
 					history.TeacherGrading = gradingRes.Feedback
 					history.Score = gradingRes.Score
+					history.PromptVersion = gradingRes.PromptVersion
+					history.NeedsReview = gradingRes.NeedsReview
+					history.IntegrityEvents = gradingRes.IntegrityEvents
 				}
 			} else {
 				history.AIAnalysis = analysis
+				history.PromptVersion = promptVersion
 			}
 
-			initializers.DB.Create(&history)
+			if _, err := c.saveHistory(&history); err == nil {
+				c.publishPresence()
+			}
 		}
 
 		return
 	}
-	c.sendOutput("Compilation successful.\r\nRunning...\r\n")
+	c.sendCompileResult(true, out)
 
 	runCtx, runCancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer runCancel()
 
-	security.DefaultManager.SetWorkspaceDir(tmpDir, true)
-
-	runCmd, cleanupRun, errCmd := security.DefaultManager.CreateSecureCommand(runCtx, binPath)
+	runCmd, cleanupRun, errCmd := workspace.Command(runCtx)
 	if errCmd != nil {
-		c.sendOutput("Server Security Error starting execution: " + errCmd.Error())
+		c.sendError("Server Security Error starting execution: " + errCmd.Error())
 		return
 	}
 	defer cleanupRun()
-	ptyFile, err := pty.Start(runCmd)
+	// stdout and stdin go through the PTY so the program stays interactive;
+	// stderr gets its own pipe so the two streams can be told apart.
+	stderrRead, stderrWrite, err := os.Pipe()
+	if err != nil {
+		c.sendError("Error creating stderr pipe: " + err.Error())
+		return
+	}
+	defer stderrRead.Close()
+	runCmd.Stderr = stderrWrite
+
+	var rec *recorder
+	c.mu.Lock()
+	size := &pty.Winsize{Rows: uint16(c.rows), Cols: uint16(c.cols)}
+	if c.UserDBID != 0 {
+		rec = newRecorder(c.cols, c.rows)
+		c.recording = rec
+	}
+	c.mu.Unlock()
+
+	started := time.Now()
+	var ptyFile *os.File
+	if size.Rows > 0 && size.Cols > 0 {
+		ptyFile, err = pty.StartWithSize(runCmd, size)
+	} else {
+		ptyFile, err = pty.Start(runCmd)
+	}
+	stderrWrite.Close()
 	if err != nil {
-		c.sendOutput("Error starting PTY: " + err.Error())
+		c.mu.Lock()
+		c.recording = nil
+		c.mu.Unlock()
+		c.sendError("Error starting PTY: " + err.Error())
 		return
 	}
 
+	var fullStderr []byte
+	stderrDone := make(chan struct{})
+	go func() {
+		defer close(stderrDone)
+		buf := make([]byte, 1024)
+		for {
+			n, err := stderrRead.Read(buf)
+			if n > 0 {
+				if len(fullStderr) < compiler.MaxOutputSize {
+					fullStderr = append(fullStderr, buf[:n]...)
+				}
+				// The pipe has no line discipline to turn \n into \r\n like the PTY does
+				text := strings.ReplaceAll(strings.ToValidUTF8(string(buf[:n]), "\uFFFD"), "\n", "\r\n")
+				c.sendStderr(text)
+				c.broadcastMonitor("output_chunk", text)
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
 	c.mu.Lock()
 	c.ptyFile = ptyFile
 	c.cmd = runCmd
 	c.mu.Unlock()
 	buf := make([]byte, 1024)
 	var fullOutput []byte
-	var aiAnalysisStored string
+	var aiAnalysisStored, promptVersion string
+	var examGrading *grading.Result
 	for {
 		n, err := ptyFile.Read(buf)
 		if n > 0 {
@@ -397,7 +599,7 @@ func (c *Client) startCompilationAndRun(code string, exerciseID uint, isExamRun
 
 			// Sanitize invalid UTF-8 bytes to prevent websocket 1002 protocol errors
 			cleanOutput := strings.ToValidUTF8(string(output), "\uFFFD")
-			c.sendOutput(cleanOutput)
+			c.sendStdout(cleanOutput)
 			c.broadcastMonitor("output_chunk", cleanOutput)
 		}
 		if err != nil {
@@ -408,6 +610,10 @@ func (c *Client) startCompilationAndRun(code string, exerciseID uint, isExamRun
 	}
 
 	err = runCmd.Wait()
+	<-stderrDone
+	exit := exitInfo(runCmd, err, started)
+	stdout, stderr := string(fullOutput), string(fullStderr)
+	analysisOutput := compiler.CombineOutput(stdout, stderr)
 
 	exitMsg := "\r\nProgram exited."
 	isSuccess := false
@@ -436,22 +642,18 @@ func (c *Client) startCompilationAndRun(code string, exerciseID uint, isExamRun
 					c.sendOutput(fmt.Sprintf("\r\n[Runtime Error]: %v\r\n[MODO PROVA] IA desativada.\r\n", err))
 				} else if c.Role == "GUEST" {
 					c.sendOutput(fmt.Sprintf("\r\n[Runtime Error]: %v\r\n", err))
-					c.sendOutput("[IA indisponível] Faça login para receber análise da IA.\r\n")
+					c.sendOutput(ai.Message(c.Locale, "terminal_login_required", nil) + "\r\n")
 				} else {
 					c.sendOutput(fmt.Sprintf("\r\n[Runtime Error]: %v\r\nAnalyzing...", err))
 
-					if len(fullOutput) > 20000 {
-						aiAnalysisStored = "===Analysis===\n# Limite Excedido\n\nNão foi possível analisar o seu código pois a saída de erro ultrapassou o limite de tokens permitidos para a IA."
+					if len(analysisOutput) > 20000 {
+						aiAnalysisStored = ai.Message(c.Locale, "error_output_too_large", nil)
 						c.sendAIAnalysis(aiAnalysisStored, "error")
-						c.sendOutput("\r\n[AI]: Limite de tamanho de saída excedido.\r\n")
+						c.sendOutput("\r\n" + ai.Message(c.Locale, "terminal_error_too_large", nil) + "\r\n")
 					} else {
-						analysis, aiErr := ai.GetErrorAnalysis(code, string(fullOutput))
-						if aiErr != nil {
-							c.sendOutput("\r\nAI Analysis failed: " + aiErr.Error())
-						} else {
-							aiAnalysisStored = analysis
-							c.sendAIAnalysis(analysis, "error")
-							c.sendOutput("\r\n[AI]: Analysis sent to side panel.\r\n")
+						if analysis, version, ok := c.streamAIAnalysis(code, analysisOutput, true); ok {
+							aiAnalysisStored, promptVersion = analysis, version
+							c.sendOutput("\r\n" + ai.Message(c.Locale, "terminal_analysis_sent", nil) + "\r\n")
 						}
 					}
 				}
@@ -468,21 +670,17 @@ func (c *Client) startCompilationAndRun(code string, exerciseID uint, isExamRun
 				c.sendOutput("\r\n[MODO PROVA] Execução finalizada. (IA desativada)\r\n")
 			} else if c.Role == "GUEST" {
 				// Guest user - no AI
-				c.sendOutput("\r\n[IA indisponível] Faça login para receber análise da IA.\r\n")
+				c.sendOutput("\r\n" + ai.Message(c.Locale, "terminal_login_required", nil) + "\r\n")
 			} else {
 				// Normal code run - perform AI analysis
-				if len(fullOutput) > 20000 {
-					c.sendOutput("\r\n[AI]: Output too large for analysis.")
-					aiAnalysisStored = "===Analysis===\n# Limite Excedido\n\nNão foi possível analisar o seu código pois a saída ultrapassou o limite de tokens permitidos para a IA."
+				if len(analysisOutput) > 20000 {
+					c.sendOutput("\r\n" + ai.Message(c.Locale, "terminal_output_too_large", nil))
+					aiAnalysisStored = ai.Message(c.Locale, "output_too_large", nil)
 					c.sendAIAnalysis(aiAnalysisStored, "error")
 				} else {
 					c.sendOutput("\r\nAnalyzing...")
-					analysis, aiErr := ai.GetAIAnalysis(code, string(fullOutput))
-					if aiErr != nil {
-						c.sendOutput("\r\nAI Analysis failed: " + aiErr.Error())
-					} else {
-						aiAnalysisStored = analysis
-						c.sendAIAnalysis(analysis, "success")
+					if analysis, version, ok := c.streamAIAnalysis(code, analysisOutput, false); ok {
+						aiAnalysisStored, promptVersion = analysis, version
 					}
 				}
 			}
@@ -490,7 +688,7 @@ func (c *Client) startCompilationAndRun(code string, exerciseID uint, isExamRun
 			c.sendOutput("\r\nAvaliando Exercício...")
 			c.sendOutput("\r\nAvaliando Exercício...")
 			var exercise models.Exercise
-			if dbErr := initializers.DB.Preload("Topic").First(&exercise, exerciseID).Error; dbErr != nil {
+			if dbErr := initializers.DB.Preload("Topic").Preload("Rubric").First(&exercise, exerciseID).Error; dbErr != nil {
 				c.sendOutput("\r\nFalha ao buscar detalhes do exercício: " + dbErr.Error())
 			} else {
 
@@ -500,32 +698,27 @@ func (c *Client) startCompilationAndRun(code string, exerciseID uint, isExamRun
 					c.sendOutput("\r\n[MODO PROVA]: Submissão recebida.")
 					c.sendOutput("\r\nO professor receberá sua resposta para correção.")
 
-					if len(fullOutput) > 20000 {
+					if len(stdout) > 20000 {
 						aiAnalysisStored = "Erro na correção automática: Saída muito longa excedeu o limite de tokens."
 					} else {
-						grading, aiErr := ai.GetExamGradingAnalysis(code, string(fullOutput), exercise.ExpectedOutput, exercise.ExamMaxNote)
+						result, aiErr := grading.GradeExam(code, stdout, exercise)
 						if aiErr != nil {
 							log.Printf("Exam grading failed: %v", aiErr)
 							aiAnalysisStored = "Erro na correção automática: " + aiErr.Error()
 						} else {
-							gradingJson, _ := json.Marshal(grading)
-							aiAnalysisStored = string(gradingJson)
+							examGrading = &result
 						}
 					}
 					isSuccess = true
 
 				} else {
-					if len(fullOutput) > 20000 {
-						c.sendOutput("\r\n[AI]: Output too large for analysis.")
-						aiAnalysisStored = "===Analysis===\n# Limite Excedido\n\nNão foi possível analisar o seu código pois a saída ultrapassou o limite de tokens permitidos para a IA."
+					if len(analysisOutput) > 20000 {
+						c.sendOutput("\r\n" + ai.Message(c.Locale, "terminal_output_too_large", nil))
+						aiAnalysisStored = ai.Message(c.Locale, "output_too_large", nil)
 						c.sendAIAnalysis(aiAnalysisStored, "error")
 					} else {
-						analysis, aiErr := ai.GetAIAnalysis(code, string(fullOutput))
-						if aiErr != nil {
-							c.sendOutput("\r\nAI Analysis failed: " + aiErr.Error())
-						} else {
-							aiAnalysisStored = analysis
-							c.sendAIAnalysis(analysis, "success")
+						if analysis, version, ok := c.streamAIAnalysis(code, analysisOutput, false); ok {
+							aiAnalysisStored, promptVersion = analysis, version
 						}
 					}
 					isSuccess = true
@@ -534,78 +727,133 @@ func (c *Client) startCompilationAndRun(code string, exerciseID uint, isExamRun
 		}
 	}
 
-	c.sendOutput(exitMsg)
+	exit.Message = exitMsg
+	c.sendExit(exit)
 	c.broadcastMonitor("compile_end", exitMsg)
 
-	statusMsg := WSMsg{
-		Type:    "status",
-		Payload: "stopped",
-	}
-	if statusBytes, err := json.Marshal(statusMsg); err == nil {
-		c.sendOutput(string(statusBytes))
-	}
+	c.sendStatus("stopped")
 
 	if c.UserDBID != 0 {
-		var teacherGradingData string
-		var scoreVal float64
-
-		if len(aiAnalysisStored) > 0 && aiAnalysisStored[0] == '{' {
-			var gradingRes ai.ExamGradingResult
-			if err := json.Unmarshal([]byte(aiAnalysisStored), &gradingRes); err == nil {
-				teacherGradingData = gradingRes.Feedback
-				scoreVal = gradingRes.Score
-				aiAnalysisStored = ""
-			}
-		}
-
 		history := models.History{
-			UserID:         c.UserDBID,
-			Code:           code,
-			Output:         string(fullOutput),
-			AIAnalysis:     aiAnalysisStored, // Empty for exams if we cleared it
-			TeacherGrading: teacherGradingData,
-			Score:          scoreVal,
-			IsSuccess:      isSuccess,
+			UserID:        c.UserDBID,
+			Code:          code,
+			Output:        stdout,
+			Stderr:        stderr,
+			AIAnalysis:    aiAnalysisStored,
+			IsSuccess:     isSuccess,
+			PromptVersion: promptVersion,
+		}
+		if examGrading != nil {
+			history.PromptVersion = examGrading.PromptVersion
+			history.TeacherGrading = examGrading.Feedback
+			history.Score = examGrading.Score
+			history.RubricScores = examGrading.RubricScores
+			history.GradingSamples = examGrading.Samples
+			history.NeedsReview = examGrading.NeedsReview
+			history.IntegrityEvents = examGrading.IntegrityEvents
 		}
 		if exerciseID > 0 {
 			exID := exerciseID
 			history.ExerciseID = &exID
+			history.HintLevel = tutor.UsedHintLevel(c.UserDBID, exerciseID)
 		}
 
-		if err := initializers.DB.Create(&history).Error; err != nil {
+		if copies, err := c.saveHistory(&history); err != nil {
 			log.Printf("Failed to save history for user %d: %v", c.UserDBID, err)
 		} else {
 			log.Printf("Saved history for user %d (Exercise: %d, Success: %v)", c.UserDBID, exerciseID, isSuccess)
+			if rec != nil {
+				saveRecording(rec, append([]models.History{history}, copies...), c.Name)
+			}
+			c.publishPresence()
 		}
 	}
 
 	c.mu.Lock()
 	c.ptyFile = nil
 	c.cmd = nil
+	c.recording = nil
 	c.mu.Unlock()
 }
 
-func (c *Client) sendOutput(text string) {
-	if c.isClosed.Load() {
+// broadcastMonitor sends an event to the teachers watching the student's
+// active classroom. Students outside a classroom are not monitored.
+func (c *Client) broadcastMonitor(msgType, payload string) {
+	c.mu.Lock()
+	classroomID, exerciseID := c.classroomID, c.exerciseID
+	c.mu.Unlock()
+	if classroomID == 0 {
 		return
 	}
 
-	select {
-	case c.send <- []byte(text):
-	default:
+	msg := MonitorMsg{
+		Type:        msgType,
+		UserID:      c.UserID,
+		UserName:    c.Name,
+		ClassroomID: classroomID,
+		ExerciseID:  exerciseID,
+		Payload:     payload,
+		Timestamp:   time.Now().Format(time.RFC3339),
+	}
+	c.Hub.PublishToRoom(MonitorRoom(classroomID), msg)
+}
 
-		log.Println("WS Send Buffer Full, dropping output")
+// subscribeMonitor starts sending the classroom's student events to a teacher
+// who owns or co-teaches it.
+func (c *Client) subscribeMonitor(classroomID uint) {
+	if c.Role != "TEACHER" && c.Role != "ADMIN" {
+		c.sendJSON(WSMsg{Type: "monitor_error", Payload: "Apenas professores podem monitorar turmas.", ClassroomID: classroomID})
+		return
 	}
+	if classroomID == 0 || !teachesClassroom(c.UserDBID, c.Role, classroomID) {
+		c.sendJSON(WSMsg{Type: "monitor_error", Payload: "Você não leciona nesta turma.", ClassroomID: classroomID})
+		return
+	}
+	c.Hub.Join(c, MonitorRoom(classroomID))
+	c.sendJSON(WSMsg{Type: "monitor_subscribed", ClassroomID: classroomID})
 }
 
-func (c *Client) broadcastMonitor(msgType, payload string) {
-	msg := MonitorMsg{
-		Type:      msgType,
-		UserID:    c.UserID,
-		UserName:  c.Name,
-		Payload:   payload,
-		Timestamp: time.Now().Format(time.RFC3339),
-	}
-	jsonBytes, _ := json.Marshal(msg)
-	c.Hub.BroadcastToMonitors(jsonBytes)
+// setContext tags the student with the classroom and exercise being worked
+// on. The classroom is taken from the exercise when it belongs to one, and
+// is only kept if the student is enrolled in it.
+func (c *Client) setContext(classroomID uint, exerciseID uint) error {
+	if c.UserDBID == 0 {
+		return errors.New("faça login para entrar em uma turma")
+	}
+	if exerciseID > 0 {
+		if owner, _ := exerciseContext(exerciseID); owner != 0 {
+			classroomID = owner
+		}
+	}
+	var err error
+	if classroomID != 0 && !access.Enrolled(c.UserDBID, classroomID) {
+		classroomID = 0
+		err = errors.New("você não está matriculado nesta turma")
+	}
+
+	c.mu.Lock()
+	changed := c.classroomID != classroomID || c.exerciseID != exerciseID
+	c.classroomID, c.exerciseID = classroomID, exerciseID
+	c.mu.Unlock()
+
+	if changed {
+		c.presenceContext(classroomID, exerciseID)
+	}
+
+	if classroomID != 0 {
+		c.Hub.Join(c, ClassroomRoom(classroomID))
+	}
+	return err
+}
+
+// joinRooms adds a logged-in client to its user room and to the rooms of the
+// classrooms it belongs to.
+func (c *Client) joinRooms() {
+	if c.UserDBID == 0 {
+		return
+	}
+	c.Hub.Join(c, UserRoom(c.UserDBID))
+	for _, classroomID := range memberClassrooms(c.UserDBID) {
+		c.Hub.Join(c, ClassroomRoom(classroomID))
+	}
 }
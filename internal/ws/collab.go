@@ -0,0 +1,511 @@
+package ws
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/vitub/CLabServer/internal/access"
+	"github.com/vitub/CLabServer/internal/initializers"
+	"github.com/vitub/CLabServer/internal/models"
+	"github.com/vitub/CLabServer/internal/tutor"
+	"github.com/vitub/CLabServer/pkg/wsproto"
+)
+
+// maxCollabHistory is how many operations a session keeps for rebasing late
+// edits. Clients further behind are sent the whole document again.
+const maxCollabHistory = 1000
+
+// maxCollabDocument is the largest shared document, in code points. Edits that
+// would grow it further are rejected.
+const maxCollabDocument = 64 * 1024
+
+var errCollabTooLarge = errors.New("document too large")
+
+// CollabRoom receives the edits, cursors and shared run output of a session.
+func CollabRoom(sessionID string) string { return fmt.Sprintf("collab:%s", sessionID) }
+
+type (
+	TextOp = wsproto.TextOp
+	Cursor = wsproto.Cursor
+)
+
+type CollabMember struct {
+	UserID uint    `json:"userId"`
+	Name   string  `json:"name"`
+	Cursor *Cursor `json:"cursor,omitempty"`
+}
+
+// CollabState is sent as the payload of collab_state when joining or when a
+// client has to resynchronize.
+type CollabState struct {
+	SessionID   string         `json:"sessionId"`
+	ExerciseID  uint           `json:"exerciseId"`
+	ClassroomID uint           `json:"classroomId"`
+	Document    string         `json:"document"`
+	Revision    int            `json:"revision"`
+	Members     []CollabMember `json:"members"`
+}
+
+// collabSession is a document shared by classroom members working on the same
+// exercise. The server orders the edits: a client sends each operation with
+// the revision it was written against, and the server rebases it over the
+// operations applied since, applies it and relays it with the new revision.
+// Clients rebase their unacknowledged edits over relayed ones with the same
+// transformOps, taking the relayed operation as first.
+type collabSession struct {
+	id          string
+	exerciseID  uint
+	classroomID uint
+
+	mu       sync.Mutex
+	doc      []rune
+	revision int
+	history  []TextOp // history[i] produced revision revision-len(history)+i+1
+	clients  map[*Client]*Cursor
+	runner   *Client // Member whose PTY runs the shared code
+}
+
+func newSessionID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// transformOps rebases a over b and b over a, both written against the same
+// document, so that applying b then a' gives the same text as a then b'.
+// Concurrent inserts at one position keep the first list's insert first, and a
+// delete spanning an insert is split around it.
+func transformOps(a []TextOp, b []TextOp, aFirst bool) ([]TextOp, []TextOp) {
+	if len(a) == 0 || len(b) == 0 {
+		return a, b
+	}
+	if len(a) > 1 {
+		head, b1 := transformOps(a[:1], b, aFirst)
+		tail, b2 := transformOps(a[1:], b1, aFirst)
+		return append(head, tail...), b2
+	}
+	if len(b) > 1 {
+		a1, head := transformOps(a, b[:1], aFirst)
+		a2, tail := transformOps(a1, b[1:], aFirst)
+		return a2, append(head, tail...)
+	}
+	return transformOp(a[0], b[0], aFirst), transformOp(b[0], a[0], !aFirst)
+}
+
+func transformOp(op TextOp, other TextOp, opFirst bool) []TextOp {
+	if other.Insert != "" {
+		n := utf8.RuneCountInString(other.Insert)
+		if op.Insert != "" {
+			if op.Position > other.Position || op.Position == other.Position && !opFirst {
+				op.Position += n
+			}
+			return []TextOp{op}
+		}
+		switch {
+		case other.Position <= op.Position:
+			op.Position += n
+		case other.Position < op.Position+op.Delete:
+			before := TextOp{Position: op.Position, Delete: other.Position - op.Position}
+			after := TextOp{Position: other.Position + n - before.Delete, Delete: op.Delete - before.Delete}
+			return []TextOp{before, after}
+		}
+		return []TextOp{op}
+	}
+
+	shift := func(x int) int {
+		switch {
+		case x <= other.Position:
+			return x
+		case x < other.Position+other.Delete:
+			return other.Position
+		}
+		return x - other.Delete
+	}
+	if op.Insert != "" {
+		op.Position = shift(op.Position)
+		return []TextOp{op}
+	}
+	start, end := shift(op.Position), shift(op.Position+op.Delete)
+	if start == end {
+		return nil
+	}
+	return []TextOp{{Position: start, Delete: end - start}}
+}
+
+func applyOp(doc []rune, op TextOp) ([]rune, error) {
+	if op.Position < 0 || op.Delete < 0 || op.Position+op.Delete > len(doc) {
+		return nil, errors.New("operation out of range")
+	}
+	if op.Delete > 0 && op.Insert != "" {
+		return nil, errors.New("operation must either delete or insert")
+	}
+	out := make([]rune, 0, len(doc)-op.Delete+len(op.Insert))
+	out = append(out, doc[:op.Position]...)
+	out = append(out, []rune(op.Insert)...)
+	return append(out, doc[op.Position+op.Delete:]...), nil
+}
+
+func shiftCursor(pos int, op TextOp) int {
+	if op.Insert != "" {
+		if pos > op.Position {
+			pos += utf8.RuneCountInString(op.Insert)
+		}
+		return pos
+	}
+	switch {
+	case pos <= op.Position:
+		return pos
+	case pos < op.Position+op.Delete:
+		return op.Position
+	}
+	return pos - op.Delete
+}
+
+// submit rebases op, written against revision, applies it and returns the
+// operations actually applied with the revision reached.
+func (s *collabSession) submit(revision int, op TextOp) ([]TextOp, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	behind := s.revision - revision
+	if revision > s.revision || behind > len(s.history) {
+		return nil, 0, errors.New("revision out of range")
+	}
+	ops := []TextOp{op}
+	for _, applied := range s.history[len(s.history)-behind:] {
+		ops, _ = transformOps(ops, []TextOp{applied}, false)
+	}
+
+	for _, o := range ops {
+		if len(s.doc)+utf8.RuneCountInString(o.Insert) > maxCollabDocument {
+			return nil, 0, errCollabTooLarge
+		}
+		doc, err := applyOp(s.doc, o)
+		if err != nil {
+			return nil, 0, err
+		}
+		s.doc = doc
+		s.revision++
+		s.history = append(s.history, o)
+		for _, cursor := range s.clients {
+			if cursor != nil {
+				cursor.Position = shiftCursor(cursor.Position, o)
+				cursor.Anchor = shiftCursor(cursor.Anchor, o)
+			}
+		}
+	}
+	if len(s.history) > maxCollabHistory {
+		s.history = append([]TextOp(nil), s.history[len(s.history)-maxCollabHistory:]...)
+	}
+	return ops, s.revision, nil
+}
+
+func (s *collabSession) state() CollabState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return CollabState{
+		SessionID:   s.id,
+		ExerciseID:  s.exerciseID,
+		ClassroomID: s.classroomID,
+		Document:    string(s.doc),
+		Revision:    s.revision,
+		Members:     s.membersLocked(),
+	}
+}
+
+func (s *collabSession) membersLocked() []CollabMember {
+	members := []CollabMember{}
+	for client, cursor := range s.clients {
+		members = append(members, CollabMember{UserID: client.UserDBID, Name: client.Name, Cursor: cursor})
+	}
+	return members
+}
+
+// others returns the members except c.
+func (s *collabSession) others(c *Client) []*Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var clients []*Client
+	for client := range s.clients {
+		if client != c {
+			clients = append(clients, client)
+		}
+	}
+	return clients
+}
+
+// memberUsers returns the distinct users in the session, credited with the
+// submissions of its shared runs.
+func (s *collabSession) memberUsers() []uint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := map[uint]bool{}
+	var users []uint
+	for client := range s.clients {
+		if !seen[client.UserDBID] {
+			seen[client.UserDBID] = true
+			users = append(users, client.UserDBID)
+		}
+	}
+	return users
+}
+
+func (c *Client) currentCollab() *collabSession {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.collab
+}
+
+func (c *Client) sendCollabState(s *collabSession) {
+	state, _ := json.Marshal(s.state())
+	c.sendJSON(WSMsg{Type: "collab_state", SessionID: s.id, Payload: string(state)})
+}
+
+func (c *Client) publishCollabMembers(s *collabSession) {
+	s.mu.Lock()
+	members, _ := json.Marshal(s.membersLocked())
+	s.mu.Unlock()
+	c.publish(CollabRoom(s.id), WSMsg{Type: "collab_members", SessionID: s.id, Payload: string(members)})
+}
+
+// createCollab starts a shared document for an exercise of a classroom the
+// student is enrolled in, seeded with the student's code. Exams are solo work.
+func (c *Client) createCollab(msg WSMsg) {
+	if c.UserDBID == 0 {
+		c.sendJSON(WSMsg{Type: "collab_error", Payload: "Faça login para programar em dupla."})
+		return
+	}
+	classroomID, examTopicID := exerciseContext(msg.ExerciseID)
+	if msg.ExerciseID == 0 || classroomID == 0 || !access.Enrolled(c.UserDBID, classroomID) {
+		c.sendJSON(WSMsg{Type: "collab_error", Payload: "Exercício não encontrado nas suas turmas."})
+		return
+	}
+	if examTopicID != 0 {
+		c.sendJSON(WSMsg{Type: "collab_error", Payload: "Provas não podem ser feitas em dupla."})
+		return
+	}
+	if utf8.RuneCountInString(msg.Code) > maxCollabDocument {
+		c.sendJSON(WSMsg{Type: "collab_error", Payload: "Código grande demais para programar em dupla."})
+		return
+	}
+
+	s := &collabSession{
+		id:          newSessionID(),
+		exerciseID:  msg.ExerciseID,
+		classroomID: classroomID,
+		doc:         []rune(msg.Code),
+		clients:     make(map[*Client]*Cursor),
+	}
+	c.Hub.addSession(s)
+	c.joinSession(s)
+}
+
+// joinCollab adds a classroom member to an existing session.
+func (c *Client) joinCollab(msg WSMsg) {
+	s := c.Hub.session(msg.SessionID)
+	if s == nil || c.UserDBID == 0 || !access.Enrolled(c.UserDBID, s.classroomID) {
+		c.sendJSON(WSMsg{Type: "collab_error", Payload: "Sessão de programação em dupla não encontrada.", SessionID: msg.SessionID})
+		return
+	}
+	c.joinSession(s)
+}
+
+func (c *Client) joinSession(s *collabSession) {
+	if current := c.currentCollab(); current != nil && current != s {
+		c.leaveCollab()
+	}
+
+	s.mu.Lock()
+	s.clients[c] = nil
+	s.mu.Unlock()
+	c.mu.Lock()
+	c.collab = s
+	c.mu.Unlock()
+
+	c.Hub.Join(c, CollabRoom(s.id))
+	c.setContext(s.classroomID, s.exerciseID)
+	c.sendCollabState(s)
+	c.publishCollabMembers(s)
+}
+
+// leaveCollab removes the client from its session, closing the session when
+// the last member leaves.
+func (c *Client) leaveCollab() {
+	c.mu.Lock()
+	s := c.collab
+	c.collab = nil
+	c.mu.Unlock()
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	delete(s.clients, c)
+	if s.runner == c {
+		s.runner = nil
+	}
+	empty := len(s.clients) == 0
+	s.mu.Unlock()
+
+	c.Hub.Leave(c, CollabRoom(s.id))
+	if empty {
+		c.Hub.removeSession(s.id)
+		return
+	}
+	c.publishCollabMembers(s)
+}
+
+// collabEdit applies a member's edit and relays it: the author gets
+// collab_ack with the new revision, the others collab_op. Members share the
+// session's replica, so the relay goes straight to their connections.
+func (c *Client) collabEdit(msg WSMsg) {
+	s := c.currentCollab()
+	if s == nil || msg.Op == nil {
+		return
+	}
+	ops, revision, err := s.submit(msg.Revision, *msg.Op)
+	if errors.Is(err, errCollabTooLarge) {
+		c.sendJSON(WSMsg{Type: "collab_error", Payload: "O documento compartilhado atingiu o tamanho máximo.", SessionID: s.id})
+		c.sendCollabState(s)
+		return
+	}
+	if err != nil {
+		log.Printf("WS: Rejected collaborative edit from user %s: %v", c.UserID, err)
+		c.sendCollabState(s)
+		return
+	}
+
+	others := s.others(c)
+	first := revision - len(ops)
+	for i := range ops {
+		relay := WSMsg{Type: "collab_op", SessionID: s.id, Revision: first + i + 1, Op: &ops[i], StudentID: c.UserDBID, From: c.Name}
+		for _, other := range others {
+			other.sendJSON(relay)
+		}
+	}
+	c.sendJSON(WSMsg{Type: "collab_ack", SessionID: s.id, Revision: revision})
+}
+
+func (c *Client) collabCursor(msg WSMsg) {
+	s := c.currentCollab()
+	if s == nil || msg.Cursor == nil {
+		return
+	}
+	cursor := *msg.Cursor
+	s.mu.Lock()
+	s.clients[c] = &cursor
+	s.mu.Unlock()
+
+	relay := WSMsg{Type: "collab_cursor", SessionID: s.id, Cursor: &cursor, StudentID: c.UserDBID, From: c.Name}
+	for _, other := range s.others(c) {
+		other.sendJSON(relay)
+	}
+}
+
+// collabRun compiles and runs the shared document in the client's PTY. Every
+// member sees the output and may type input; the resulting submission is
+// credited to all of them.
+func (c *Client) collabRun() {
+	s := c.currentCollab()
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.runner != nil && s.runner != c {
+		s.mu.Unlock()
+		c.sendJSON(WSMsg{Type: "collab_error", Payload: "Já existe uma execução em andamento na dupla.", SessionID: s.id})
+		return
+	}
+	s.runner = c
+	code := string(s.doc)
+	s.mu.Unlock()
+
+	c.publish(CollabRoom(s.id), WSMsg{Type: "collab_run_started", SessionID: s.id, StudentID: c.UserDBID, From: c.Name})
+	go c.startCompilationAndRun(code, s.exerciseID, false, s)
+}
+
+// collabInput forwards terminal input from a member to the shared run.
+func (c *Client) collabInput(payload string) {
+	s := c.currentCollab()
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	runner := s.runner
+	s.mu.Unlock()
+	if runner == nil || runner == c {
+		return
+	}
+	runner.mu.Lock()
+	runner.writeInput(payload)
+	runner.mu.Unlock()
+}
+
+// finishRun frees the session for the next shared run.
+func (s *collabSession) finishRun(c *Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.runner == c {
+		s.runner = nil
+	}
+}
+
+// saveHistory stores the submission for the client and, for a shared run,
+// a copy for each other member of the session. It returns the copies saved.
+func (c *Client) saveHistory(history *models.History) ([]models.History, error) {
+	s := c.runSession.Load()
+	if s != nil {
+		history.CollabSessionID = s.id
+	}
+	if err := initializers.DB.Create(history).Error; err != nil {
+		return nil, err
+	}
+	if s == nil {
+		return nil, nil
+	}
+	var copies []models.History
+	for _, userID := range s.memberUsers() {
+		if userID == c.UserDBID {
+			continue
+		}
+		shared := *history
+		shared.ID = 0
+		shared.UserID = userID
+		if shared.ExerciseID != nil {
+			shared.HintLevel = tutor.UsedHintLevel(userID, *shared.ExerciseID)
+		}
+		if err := initializers.DB.Create(&shared).Error; err != nil {
+			log.Printf("Failed to credit shared submission to user %d: %v", userID, err)
+			continue
+		}
+		copies = append(copies, shared)
+	}
+	return copies, nil
+}
+
+func (h *Hub) addSession(s *collabSession) {
+	h.sessionMutex.Lock()
+	defer h.sessionMutex.Unlock()
+	h.sessions[s.id] = s
+}
+
+func (h *Hub) session(id string) *collabSession {
+	h.sessionMutex.RLock()
+	defer h.sessionMutex.RUnlock()
+	return h.sessions[id]
+}
+
+func (h *Hub) removeSession(id string) {
+	h.sessionMutex.Lock()
+	defer h.sessionMutex.Unlock()
+	delete(h.sessions, id)
+}
@@ -0,0 +1,142 @@
+package ws
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func applyAll(t *testing.T, doc string, ops []TextOp) string {
+	t.Helper()
+	runes := []rune(doc)
+	for _, op := range ops {
+		var err error
+		if runes, err = applyOp(runes, op); err != nil {
+			t.Fatalf("apply %+v to %q: %v", op, string(runes), err)
+		}
+	}
+	return string(runes)
+}
+
+func TestTransformOpsConverges(t *testing.T) {
+	tests := []struct {
+		name   string
+		doc    string
+		a, b   TextOp
+		aFirst bool
+		want   string
+	}{
+		{"insert/insert tie, a first", "ac", TextOp{Position: 1, Insert: "X"}, TextOp{Position: 1, Insert: "Y"}, true, "aXYc"},
+		{"insert/insert tie, b first", "ac", TextOp{Position: 1, Insert: "X"}, TextOp{Position: 1, Insert: "Y"}, false, "aYXc"},
+		{"inserts apart", "abc", TextOp{Position: 0, Insert: "<"}, TextOp{Position: 3, Insert: ">"}, true, "<abc>"},
+		{"delete spanning an insert", "abcdef", TextOp{Position: 1, Delete: 4}, TextOp{Position: 3, Insert: "XY"}, true, "aXYf"},
+		{"insert inside a delete", "abcdef", TextOp{Position: 3, Insert: "XY"}, TextOp{Position: 1, Delete: 4}, false, "aXYf"},
+		{"insert at delete start", "abcdef", TextOp{Position: 1, Delete: 2}, TextOp{Position: 1, Insert: "X"}, true, "aXdef"},
+		{"overlapping deletes", "abcdef", TextOp{Position: 1, Delete: 3}, TextOp{Position: 2, Delete: 3}, true, "af"},
+		{"same delete", "abcdef", TextOp{Position: 2, Delete: 2}, TextOp{Position: 2, Delete: 2}, true, "abef"},
+		{"multibyte text", "ação", TextOp{Position: 2, Insert: "ç"}, TextOp{Position: 1, Delete: 2}, true, "aço"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a2, b2 := transformOps([]TextOp{tt.a}, []TextOp{tt.b}, tt.aFirst)
+			viaA := applyAll(t, applyAll(t, tt.doc, []TextOp{tt.a}), b2)
+			viaB := applyAll(t, applyAll(t, tt.doc, []TextOp{tt.b}), a2)
+			if viaA != viaB {
+				t.Fatalf("a then b' = %q, b then a' = %q", viaA, viaB)
+			}
+			if viaA != tt.want {
+				t.Errorf("converged on %q, want %q", viaA, tt.want)
+			}
+		})
+	}
+}
+
+// collabClient mirrors the IDE: it applies its edits locally at once, and
+// rebases the unacknowledged ones over each relayed operation, taking the
+// relayed operation first.
+type collabClient struct {
+	doc      string
+	revision int
+	pending  []TextOp
+}
+
+func (c *collabClient) edit(t *testing.T, op TextOp) {
+	c.doc = applyAll(t, c.doc, []TextOp{op})
+	c.pending = append(c.pending, op)
+}
+
+func (c *collabClient) receive(t *testing.T, op TextOp) {
+	relayed, pending := transformOps([]TextOp{op}, c.pending, true)
+	c.doc = applyAll(t, c.doc, relayed)
+	c.pending = pending
+	c.revision++
+}
+
+func TestSubmitRebasesSeveralRevisionsBehind(t *testing.T) {
+	s := &collabSession{doc: []rune("int x;"), clients: map[*Client]*Cursor{}}
+	alice := &collabClient{doc: "int x;"}
+	bob := &collabClient{doc: "int x;"}
+
+	// Bob deletes "int x" at revision 0 while Alice's edits reach the server
+	bobOp := TextOp{Position: 0, Delete: 5}
+	bob.edit(t, bobOp)
+
+	for _, op := range []TextOp{
+		{Position: 4, Insert: "long "},
+		{Position: 10, Insert: " = 0"},
+		{Position: 0, Delete: 4},
+	} {
+		alice.edit(t, op)
+		applied, revision, err := s.submit(alice.revision, op)
+		if err != nil {
+			t.Fatalf("submit %+v: %v", op, err)
+		}
+		alice.pending, alice.revision = nil, revision
+		for _, o := range applied {
+			bob.receive(t, o)
+		}
+	}
+
+	applied, revision, err := s.submit(0, bobOp)
+	if err != nil {
+		t.Fatalf("submit three revisions behind: %v", err)
+	}
+	for _, o := range applied {
+		alice.receive(t, o)
+	}
+	bob.pending = nil
+
+	const want = "long  = 0;"
+	if got := string(s.doc); got != want {
+		t.Errorf("server document = %q, want %q", got, want)
+	}
+	if alice.doc != want || bob.doc != want {
+		t.Errorf("alice has %q and bob has %q, want %q", alice.doc, bob.doc, want)
+	}
+	if alice.revision != revision {
+		t.Errorf("alice is at revision %d, server at %d", alice.revision, revision)
+	}
+}
+
+func TestSubmitRejectsRevisionsOutOfRange(t *testing.T) {
+	s := &collabSession{doc: []rune("x"), clients: map[*Client]*Cursor{}}
+	if _, _, err := s.submit(1, TextOp{Position: 0, Insert: "a"}); err == nil {
+		t.Error("accepted an edit from a future revision")
+	}
+	if _, _, err := s.submit(0, TextOp{Position: 2, Delete: 1}); err == nil {
+		t.Error("accepted a delete past the end of the document")
+	}
+}
+
+func TestSubmitCapsDocumentSize(t *testing.T) {
+	s := &collabSession{doc: []rune(strings.Repeat("a", maxCollabDocument-1)), clients: map[*Client]*Cursor{}}
+	if _, _, err := s.submit(0, TextOp{Position: 0, Insert: "b"}); err != nil {
+		t.Fatalf("insert up to the cap: %v", err)
+	}
+	if _, _, err := s.submit(1, TextOp{Position: 0, Insert: "c"}); !errors.Is(err, errCollabTooLarge) {
+		t.Errorf("insert past the cap: err = %v, want errCollabTooLarge", err)
+	}
+	if _, _, err := s.submit(1, TextOp{Position: 0, Delete: 1}); err != nil {
+		t.Errorf("delete at the cap: %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/vitub/CLabServer/pkg/wsproto"
+)
+
+// negotiateProtocol picks the protocol version of a connection: 2 when the
+// client asked for the clab.v2 subprotocol, else ?protocol=, else 1.
+func negotiateProtocol(r *http.Request, conn *websocket.Conn) int32 {
+	if conn.Subprotocol() == wsproto.Subprotocol {
+		return wsproto.Version
+	}
+	if v, err := strconv.Atoi(r.URL.Query().Get("protocol")); err == nil && v >= 1 && v <= wsproto.Version {
+		return int32(v)
+	}
+	return 1
+}
+
+// frame is an outgoing message before it is encoded. Frames are kept in this
+// form until they are written, so those buffered while the client was away are
+// encoded for the protocol of the connection that replays them.
+type frame struct {
+	Type   string
+	Data   json.RawMessage
+	Legacy []byte // Protocol 1 form
+}
+
+// bytes encodes the frame for a protocol: legacy for protocol 1, an envelope
+// of its type and data otherwise.
+func (f frame) bytes(protocol int32) []byte {
+	if protocol < 2 {
+		return f.Legacy
+	}
+	encoded, _ := json.Marshal(wsproto.Envelope{V: wsproto.Version, Type: f.Type, Data: f.Data})
+	return encoded
+}
+
+// size is the larger of the frame's encodings, as counted by the replay buffer.
+func (f frame) size() int { return max(len(f.Type)+len(f.Data), len(f.Legacy)) }
+
+func newFrame(frameType string, data any, legacy []byte) frame {
+	raw, _ := json.Marshal(data)
+	return frame{Type: frameType, Data: raw, Legacy: legacy}
+}
+
+// messageFrame is the frame of a JSON message, which protocol 1 sends bare.
+func messageFrame(msg wsproto.Typed) frame {
+	legacy, _ := json.Marshal(msg)
+	return frame{Type: msg.FrameType(), Data: legacy, Legacy: legacy}
+}
+
+// emit sends a terminal frame. Frames of a shared run are also sent to the
+// other members of the session, who are connected to this replica.
+func (c *Client) emit(frameType string, data any, legacy string) {
+	c.record(frameType, legacy)
+	f := newFrame(frameType, data, []byte(legacy))
+	if !c.deliver(f) {
+		log.Printf("WS Send Buffer Full, dropping %s", frameType)
+	}
+
+	if s := c.runSession.Load(); s != nil {
+		for _, member := range s.others(c) {
+			member.deliver(f)
+		}
+	}
+}
+
+// sendOutput shows a server message in the terminal.
+func (c *Client) sendOutput(text string) {
+	c.emit(wsproto.TypeNotice, wsproto.Text{Text: text}, text)
+}
+
+func (c *Client) sendStdout(text string) {
+	c.emit(wsproto.TypeStdout, wsproto.Text{Text: text}, text)
+}
+
+// sendStderr sends the program's error output. Protocol 1 shows it inline with
+// stdout, as the terminal always did.
+func (c *Client) sendStderr(text string) {
+	c.emit(wsproto.TypeStderr, wsproto.Text{Text: text}, text)
+}
+
+// sendError reports that the server could not compile or run the code.
+func (c *Client) sendError(message string) {
+	c.emit(wsproto.TypeError, wsproto.Error{Message: message}, message)
+}
+
+func (c *Client) sendStatus(status string) {
+	legacy, _ := json.Marshal(WSMsg{Type: "status", Payload: status})
+	c.emit(wsproto.TypeStatus, wsproto.Status{Status: status}, string(legacy))
+}
+
+// sendCompileResult reports the compiler outcome. Protocol 1 only shows the
+// errors; warnings of a successful build are only sent in protocol 2.
+func (c *Client) sendCompileResult(success bool, output string) {
+	legacy := "Compilation successful.\r\nRunning...\r\n"
+	if !success {
+		legacy = "Compilation Error:\r\n" + output
+	}
+	c.emit(wsproto.TypeCompileResult, wsproto.CompileResult{Success: success, Output: output}, legacy)
+}
+
+func (c *Client) sendExit(exit wsproto.Exit) {
+	c.emit(wsproto.TypeExit, exit, exit.Message)
+}
+
+// exitInfo describes how cmd ended after Wait returned err. cmd is the sandbox
+// client, so the signal comes from the exit code the sandbox reports for the
+// program (128+n); the client's own rusage says nothing about the program.
+func exitInfo(cmd *exec.Cmd, err error, started time.Time) wsproto.Exit {
+	exit := wsproto.Exit{DurationMs: time.Since(started).Milliseconds()}
+	state := cmd.ProcessState
+	if state == nil {
+		exit.Code = -1
+		return exit
+	}
+	exit.Code = state.ExitCode()
+	if exit.Code > 128 {
+		exit.Signal = signalName(syscall.Signal(exit.Code - 128))
+	}
+	return exit
+}
+
+var signalNames = map[syscall.Signal]string{
+	syscall.SIGABRT: "SIGABRT",
+	syscall.SIGBUS:  "SIGBUS",
+	syscall.SIGFPE:  "SIGFPE",
+	syscall.SIGILL:  "SIGILL",
+	syscall.SIGKILL: "SIGKILL",
+	syscall.SIGPIPE: "SIGPIPE",
+	syscall.SIGSEGV: "SIGSEGV",
+	syscall.SIGTERM: "SIGTERM",
+	syscall.SIGXCPU: "SIGXCPU",
+}
+
+func signalName(sig syscall.Signal) string {
+	if name, ok := signalNames[sig]; ok {
+		return name
+	}
+	return fmt.Sprintf("SIG%d", int(sig))
+}
@@ -1,100 +1,269 @@
 package ws
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
+	"strings"
 	"sync"
+
+	"github.com/vitub/CLabServer/pkg/wsproto"
 )
 
 type Hub struct {
 	clients map[*Client]bool
 
-	broadcast chan []byte
-
 	register chan *Client
 
 	unregister chan *Client
 
-	monitors map[string]map[*Client]bool
+	// rooms holds the clients subscribed to each room, by room name
+	rooms map[string]map[*Client]bool
+
+	roomMutex sync.RWMutex
+
+	// sessions holds the open collaborative editing sessions, by ID. They live
+	// in this process only: their members must be connected to this replica,
+	// which is why multi-replica deployments need sticky sessions.
+	sessions map[string]*collabSession
+
+	sessionMutex sync.RWMutex
+
+	// resumable holds the live clients by resume ID, including those waiting
+	// for a reconnect. A reconnect can only resume on this replica.
+	resumable map[string]*Client
+
+	resumeMutex sync.RWMutex
+
+	// broker carries room messages to the hubs of every replica, this one
+	// included
+	broker Broker
+
+	// eventHandlers are called with the hub events published by any replica
+	eventHandlers map[string][]func(json.RawMessage)
+
+	eventMutex sync.RWMutex
+
+	// heartbeats holds the resume IDs of the sessions that answered a ping
+	// since the last presence flush
+	heartbeats map[string]bool
+
+	heartbeatMutex sync.Mutex
+}
+
+// Hub events are published through the broker like room messages but handled
+// by the hubs themselves, to tell every replica about a change.
+const (
+	// EventPromptsChanged means a prompt override was saved or removed.
+	EventPromptsChanged = "prompts_changed"
+	// EventMembershipChanged means a user joined or left a classroom; its data
+	// is a MembershipChange.
+	EventMembershipChanged = "membership_changed"
+)
 
-	monitorMutex sync.RWMutex
+// MembershipChange is the data of EventMembershipChanged.
+type MembershipChange struct {
+	UserID      uint `json:"userId"`
+	ClassroomID uint `json:"classroomId"`
 }
 
-func NewHub() *Hub {
-	return &Hub{
-		broadcast:  make(chan []byte),
+// eventRoomPrefix marks the broker messages that carry hub events.
+const eventRoomPrefix = "event:"
+
+// Room names. A client joins its user room on connect, the classroom rooms of
+// the classrooms it studies or teaches in, and the monitor rooms a teacher
+// subscribes to. Classroom rooms follow membership changes while connected.
+func UserRoom(userID uint) string           { return fmt.Sprintf("user:%d", userID) }
+func ClassroomRoom(classroomID uint) string { return fmt.Sprintf("classroom:%d", classroomID) }
+func MonitorRoom(classroomID uint) string   { return fmt.Sprintf("monitor:%d", classroomID) }
+
+// NewHub returns a hub publishing through broker; nil keeps rooms within this
+// process.
+func NewHub(broker Broker) *Hub {
+	if broker == nil {
+		broker = NewMemoryBroker()
+	}
+	h := &Hub{
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
 		clients:    make(map[*Client]bool),
-		monitors:   make(map[string]map[*Client]bool),
+		rooms:      make(map[string]map[*Client]bool),
+		sessions:   make(map[string]*collabSession),
+		resumable:  make(map[string]*Client),
+		broker:     broker,
+
+		eventHandlers: make(map[string][]func(json.RawMessage)),
+		heartbeats:    make(map[string]bool),
+	}
+	h.OnEvent(EventMembershipChanged, h.membershipChanged)
+	broker.Subscribe(h.dispatch)
+	return h
+}
+
+// NotifyMembershipChanged tells every replica that the user was added to or
+// removed from the classroom, so the user's open sessions gain or lose its
+// rooms.
+func (h *Hub) NotifyMembershipChanged(userID uint, classroomID uint) {
+	h.PublishEvent(EventMembershipChanged, MembershipChange{UserID: userID, ClassroomID: classroomID})
+}
+
+func (h *Hub) membershipChanged(data json.RawMessage) {
+	var change MembershipChange
+	if err := json.Unmarshal(data, &change); err != nil {
+		log.Printf("WS: Invalid %s event: %v", EventMembershipChanged, err)
+		return
+	}
+	for _, client := range h.Members(UserRoom(change.UserID)) {
+		client.recheckClassroom(change.ClassroomID)
+	}
+}
+
+// OnEvent registers a handler for a hub event. Handlers run in their own
+// goroutine, on the publishing replica too.
+func (h *Hub) OnEvent(event string, handler func(data json.RawMessage)) {
+	h.eventMutex.Lock()
+	defer h.eventMutex.Unlock()
+	h.eventHandlers[event] = append(h.eventHandlers[event], handler)
+}
+
+// PublishEvent sends a hub event to every replica sharing the broker.
+func (h *Hub) PublishEvent(event string, data any) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("WS: Failed to encode event %s: %v", event, err)
+		return
+	}
+	if err := h.broker.Publish(BrokerMessage{Room: eventRoomPrefix + event, Type: event, Data: encoded}); err != nil {
+		log.Printf("WS: Failed to publish event %s: %v", event, err)
+	}
+}
+
+// dispatch routes a brokered message to the event handlers or to a room.
+func (h *Hub) dispatch(msg BrokerMessage) {
+	event, ok := strings.CutPrefix(msg.Room, eventRoomPrefix)
+	if !ok {
+		h.deliverToRoom(msg)
+		return
+	}
+	h.eventMutex.RLock()
+	defer h.eventMutex.RUnlock()
+	for _, handler := range h.eventHandlers[event] {
+		go handler(msg.Data)
 	}
 }
 
+// Run serves client registrations and starts the hub's periodic cleanups.
 func (h *Hub) Run() {
+	go expireRecordingsRoutine()
+	go h.presenceRoutine()
 	for {
 		select {
 		case client := <-h.register:
 			h.clients[client] = true
-			if client.Role == "TEACHER" || client.Role == "ADMIN" {
-				h.registerMonitor(client)
-			}
 			log.Printf("Client connected: %s (Role: %s)", client.UserID, client.Role)
 
 		case client := <-h.unregister:
 			if _, ok := h.clients[client]; ok {
 				delete(h.clients, client)
-				close(client.send)
-				if client.Role == "TEACHER" || client.Role == "ADMIN" {
-					h.unregisterMonitor(client)
-				}
+				h.leaveAll(client)
 				log.Printf("Client disconnected: %s", client.UserID)
 			}
-
-		case message := <-h.broadcast:
-			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
-				}
-			}
 		}
 	}
 }
 
-func (h *Hub) registerMonitor(client *Client) {
-	h.monitorMutex.Lock()
-	defer h.monitorMutex.Unlock()
+// Join adds the client to the room. Callers check that the client may read
+// what is published there.
+func (h *Hub) Join(client *Client, room string) {
+	h.roomMutex.Lock()
+	defer h.roomMutex.Unlock()
 
-	if _, ok := h.monitors["monitor"]; !ok {
-		h.monitors["monitor"] = make(map[*Client]bool)
+	if _, ok := h.rooms[room]; !ok {
+		h.rooms[room] = make(map[*Client]bool)
 	}
-	h.monitors["monitor"][client] = true
+	h.rooms[room][client] = true
 }
 
-func (h *Hub) unregisterMonitor(client *Client) {
-	h.monitorMutex.Lock()
-	defer h.monitorMutex.Unlock()
+func (h *Hub) Leave(client *Client, room string) {
+	h.roomMutex.Lock()
+	defer h.roomMutex.Unlock()
 
-	if group, ok := h.monitors["monitor"]; ok {
-		delete(group, client)
+	if members, ok := h.rooms[room]; ok {
+		delete(members, client)
+		if len(members) == 0 {
+			delete(h.rooms, room)
+		}
 	}
 }
 
-func (h *Hub) BroadcastToMonitors(message []byte) {
-	h.monitorMutex.RLock()
-	defer h.monitorMutex.RUnlock()
+// LeavePrefix removes the client from every room whose name starts with prefix.
+func (h *Hub) LeavePrefix(client *Client, prefix string) {
+	h.roomMutex.Lock()
+	defer h.roomMutex.Unlock()
 
-	if group, ok := h.monitors["monitor"]; ok {
-		for client := range group {
-			select {
-			case client.send <- message:
-			default:
-			}
+	for room, members := range h.rooms {
+		if !strings.HasPrefix(room, prefix) {
+			continue
+		}
+		delete(members, client)
+		if len(members) == 0 {
+			delete(h.rooms, room)
 		}
 	}
 }
 
-func (h *Hub) BroadcastToAll(message []byte) {
-	h.broadcast <- message
+func (h *Hub) leaveAll(client *Client) {
+	h.roomMutex.Lock()
+	defer h.roomMutex.Unlock()
+
+	for room, members := range h.rooms {
+		delete(members, client)
+		if len(members) == 0 {
+			delete(h.rooms, room)
+		}
+	}
+}
+
+// PublishToRoom sends the message to every client in the room, on every
+// replica sharing the hub's broker.
+func (h *Hub) PublishToRoom(room string, msg wsproto.Typed) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("WS: Failed to encode %s for %s: %v", msg.FrameType(), room, err)
+		return
+	}
+	if err := h.broker.Publish(BrokerMessage{Room: room, Type: msg.FrameType(), Data: data}); err != nil {
+		log.Printf("WS: Failed to publish %s to %s: %v", msg.FrameType(), room, err)
+	}
+}
+
+// deliverToRoom sends a brokered message to the hub's clients in its room.
+// Clients whose send buffer is full miss the message.
+func (h *Hub) deliverToRoom(msg BrokerMessage) {
+	h.roomMutex.RLock()
+	defer h.roomMutex.RUnlock()
+
+	f := frame{Type: msg.Type, Data: msg.Data, Legacy: msg.Data}
+	for client := range h.rooms[msg.Room] {
+		client.deliver(f)
+	}
+}
+
+// InRoom reports whether the client is in the room.
+func (h *Hub) InRoom(client *Client, room string) bool {
+	h.roomMutex.RLock()
+	defer h.roomMutex.RUnlock()
+	return h.rooms[room][client]
+}
+
+// Members returns the clients currently in the room.
+func (h *Hub) Members(room string) []*Client {
+	h.roomMutex.RLock()
+	defer h.roomMutex.RUnlock()
+
+	members := make([]*Client, 0, len(h.rooms[room]))
+	for client := range h.rooms[room] {
+		members = append(members, client)
+	}
+	return members
 }
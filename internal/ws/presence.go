@@ -0,0 +1,247 @@
+package ws
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/vitub/CLabServer/internal/access"
+	"github.com/vitub/CLabServer/internal/initializers"
+	"github.com/vitub/CLabServer/internal/models"
+	"gorm.io/gorm/clause"
+)
+
+// presenceTimeout is how long a session stays online without a pong, which
+// covers replicas that stopped without marking their sessions offline.
+const presenceTimeout = 2 * pongWait
+
+// presenceRetention is how long the sessions of offline users are kept to
+// report when they were last seen.
+const presenceRetention = 7 * 24 * time.Hour
+
+// presenceFlushInterval is how often the pongs received are written to the
+// presences table, in one UPDATE for all the hub's sessions. It stays well
+// below presenceTimeout.
+const presenceFlushInterval = 15 * time.Second
+
+// presenceCleanupInterval is how often sessions past presenceRetention are
+// deleted.
+const presenceCleanupInterval = time.Hour
+
+// PresenceEntry is what the teachers of a classroom see of a student: whether
+// any of their sessions is online and, within that classroom only, what they
+// have open and how their last run went.
+type PresenceEntry struct {
+	UserID        uint       `json:"userId"`
+	Name          string     `json:"name"`
+	Online        bool       `json:"online"`
+	Sessions      int        `json:"sessions"`              // Open IDE sessions
+	ClassroomID   uint       `json:"classroomId,omitempty"` // The classroom, when a session is working in it
+	ExerciseID    uint       `json:"exerciseId,omitempty"`  // Exercise open in the most recent session working in the classroom
+	LastSeenAt    *time.Time `json:"lastSeenAt,omitempty"`
+	LastRunAt     *time.Time `json:"lastRunAt,omitempty"`
+	LastRunFailed bool       `json:"lastRunFailed"`
+}
+
+// ClassroomPresence returns the presence of every student enrolled in the
+// classroom, by name.
+func ClassroomPresence(classroomID uint) ([]PresenceEntry, error) {
+	var students []models.User
+	err := initializers.DB.Select("id", "name").
+		Where("id IN (SELECT user_id FROM classroom_students WHERE classroom_id = ?)", classroomID).
+		Order("name").Find(&students).Error
+	if err != nil {
+		return nil, err
+	}
+	return presenceOf(students, classroomID)
+}
+
+// presenceOf returns the users' presence as seen from the classroom: the open
+// exercise comes from sessions working in it and the last run from its
+// exercises.
+func presenceOf(users []models.User, classroomID uint) ([]PresenceEntry, error) {
+	if len(users) == 0 {
+		return []PresenceEntry{}, nil
+	}
+	ids := make([]uint, 0, len(users))
+	for _, u := range users {
+		ids = append(ids, u.ID)
+	}
+
+	var sessions []models.Presence
+	if err := initializers.DB.Where("user_id IN ?", ids).Order("last_seen_at DESC").Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	var runs []struct {
+		UserID    uint
+		CreatedAt time.Time
+		IsSuccess bool
+	}
+	err := initializers.DB.Model(&models.History{}).
+		Select("DISTINCT ON (histories.user_id) histories.user_id, histories.created_at, histories.is_success").
+		Joins("JOIN exercises ON exercises.id = histories.exercise_id").
+		Where("histories.user_id IN ?", ids).
+		Where("exercises.classroom_id = ? OR exercises.topic_id IN (SELECT id FROM exercise_topics WHERE classroom_id = ?)", classroomID, classroomID).
+		Order("histories.user_id, histories.created_at DESC").
+		Scan(&runs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[uint]*PresenceEntry, len(users))
+	list := make([]PresenceEntry, len(users))
+	for i, u := range users {
+		list[i] = PresenceEntry{UserID: u.ID, Name: u.Name}
+		entries[u.ID] = &list[i]
+	}
+
+	online := time.Now().Add(-presenceTimeout)
+	inClassroom := make(map[uint]bool, len(users))
+	for _, s := range sessions {
+		entry := entries[s.UserID]
+		if entry.LastSeenAt == nil {
+			lastSeen := s.LastSeenAt
+			entry.LastSeenAt = &lastSeen
+		}
+		if s.ClassroomID == classroomID && !inClassroom[s.UserID] {
+			inClassroom[s.UserID] = true
+			entry.ClassroomID, entry.ExerciseID = s.ClassroomID, s.ExerciseID
+		}
+		if s.Connected && s.LastSeenAt.After(online) {
+			entry.Online = true
+			entry.Sessions++
+		}
+	}
+	for _, run := range runs {
+		entry := entries[run.UserID]
+		lastRun := run.CreatedAt
+		entry.LastRunAt = &lastRun
+		entry.LastRunFailed = !run.IsSuccess
+	}
+	return list, nil
+}
+
+// presenceSync records the session as online or offline to match its
+// connection, and tells the monitoring teachers when that changed.
+func (c *Client) presenceSync() {
+	if c.UserDBID == 0 {
+		return
+	}
+	c.connMu.Lock()
+	connected := !c.detached && !c.isClosed.Load()
+	c.connMu.Unlock()
+
+	c.presenceMu.Lock()
+	defer c.presenceMu.Unlock()
+	if connected == c.present {
+		return
+	}
+	c.present = connected
+
+	now := time.Now()
+	if connected {
+		c.mu.Lock()
+		session := models.Presence{
+			SessionID:   c.resumeID,
+			UserID:      c.UserDBID,
+			ClassroomID: c.classroomID,
+			ExerciseID:  c.exerciseID,
+			Connected:   true,
+			ConnectedAt: now,
+			LastSeenAt:  now,
+		}
+		c.mu.Unlock()
+		err := initializers.DB.Clauses(clause.OnConflict{UpdateAll: true}).Create(&session).Error
+		if err != nil {
+			log.Printf("Failed to record presence of user %d: %v", c.UserDBID, err)
+		}
+	} else {
+		initializers.DB.Model(&models.Presence{}).Where("session_id = ?", c.resumeID).
+			Updates(map[string]interface{}{"connected": false, "last_seen_at": now})
+	}
+	c.publishPresence()
+}
+
+// presenceHeartbeat keeps the session online; it is called on every pong and
+// only marks the session for the next flush.
+func (c *Client) presenceHeartbeat() {
+	if c.UserDBID == 0 {
+		return
+	}
+	c.Hub.heartbeatMutex.Lock()
+	c.Hub.heartbeats[c.resumeID] = true
+	c.Hub.heartbeatMutex.Unlock()
+}
+
+// flushHeartbeats renews the sessions that answered a ping since the last
+// flush.
+func (h *Hub) flushHeartbeats() {
+	h.heartbeatMutex.Lock()
+	sessions := make([]string, 0, len(h.heartbeats))
+	for id := range h.heartbeats {
+		sessions = append(sessions, id)
+	}
+	h.heartbeats = make(map[string]bool)
+	h.heartbeatMutex.Unlock()
+	if len(sessions) == 0 {
+		return
+	}
+
+	err := initializers.DB.Model(&models.Presence{}).Where("session_id IN ?", sessions).
+		Update("last_seen_at", time.Now()).Error
+	if err != nil {
+		log.Printf("Failed to renew presence of %d sessions: %v", len(sessions), err)
+	}
+}
+
+// presenceRoutine flushes the heartbeats every presenceFlushInterval and
+// deletes the sessions past the retention period every
+// presenceCleanupInterval.
+func (h *Hub) presenceRoutine() {
+	flush := time.NewTicker(presenceFlushInterval)
+	defer flush.Stop()
+	cleanup := time.NewTicker(presenceCleanupInterval)
+	defer cleanup.Stop()
+
+	for {
+		select {
+		case <-flush.C:
+			h.flushHeartbeats()
+		case <-cleanup.C:
+			initializers.DB.Where("last_seen_at < ?", time.Now().Add(-presenceRetention)).Delete(&models.Presence{})
+		}
+	}
+}
+
+// presenceContext records the classroom and exercise the student has open.
+func (c *Client) presenceContext(classroomID uint, exerciseID uint) {
+	if c.UserDBID == 0 {
+		return
+	}
+	initializers.DB.Model(&models.Presence{}).Where("session_id = ?", c.resumeID).
+		Updates(map[string]interface{}{"classroom_id": classroomID, "exercise_id": exerciseID, "last_seen_at": time.Now()})
+	c.publishPresence()
+}
+
+// publishPresence sends the student's presence to the teachers monitoring
+// each classroom they are enrolled in, as seen from that classroom.
+func (c *Client) publishPresence() {
+	for _, classroomID := range access.EnrolledClassrooms(c.UserDBID) {
+		entries, err := presenceOf([]models.User{{ID: c.UserDBID, Name: c.Name}}, classroomID)
+		if err != nil {
+			log.Printf("Failed to load presence of user %d: %v", c.UserDBID, err)
+			return
+		}
+		entry := entries[0]
+		payload, _ := json.Marshal(entry)
+		c.Hub.PublishToRoom(MonitorRoom(classroomID), MonitorMsg{
+			Type:        "presence",
+			UserID:      c.UserID,
+			UserName:    c.Name,
+			ClassroomID: classroomID,
+			ExerciseID:  entry.ExerciseID,
+			Payload:     string(payload),
+			Timestamp:   time.Now().Format(time.RFC3339),
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/vitub/CLabServer/internal/initializers"
+	"github.com/vitub/CLabServer/internal/models"
+	"github.com/vitub/CLabServer/pkg/wsproto"
+)
+
+// recordingRetention is RECORDING_RETENTION (default 720h): how long terminal
+// recordings are kept. 0 keeps them forever.
+func recordingRetention() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("RECORDING_RETENTION")); err == nil && d >= 0 {
+		return d
+	}
+	return 30 * 24 * time.Hour
+}
+
+// recordingMaxBytes is RECORDING_MAX_BYTES (default 1MB): the size past which
+// the rest of a run is not recorded.
+func recordingMaxBytes() int {
+	if n, err := strconv.Atoi(os.Getenv("RECORDING_MAX_BYTES")); err == nil && n > 0 {
+		return n
+	}
+	return 1024 * 1024
+}
+
+// recorder collects the asciicast v2 events of one run: "o" for what the
+// terminal showed, "i" for what was typed and "r" for resizes.
+type recorder struct {
+	mu        sync.Mutex
+	start     time.Time
+	width     int
+	height    int
+	events    bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func newRecorder(cols, rows int) *recorder {
+	if cols <= 0 || rows <= 0 {
+		cols, rows = 80, 24
+	}
+	return &recorder{start: time.Now(), width: cols, height: rows, max: recordingMaxBytes()}
+}
+
+func (r *recorder) event(code string, data string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.truncated {
+		return
+	}
+	elapsed := float64(time.Since(r.start).Microseconds()) / 1e6
+	line, _ := json.Marshal([]any{elapsed, code, data})
+	if r.events.Len()+len(line)+1 > r.max {
+		r.truncated = true
+		return
+	}
+	r.events.Write(line)
+	r.events.WriteByte('\n')
+}
+
+func (r *recorder) resize(cols, rows int) {
+	r.event("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+// record adds a terminal frame of the client's run to its recording.
+func (c *Client) record(frameType string, text string) {
+	switch frameType {
+	case wsproto.TypeStdout, wsproto.TypeStderr, wsproto.TypeNotice, wsproto.TypeExit:
+	default:
+		return
+	}
+	c.mu.Lock()
+	rec := c.recording
+	c.mu.Unlock()
+	if rec != nil && text != "" {
+		rec.event("o", text)
+	}
+}
+
+// writeInput types into the running program, recording the keystrokes.
+// The caller holds c.mu.
+func (c *Client) writeInput(payload string) {
+	if c.ptyFile == nil {
+		return
+	}
+	c.ptyFile.Write([]byte(payload))
+	if c.recording != nil {
+		c.recording.event("i", payload)
+	}
+}
+
+// recordingCleanupInterval is how often recordings past the retention period
+// are deleted.
+const recordingCleanupInterval = time.Hour
+
+// saveRecording stores the run's recording for each history entry of the run:
+// the runner's and, for a shared run, the copy of every other member.
+func saveRecording(rec *recorder, histories []models.History, title string) {
+	rec.mu.Lock()
+	header, _ := json.Marshal(map[string]any{
+		"version":   2,
+		"width":     rec.width,
+		"height":    rec.height,
+		"timestamp": rec.start.Unix(),
+		"title":     title,
+		"env":       map[string]string{"TERM": "xterm-256color"},
+	})
+	cast := string(header) + "\n" + rec.events.String()
+	width, height, truncated := rec.width, rec.height, rec.truncated
+	duration := time.Since(rec.start).Seconds()
+	rec.mu.Unlock()
+
+	for _, history := range histories {
+		recording := models.TerminalRecording{
+			HistoryID: history.ID,
+			UserID:    history.UserID,
+			Width:     width,
+			Height:    height,
+			Duration:  duration,
+			Truncated: truncated,
+			Cast:      cast,
+		}
+		if err := initializers.DB.Create(&recording).Error; err != nil {
+			log.Printf("Failed to save terminal recording of history %d: %v", history.ID, err)
+		}
+	}
+}
+
+// expireRecordingsRoutine deletes the recordings past the retention period
+// every recordingCleanupInterval.
+func expireRecordingsRoutine() {
+	ticker := time.NewTicker(recordingCleanupInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		retention := recordingRetention()
+		if retention == 0 {
+			continue
+		}
+		result := initializers.DB.Where("created_at < ?", time.Now().Add(-retention)).Delete(&models.TerminalRecording{})
+		if result.Error != nil {
+			log.Printf("Failed to delete expired terminal recordings: %v", result.Error)
+		} else if result.RowsAffected > 0 {
+			log.Printf("Deleted %d expired terminal recordings", result.RowsAffected)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package ws
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/vitub/CLabServer/pkg/wsproto"
+)
+
+// resumeGrace is WS_RESUME_GRACE (default 2m): how long a logged-in client's
+// running job and output are kept after its connection drops. 0 disables
+// resuming.
+func resumeGrace() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("WS_RESUME_GRACE")); err == nil && d >= 0 {
+		return d
+	}
+	return 2 * time.Minute
+}
+
+// resumeBufferSize is WS_RESUME_BUFFER (default 256KB): how many bytes of
+// frames are kept for replay while a client is disconnected.
+func resumeBufferSize() int {
+	if n, err := strconv.Atoi(os.Getenv("WS_RESUME_BUFFER")); err == nil && n > 0 {
+		return n
+	}
+	return 256 * 1024
+}
+
+// outputBuffer is a ring of the frames sent while the client was away. The
+// oldest frames are dropped once it holds more than max bytes.
+type outputBuffer struct {
+	frames    []frame
+	size      int
+	max       int
+	truncated bool
+}
+
+func (b *outputBuffer) add(f frame) {
+	b.frames = append(b.frames, f)
+	b.size += f.size()
+	for b.size > b.max && len(b.frames) > 0 {
+		b.size -= b.frames[0].size()
+		b.frames = b.frames[1:]
+		b.truncated = true
+	}
+}
+
+// drain returns the buffered frames and empties the buffer.
+func (b *outputBuffer) drain() ([]frame, bool) {
+	frames, truncated := b.frames, b.truncated
+	b.frames, b.size, b.truncated = nil, 0, false
+	return frames, truncated
+}
+
+func newResumeID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// deliver queues a frame for the connection, or keeps it for replay while the
+// client is disconnected. It reports false if the frame was dropped.
+func (c *Client) deliver(f frame) bool {
+	if c.isClosed.Load() {
+		return false
+	}
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+
+	if c.detached {
+		c.missed.add(f)
+		return true
+	}
+	select {
+	case c.send <- f:
+		return true
+	default:
+		return false
+	}
+}
+
+// attach starts serving the client on conn, replacing any previous connection.
+// The session ID and the frames missed in between are queued ahead of any new
+// output, all encoded for the protocol of conn.
+func (c *Client) attach(conn *websocket.Conn, protocol int32) {
+	c.protocol.Store(protocol)
+
+	c.connMu.Lock()
+	if !c.detached && c.send != nil {
+		close(c.send)
+	}
+	if c.graceTimer != nil {
+		c.graceTimer.Stop()
+		c.graceTimer = nil
+	}
+	missed, truncated := c.missed.drain()
+	send := make(chan frame, 256+len(missed)+2)
+	send <- messageFrame(WSMsg{Type: wsproto.TypeSession, Payload: c.resumeID})
+	if truncated {
+		notice := "\r\n\x1b[33m[Saída anterior truncada durante a desconexão]\x1b[0m\r\n"
+		send <- newFrame(wsproto.TypeNotice, wsproto.Text{Text: notice}, []byte(notice))
+	}
+	for _, f := range missed {
+		send <- f
+	}
+	c.gen++
+	gen := c.gen
+	c.send = send
+	c.detached = false
+	c.connMu.Unlock()
+
+	go c.writePump(conn, send, protocol)
+	go c.readPump(conn, gen)
+	c.presenceSync()
+}
+
+// detach keeps the client and its job alive for the grace period after its
+// connection gen dropped. Guests and disabled resuming end the client at once.
+func (c *Client) detach(gen int) {
+	grace := resumeGrace()
+	if c.UserDBID == 0 || grace == 0 {
+		c.terminate()
+		return
+	}
+
+	c.connMu.Lock()
+	if c.gen != gen || c.detached {
+		c.connMu.Unlock()
+		return
+	}
+	c.detached = true
+	for pending := true; pending; {
+		select {
+		case f := <-c.send:
+			c.missed.add(f)
+		default:
+			pending = false
+		}
+	}
+	close(c.send)
+	c.graceTimer = time.AfterFunc(grace, func() {
+		c.connMu.Lock()
+		expired := c.detached && c.gen == gen
+		c.connMu.Unlock()
+		if expired {
+			log.Printf("WS: Session of user %s expired after disconnect", c.UserID)
+			c.terminate()
+		}
+	})
+	c.connMu.Unlock()
+	c.presenceSync()
+	log.Printf("WS: User %s disconnected, keeping session for %s", c.UserID, grace)
+}
+
+// terminate ends the client: its job is killed and it leaves the hub.
+func (c *Client) terminate() {
+	if c.isClosed.Swap(true) {
+		return
+	}
+	c.Hub.removeResumable(c.resumeID)
+	c.Hub.unregister <- c
+
+	c.connMu.Lock()
+	if !c.detached {
+		close(c.send)
+		c.detached = true
+	}
+	c.connMu.Unlock()
+	c.presenceSync()
+
+	c.mu.Lock()
+	if c.ptyFile != nil {
+		c.ptyFile.Close()
+	}
+	if c.cmd != nil && c.cmd.Process != nil {
+		c.cmd.Process.Kill()
+	}
+	c.mu.Unlock()
+	c.cancelAIStream()
+	c.leaveCollab()
+}
+
+func (h *Hub) addResumable(c *Client) {
+	h.resumeMutex.Lock()
+	defer h.resumeMutex.Unlock()
+	h.resumable[c.resumeID] = c
+}
+
+// resume returns the live client with the ID if it belongs to the user.
+func (h *Hub) resume(id string, userID uint) *Client {
+	h.resumeMutex.RLock()
+	defer h.resumeMutex.RUnlock()
+	c := h.resumable[id]
+	if c == nil || userID == 0 || c.UserDBID != userID || c.isClosed.Load() {
+		return nil
+	}
+	return c
+}
+
+func (h *Hub) removeResumable(id string) {
+	h.resumeMutex.Lock()
+	defer h.resumeMutex.Unlock()
+	delete(h.resumable, id)
+}
@@ -0,0 +1,39 @@
+package ws
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/vitub/CLabServer/pkg/wsproto"
+)
+
+func TestMissedFramesEncodedForResumingProtocol(t *testing.T) {
+	c := &Client{detached: true, missed: outputBuffer{max: 1024}}
+	c.deliver(newFrame(wsproto.TypeStdout, wsproto.Text{Text: "Soma: 7\n"}, []byte("Soma: 7\n")))
+	c.deliver(messageFrame(WSMsg{Type: "teacher_message", Payload: "Olhe o laço"}))
+
+	frames, truncated := c.missed.drain()
+	if truncated || len(frames) != 2 {
+		t.Fatalf("drained %d frames (truncated %v), want 2", len(frames), truncated)
+	}
+
+	if got := string(frames[0].bytes(1)); got != "Soma: 7\n" {
+		t.Errorf("protocol 1 stdout = %q, want the raw text", got)
+	}
+	var env wsproto.Envelope
+	if err := json.Unmarshal(frames[0].bytes(2), &env); err != nil || env.V != wsproto.Version || env.Type != wsproto.TypeStdout {
+		t.Fatalf("protocol 2 stdout = %s (%v), want an envelope", frames[0].bytes(2), err)
+	}
+	var text wsproto.Text
+	if err := json.Unmarshal(env.Data, &text); err != nil || text.Text != "Soma: 7\n" {
+		t.Errorf("protocol 2 stdout data = %s", env.Data)
+	}
+
+	var bare WSMsg
+	if err := json.Unmarshal(frames[1].bytes(1), &bare); err != nil || bare.Type != "teacher_message" {
+		t.Errorf("protocol 1 message = %s (%v), want the bare message", frames[1].bytes(1), err)
+	}
+	if err := json.Unmarshal(frames[1].bytes(2), &env); err != nil || env.Type != "teacher_message" {
+		t.Errorf("protocol 2 message = %s (%v), want an envelope", frames[1].bytes(2), err)
+	}
+}
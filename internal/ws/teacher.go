@@ -0,0 +1,135 @@
+package ws
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/vitub/CLabServer/internal/access"
+	"github.com/vitub/CLabServer/internal/initializers"
+	"github.com/vitub/CLabServer/internal/models"
+)
+
+// WatchRoom receives the live editor state of a student while the student
+// works in the classroom. Teachers of another of the student's classrooms do
+// not see it.
+func WatchRoom(classroomID uint, studentID uint) string {
+	return fmt.Sprintf("watch:%d:%d", classroomID, studentID)
+}
+
+// watchRoomPrefix is the start of the names of a classroom's watch rooms.
+func watchRoomPrefix(classroomID uint) string { return fmt.Sprintf("watch:%d:", classroomID) }
+
+// reachStudent reports whether the client may act on the student: it must
+// teach the classroom and the student must be enrolled in it. The failure is
+// sent back as teacher_error.
+func (c *Client) reachStudent(msg WSMsg) bool {
+	if c.Role != "TEACHER" && c.Role != "ADMIN" {
+		c.sendJSON(WSMsg{Type: "teacher_error", Payload: "Apenas professores podem acessar alunos.", StudentID: msg.StudentID})
+		return false
+	}
+	if msg.StudentID == 0 || msg.ClassroomID == 0 ||
+		!teachesClassroom(c.UserDBID, c.Role, msg.ClassroomID) || !access.Enrolled(msg.StudentID, msg.ClassroomID) {
+		c.sendJSON(WSMsg{Type: "teacher_error", Payload: "Aluno não encontrado nas suas turmas.", StudentID: msg.StudentID})
+		return false
+	}
+	return true
+}
+
+// watchStudent subscribes a teacher to a student's editor in the classroom and
+// replies with the last state of each of the student's open sessions working
+// in it.
+func (c *Client) watchStudent(msg WSMsg) {
+	if !c.reachStudent(msg) {
+		return
+	}
+	c.audit(msg, models.TeacherActionWatch, "")
+	c.Hub.Join(c, WatchRoom(msg.ClassroomID, msg.StudentID))
+
+	// Sessions on other replicas send their editor state with their next edit
+	sessions := c.Hub.Members(UserRoom(msg.StudentID))
+	if len(sessions) == 0 {
+		if presence, err := presenceOf([]models.User{{ID: msg.StudentID}}, msg.ClassroomID); err != nil || !presence[0].Online {
+			c.sendJSON(WSMsg{Type: "student_offline", StudentID: msg.StudentID})
+		}
+	}
+	for _, student := range sessions {
+		student.mu.Lock()
+		code, exerciseID, classroomID := student.editorCode, student.exerciseID, student.classroomID
+		student.mu.Unlock()
+		if classroomID != msg.ClassroomID {
+			continue
+		}
+		c.sendJSON(WSMsg{Type: "student_editor", StudentID: msg.StudentID, ClassroomID: classroomID, ExerciseID: exerciseID, Code: code})
+	}
+}
+
+// sendTeacherMessage shows a private message or hint in the student's IDE.
+func (c *Client) sendTeacherMessage(msg WSMsg) {
+	if msg.Payload == "" || !c.reachStudent(msg) {
+		return
+	}
+	c.audit(msg, models.TeacherActionMessage, msg.Payload)
+	c.publish(UserRoom(msg.StudentID), WSMsg{
+		Type:        "teacher_message",
+		Payload:     msg.Payload,
+		From:        c.Name,
+		ClassroomID: msg.ClassroomID,
+		ExerciseID:  msg.ExerciseID,
+	})
+}
+
+// pushCode replaces the student's editor contents with the teacher's snippet
+// or corrected starter file.
+func (c *Client) pushCode(msg WSMsg) {
+	if !c.reachStudent(msg) {
+		return
+	}
+	c.audit(msg, models.TeacherActionPushCode, msg.Code)
+	c.publish(UserRoom(msg.StudentID), WSMsg{
+		Type:        "code_pushed",
+		Payload:     msg.Payload,
+		Code:        msg.Code,
+		From:        c.Name,
+		ClassroomID: msg.ClassroomID,
+		ExerciseID:  msg.ExerciseID,
+	})
+}
+
+// updateEditor keeps the student's latest editor contents and forwards them to
+// the teachers watching the student in the active classroom. Outside a
+// classroom nobody watches.
+func (c *Client) updateEditor(msg WSMsg) {
+	if c.UserDBID == 0 {
+		return
+	}
+	c.mu.Lock()
+	c.editorCode = msg.Code
+	classroomID, exerciseID := c.classroomID, c.exerciseID
+	c.mu.Unlock()
+	if classroomID == 0 {
+		return
+	}
+
+	c.publish(WatchRoom(classroomID, c.UserDBID), WSMsg{Type: "student_editor", StudentID: c.UserDBID, ClassroomID: classroomID, ExerciseID: exerciseID, Code: msg.Code})
+}
+
+func (c *Client) publish(room string, msg WSMsg) {
+	c.Hub.PublishToRoom(room, msg)
+}
+
+func (c *Client) audit(msg WSMsg, action string, detail string) {
+	entry := models.TeacherAction{
+		TeacherID:   c.UserDBID,
+		StudentID:   msg.StudentID,
+		ClassroomID: msg.ClassroomID,
+		Action:      action,
+		Detail:      detail,
+	}
+	if msg.ExerciseID > 0 {
+		exerciseID := msg.ExerciseID
+		entry.ExerciseID = &exerciseID
+	}
+	if err := initializers.DB.Create(&entry).Error; err != nil {
+		log.Printf("Failed to log teacher action %s for user %d: %v", action, c.UserDBID, err)
+	}
+}
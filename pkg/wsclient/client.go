@@ -0,0 +1,208 @@
+// Package wsclient is a Go client for the /ws WebSocket using protocol 2, for
+// scripts and load tests that compile and run code like the IDE does.
+package wsclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/vitub/CLabServer/pkg/wsproto"
+)
+
+// ErrClosed is returned once the connection is gone.
+var ErrClosed = errors.New("websocket connection closed")
+
+type Client struct {
+	conn   *websocket.Conn
+	frames chan wsproto.Envelope
+
+	writeMu sync.Mutex
+
+	mu        sync.Mutex
+	sessionID string
+	err       error
+}
+
+// Dial connects to url (for example ws://localhost:8080/ws) with protocol 2.
+// token is a JWT sent as a bearer token; empty connects as a guest. sessionID
+// resumes a previous session when set.
+func Dial(ctx context.Context, url string, token string, sessionID string) (*Client, error) {
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	if sessionID != "" {
+		sep := "?"
+		if strings.Contains(url, "?") {
+			sep = "&"
+		}
+		url += sep + "session=" + sessionID
+	}
+
+	dialer := websocket.Dialer{Subprotocols: []string{wsproto.Subprotocol}}
+	conn, _, err := dialer.DialContext(ctx, url, header)
+	if err != nil {
+		return nil, err
+	}
+	if conn.Subprotocol() != wsproto.Subprotocol {
+		conn.Close()
+		return nil, fmt.Errorf("server does not speak protocol %d", wsproto.Version)
+	}
+
+	c := &Client{conn: conn, frames: make(chan wsproto.Envelope, 256)}
+	go c.readLoop()
+	return c, nil
+}
+
+func (c *Client) readLoop() {
+	defer close(c.frames)
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			c.mu.Lock()
+			c.err = err
+			c.mu.Unlock()
+			return
+		}
+		var env wsproto.Envelope
+		if err := json.Unmarshal(data, &env); err != nil {
+			continue
+		}
+		if env.Type == wsproto.TypeSession {
+			var msg wsproto.Message
+			if env.Decode(&msg) == nil {
+				c.mu.Lock()
+				c.sessionID = msg.Payload
+				c.mu.Unlock()
+			}
+		}
+		c.frames <- env
+	}
+}
+
+// SessionID returns the ID to pass to Dial to resume this session.
+func (c *Client) SessionID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sessionID
+}
+
+// Send sends a request message.
+func (c *Client) Send(msg wsproto.Message) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.conn.WriteJSON(msg)
+}
+
+// Next returns the next frame from the server.
+func (c *Client) Next(ctx context.Context) (wsproto.Envelope, error) {
+	select {
+	case env, ok := <-c.frames:
+		if !ok {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			return env, fmt.Errorf("%w: %v", ErrClosed, c.err)
+		}
+		return env, nil
+	case <-ctx.Done():
+		return wsproto.Envelope{}, ctx.Err()
+	}
+}
+
+func (c *Client) Close() error {
+	c.writeMu.Lock()
+	c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	c.writeMu.Unlock()
+	return c.conn.Close()
+}
+
+// RunRequest is a program to compile and run. Input is typed into the
+// program once it compiles.
+type RunRequest struct {
+	Code       string
+	Input      string
+	ExerciseID uint
+	IsExam     bool
+}
+
+// RunResult collects the frames of one run. Exit is nil when the code did not
+// compile or the server could not run it.
+type RunResult struct {
+	Compile wsproto.CompileResult
+	Stdout  string
+	Stderr  string
+	Exit    *wsproto.Exit
+	Notices []string
+	Errors  []string
+	Other   []wsproto.Envelope // Analysis and other frames received during the run
+}
+
+// Run compiles and runs the code and waits for the server to report it
+// stopped, which happens after any AI analysis.
+func (c *Client) Run(ctx context.Context, req RunRequest) (*RunResult, error) {
+	err := c.Send(wsproto.Message{Type: "run_code", Payload: req.Code, ExerciseID: req.ExerciseID, IsExam: req.IsExam})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RunResult{}
+	for {
+		env, err := c.Next(ctx)
+		if err != nil {
+			return result, err
+		}
+
+		switch env.Type {
+		case wsproto.TypeCompileResult:
+			if err := env.Decode(&result.Compile); err != nil {
+				return result, err
+			}
+			if result.Compile.Success && req.Input != "" {
+				if err := c.Send(wsproto.Message{Type: "input", Payload: req.Input}); err != nil {
+					return result, err
+				}
+			}
+		case wsproto.TypeStdout, wsproto.TypeStderr, wsproto.TypeNotice:
+			var text wsproto.Text
+			if err := env.Decode(&text); err != nil {
+				return result, err
+			}
+			switch env.Type {
+			case wsproto.TypeStdout:
+				result.Stdout += text.Text
+			case wsproto.TypeStderr:
+				result.Stderr += text.Text
+			default:
+				result.Notices = append(result.Notices, text.Text)
+			}
+		case wsproto.TypeExit:
+			var exit wsproto.Exit
+			if err := env.Decode(&exit); err != nil {
+				return result, err
+			}
+			result.Exit = &exit
+		case wsproto.TypeError:
+			var e wsproto.Error
+			if err := env.Decode(&e); err != nil {
+				return result, err
+			}
+			result.Errors = append(result.Errors, e.Message)
+		case wsproto.TypeStatus:
+			var status wsproto.Status
+			if err := env.Decode(&status); err != nil {
+				return result, err
+			}
+			if status.Status == "stopped" {
+				return result, nil
+			}
+		default:
+			result.Other = append(result.Other, env)
+		}
+	}
+}
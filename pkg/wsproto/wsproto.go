@@ -0,0 +1,123 @@
+// Package wsproto defines the messages exchanged over the /ws WebSocket. It
+// has no server dependencies so clients and scripts can import it.
+//
+// Protocol 1 (the default) sends terminal output as raw text frames and every
+// other message as a bare JSON Message. Protocol 2, requested with the
+// "clab.v2" subprotocol or ?protocol=2, wraps every server frame in an
+// Envelope whose Type says how to decode Data.
+package wsproto
+
+import "encoding/json"
+
+// Version is the newest protocol the server speaks.
+const Version = 2
+
+// Subprotocol is the Sec-WebSocket-Protocol value that selects protocol 2.
+const Subprotocol = "clab.v2"
+
+// Frame types of protocol 2. Any other Type carries a Message or
+// MonitorMessage of that type in Data.
+const (
+	TypeStdout        = "stdout"         // Text: program output
+	TypeStderr        = "stderr"         // Text: program error output
+	TypeNotice        = "notice"         // Text: server message for the terminal
+	TypeCompileResult = "compile_result" // CompileResult
+	TypeExit          = "exit"           // Exit
+	TypeStatus        = "status"         // Status
+	TypeError         = "error"          // Error: the server could not run the code
+	TypeSession       = "session"        // Message with the resume ID in Payload
+)
+
+// Envelope is a protocol 2 server frame.
+type Envelope struct {
+	V    int             `json:"v"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// Decode unmarshals the envelope's data into v.
+func (e Envelope) Decode(v any) error {
+	return json.Unmarshal(e.Data, v)
+}
+
+type Text struct {
+	Text string `json:"text"`
+}
+
+type CompileResult struct {
+	Success bool   `json:"success"`
+	Output  string `json:"output,omitempty"` // Compiler errors, or warnings on success
+}
+
+// Exit reports how the program ended. Signal is set when the sandbox reports
+// the program was killed by one. DurationMs is the wall-clock time of the run
+// as seen by the server, sandbox start-up included. Code is -1 when the server
+// stopped the run itself.
+type Exit struct {
+	Code       int    `json:"code"`
+	Signal     string `json:"signal,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+	Message    string `json:"message,omitempty"`
+}
+
+type Status struct {
+	Status string `json:"status"` // "stopped" once the run and its analysis are over
+}
+
+type Error struct {
+	Message string `json:"message"`
+}
+
+// Message is sent in both directions: clients send their requests as bare
+// Messages, and the server sends notifications with the same shape.
+type Message struct {
+	Type        string  `json:"type"`
+	Payload     string  `json:"payload"`
+	Rows        int     `json:"rows,omitempty"`
+	Cols        int     `json:"cols,omitempty"`
+	ExerciseID  uint    `json:"exerciseId,omitempty"`
+	ClassroomID uint    `json:"classroomId,omitempty"`
+	StudentID   uint    `json:"studentId,omitempty"`
+	From        string  `json:"from,omitempty"`
+	SessionID   string  `json:"sessionId,omitempty"`
+	Revision    int     `json:"revision,omitempty"`
+	Op          *TextOp `json:"op,omitempty"`
+	Cursor      *Cursor `json:"cursor,omitempty"`
+	IsExam      bool    `json:"isExam,omitempty"`
+	Code        string  `json:"code,omitempty"`
+}
+
+func (m Message) FrameType() string { return m.Type }
+
+// MonitorMessage is a student event sent to the teachers monitoring a classroom.
+type MonitorMessage struct {
+	Type        string `json:"type"`
+	UserID      string `json:"userId"`
+	UserName    string `json:"userName"`
+	ClassroomID uint   `json:"classroomId"`
+	ExerciseID  uint   `json:"exerciseId,omitempty"`
+	Payload     string `json:"payload,omitempty"`
+	Timestamp   string `json:"timestamp"`
+}
+
+func (m MonitorMessage) FrameType() string { return m.Type }
+
+// Typed is a message that can be published to a room.
+type Typed interface {
+	FrameType() string
+}
+
+// TextOp is one edit of a shared document: delete Delete characters at
+// Position, or insert Insert there. Positions count Unicode code points. A
+// replacement is sent as a delete followed by an insert.
+type TextOp struct {
+	Position int    `json:"position"`
+	Delete   int    `json:"delete,omitempty"`
+	Insert   string `json:"insert,omitempty"`
+}
+
+// Cursor is a member's caret and selection anchor in the shared document.
+type Cursor struct {
+	Position int `json:"position"`
+	Anchor   int `json:"anchor"`
+}